@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/cfg"
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+var (
+	inputFile    = flag.String("input", "", "Program or memory image to analyze (stdin if not specified)")
+	targetFile   = flag.String("target", "", "Target file for the report (stdout if not specified)")
+	format       = flag.String("format", "", "Input format: json, bin, image, ihex or raw (detected automatically if not specified)")
+	output       = flag.String("output", "text", "Output format: text or dot")
+	startAddress = flag.Int("start", -1, "Start address of the program, required for raw images which don't store it")
+)
+
+func readProgram() (isa.Program, isa.ProgramFormat, error) {
+	input := os.Stdin
+	if *inputFile != "" {
+		f, err := os.Open(*inputFile)
+		if err != nil {
+			return isa.Program{}, "", err
+		}
+		defer f.Close()
+		input = f
+	}
+	if *format == "" {
+		return isa.ReadProgram(input)
+	}
+	program, err := isa.ReadProgramFormat(input, isa.ProgramFormat(*format))
+	return program, isa.ProgramFormat(*format), err
+}
+
+func main() {
+	flag.Parse()
+	if *output != "text" && *output != "dot" {
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown output format: %s\n", *output)
+		os.Exit(1)
+	}
+
+	program, programFormat, err := readProgram()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while reading program: %s", err.Error())
+		os.Exit(1)
+	}
+	if *startAddress >= 0 {
+		program.StartAddress = *startAddress
+	} else if programFormat == isa.FormatRaw {
+		_, _ = fmt.Fprintln(os.Stderr, "Raw image has no start address, set it with -start")
+		os.Exit(1)
+	}
+
+	graph, findings := cfg.Analyze(program)
+	report := cfg.SerializeText(graph, findings)
+	if *output == "dot" {
+		report = cfg.SerializeDot(graph)
+	}
+	if *targetFile == "" {
+		_, err = os.Stdout.Write(report)
+	} else {
+		err = os.WriteFile(*targetFile, report, 0644)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while writing report: %s", err.Error())
+		os.Exit(1)
+	}
+}
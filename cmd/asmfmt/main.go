@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	t "github.com/Moleus/comp-arch-lab3/pkg/translator"
+)
+
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+var (
+	includePaths fileList
+	check        = flag.Bool("check", false, "Don't change files, list files which are not formatted and exit with 1 if there are any")
+	write        = flag.Bool("w", false, "Write the result to the source file instead of stdout")
+)
+
+// formatFile returns the source and its formatted version, stdin is read if the file name is empty
+func formatFile(fileName string) ([]byte, []byte, error) {
+	var source []byte
+	var err error
+	if fileName == "" {
+		source, err = io.ReadAll(os.Stdin)
+	} else {
+		source, err = os.ReadFile(fileName)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	translator := t.NewTranslatorWithOptions(t.Options{FileName: fileName, IncludePaths: includePaths})
+	formatted, err := translator.Format(string(source))
+	if errors.As(err, &t.ErrorList{}) {
+		_, _ = fmt.Fprint(os.Stderr, t.FormatDiagnostics(translator.GetDiagnostics()))
+	}
+	return source, formatted, err
+}
+
+func main() {
+	flag.Var(&includePaths, "I", "Directory to search for included files (can be repeated)")
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{""}
+	}
+	failed := false
+	for _, file := range files {
+		source, formatted, err := formatFile(file)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error while formatting %s: %s\n", file, err.Error())
+			failed = true
+			continue
+		}
+		switch {
+		case *check:
+			if !bytes.Equal(source, formatted) {
+				fmt.Println(file)
+				failed = true
+			}
+		case *write && file != "":
+			if err := os.WriteFile(file, formatted, 0644); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "Error while writing %s: %s\n", file, err.Error())
+				failed = true
+			}
+		default:
+			_, _ = os.Stdout.Write(formatted)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
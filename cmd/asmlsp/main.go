@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/lsp"
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+)
+
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+var includePaths fileList
+
+func main() {
+	flag.Var(&includePaths, "I", "Directory to search for included files (can be repeated)")
+	flag.Parse()
+
+	server := lsp.NewServer(os.Stdin, os.Stdout, translator.Options{IncludePaths: includePaths})
+	if err := server.Serve(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while serving: %s", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/compiler"
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+)
+
+var (
+	inputFile  = flag.String("input", "", "Source file of the structured language (stdin if not specified)")
+	targetFile = flag.String("target", "", "Target file for assembly or machine code (stdout if not specified)")
+	format     = flag.String("format", "json", "Output format: asm (assembly for the translator) or a format of machine code: json, bin, hexdump, image, ihex or raw")
+	optimize   = flag.Bool("optimize", false, "Apply peephole optimizations to the generated assembly")
+)
+
+func compile(source string) ([]byte, error) {
+	if *format == "asm" {
+		assembly, err := compiler.Compile(source)
+		return []byte(assembly), err
+	}
+	program, err := compiler.CompileProgram(source, translator.Options{Optimize: *optimize})
+	if err != nil {
+		return nil, err
+	}
+	return isa.SerializeProgram(program, isa.ProgramFormat(*format))
+}
+
+func main() {
+	flag.Parse()
+	if *format == "obj" {
+		_, _ = fmt.Fprintln(os.Stderr, "Objects aren't supported, the program is compiled from one source file")
+		os.Exit(1)
+	}
+
+	var source []byte
+	var err error
+	if *inputFile == "" {
+		source, err = io.ReadAll(os.Stdin)
+	} else {
+		source, err = os.ReadFile(*inputFile)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while reading input file: %s", err.Error())
+		os.Exit(1)
+	}
+
+	output, err := compile(string(source))
+	if err != nil {
+		name := *inputFile
+		if name == "" {
+			name = "<input>"
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "%s:%s\n", name, err.Error())
+		os.Exit(1)
+	}
+	if *targetFile == "" {
+		_, err = os.Stdout.Write(output)
+	} else {
+		err = os.WriteFile(*targetFile, output, 0644)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while writing output: %s", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/disassembler"
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+var (
+	inputFile    = flag.String("input", "", "Program or memory image to disassemble (stdin if not specified)")
+	targetFile   = flag.String("target", "", "Target file for assembly code (stdout if not specified)")
+	format       = flag.String("format", "", "Input format: json, bin, image, ihex or raw (detected automatically if not specified)")
+	startAddress = flag.Int("start", -1, "Start address of the program, required for raw images which don't store it")
+)
+
+func readProgram() (isa.Program, isa.ProgramFormat, error) {
+	input := os.Stdin
+	if *inputFile != "" {
+		f, err := os.Open(*inputFile)
+		if err != nil {
+			return isa.Program{}, "", err
+		}
+		defer f.Close()
+		input = f
+	}
+	if *format == "" {
+		return isa.ReadProgram(input)
+	}
+	program, err := isa.ReadProgramFormat(input, isa.ProgramFormat(*format))
+	return program, isa.ProgramFormat(*format), err
+}
+
+func writeAssemblyCode(assemblyCode []byte, targetFile string) error {
+	if targetFile == "" {
+		_, err := io.Copy(os.Stdout, bytes.NewReader(assemblyCode))
+		return err
+	}
+	return os.WriteFile(targetFile, assemblyCode, 0644)
+}
+
+func main() {
+	flag.Parse()
+
+	program, programFormat, err := readProgram()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while reading program: %s", err.Error())
+		os.Exit(1)
+	}
+	if *startAddress >= 0 {
+		program.StartAddress = *startAddress
+	} else if programFormat == isa.FormatRaw {
+		_, _ = fmt.Fprintln(os.Stderr, "Raw image has no start address, set it with -start")
+		os.Exit(1)
+	}
+
+	err = writeAssemblyCode(disassembler.Disassemble(program), *targetFile)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while writing assembly code: %s", err.Error())
+		os.Exit(1)
+	}
+}
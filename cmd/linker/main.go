@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/linker"
+)
+
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+var (
+	targetFile = flag.String("target", "", "Target file (stdout if not specified)")
+	format     = flag.String("format", "json", "Output format: json, bin, hexdump, image, ihex or raw")
+	entry      = flag.String("entry", linker.DefaultEntry, "Symbol where execution starts")
+	archive    = flag.Bool("archive", false, "Pack objects into a library instead of linking")
+	libraries  fileList
+)
+
+func readObject(filename string) (isa.Object, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return isa.Object{}, err
+	}
+	defer f.Close()
+	object, err := isa.ReadObject(f)
+	if err != nil {
+		return isa.Object{}, fmt.Errorf("%s: %w", filename, err)
+	}
+	if object.Name == "" {
+		object.Name = filepath.Base(filename)
+	}
+	return object, nil
+}
+
+func readLibrary(filename string) (isa.Library, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return isa.Library{}, err
+	}
+	defer f.Close()
+	library, err := isa.ReadLibrary(f)
+	if err != nil {
+		return isa.Library{}, fmt.Errorf("%s: %w", filename, err)
+	}
+	return library, nil
+}
+
+func writeOutput(output []byte, targetFile string) error {
+	if targetFile == "" {
+		_, err := io.Copy(os.Stdout, bytes.NewReader(output))
+		return err
+	}
+	return os.WriteFile(targetFile, output, 0644)
+}
+
+func main() {
+	flag.Var(&libraries, "lib", "Path to library file (can be repeated)")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "Object files are not specified")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	objects := make([]isa.Object, 0, flag.NArg())
+	for _, filename := range flag.Args() {
+		object, err := readObject(filename)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error while reading object file: %s", err.Error())
+			os.Exit(1)
+		}
+		objects = append(objects, object)
+	}
+
+	var output []byte
+	var err error
+	if *archive {
+		output, err = isa.SerializeLibrary(isa.Library{Objects: objects})
+	} else {
+		output, err = link(objects)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while linking:\n%s\n", err.Error())
+		os.Exit(1)
+	}
+
+	err = writeOutput(output, *targetFile)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while writing output: %s", err.Error())
+		os.Exit(1)
+	}
+}
+
+func link(objects []isa.Object) ([]byte, error) {
+	loadedLibraries := make([]isa.Library, 0, len(libraries))
+	for _, filename := range libraries {
+		library, err := readLibrary(filename)
+		if err != nil {
+			return nil, err
+		}
+		loadedLibraries = append(loadedLibraries, library)
+	}
+	program, err := linker.Link(objects, loadedLibraries, *entry)
+	if err != nil {
+		return nil, err
+	}
+	return isa.SerializeProgram(program, isa.ProgramFormat(*format))
+}
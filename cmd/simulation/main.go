@@ -10,11 +10,26 @@ import (
 )
 
 var (
-	programCodeFilename = flag.String("program", "", "Path to program file")
+	programCodeFilename = flag.String("program", "", "Path to program file (JSON, binary, image, Intel HEX or raw image, detected automatically)")
 	dataInputFilename   = flag.String("io-data", "", "Path to IO data file")
 	stdout              = flag.String("stdout", "/tmp/dataPathOut.txt", "Path to data path output file")
+	configFilename      = flag.String("config", "", "Path to machine config file in YAML or JSON (defaults are used if not specified)")
+	noFastForward       = flag.Bool("no-fast-forward", false, "Simulate idle loops tick by tick instead of skipping to the next input event")
+	codeWrites          = flag.String("code-writes", "", "Policy for writes into code outside of writable regions: allow, warn or fault (overrides config)")
 )
 
+func readConfig(configFilename string) (machine.Config, error) {
+	if configFilename == "" {
+		return machine.DefaultConfig(), nil
+	}
+	f, err := os.Open(configFilename)
+	if err != nil {
+		return machine.Config{}, err
+	}
+	defer f.Close()
+	return machine.ReadConfig(f)
+}
+
 func main() {
 	flag.Parse()
 
@@ -40,7 +55,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	program, err := isa.ReadCode(f)
+	program, programFormat, err := isa.ReadProgram(f)
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "Error while reading program file: %s", err.Error())
 		os.Exit(1)
@@ -52,6 +67,26 @@ func main() {
 		os.Exit(1)
 	}
 
+	config, err := readConfig(*configFilename)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while reading machine config: %s", err.Error())
+		os.Exit(1)
+	}
+	if programFormat == isa.FormatRaw && config.ResetVector == nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Raw image has no start address, set reset_vector in machine config")
+		os.Exit(1)
+	}
+	if *noFastForward {
+		config.DisableFastForward = true
+	}
+	if *codeWrites != "" {
+		config.CodeWrites = machine.CodeWritePolicy(*codeWrites)
+		if err := config.Validate(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error while reading machine config: %s", err.Error())
+			os.Exit(1)
+		}
+	}
+
 	dataPathOutput, err := os.Create(*stdout)
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "Error while opening data path output file: %s", err.Error())
@@ -60,7 +95,7 @@ func main() {
 
 	controlUnitStateOutput := os.Stdout
 
-	err = machine.RunSimulation(ioData, program, dataPathOutput, controlUnitStateOutput)
+	err = machine.RunSimulation(config, ioData, program, dataPathOutput, controlUnitStateOutput)
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "Error while running simulation: %s", err.Error())
 		os.Exit(1)
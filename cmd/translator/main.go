@@ -2,20 +2,100 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/Moleus/comp-arch-lab3/pkg/isa"
 	t "github.com/Moleus/comp-arch-lab3/pkg/translator"
 )
 
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
 var (
-	inputFile  = flag.String("input", "", "Input file with assembly code (stdin if not specified)")
-	targetFile = flag.String("target", "", "Target file for machine code (stdout if not specified)")
+	includePaths fileList
+	inputFile    = flag.String("input", "", "Input file with assembly code (stdin if not specified)")
+	targetFile   = flag.String("target", "", "Target file for machine code (stdout if not specified)")
+	diagnostics  = flag.String("diagnostics", "text", "Format of errors and warnings: text (compiler style with source snippets) or json (for editors)")
+	symbolsFile  = flag.String("symbols", "", "File for the symbol table with addresses of labels and values of constants")
+	listingFile  = flag.String("listing", "", "File for the listing with addresses and encoded words of source lines and the symbol table")
+	optimize     = flag.Bool("optimize", false, "Apply peephole optimizations and print removed instructions")
+	format       = flag.String("format", "json", "Output format: json, bin (binary machine code), hexdump (encoded words for inspection), image (hex word per address), ihex (Intel HEX), raw (little-endian memory image) or obj (relocatable object for the linker)")
 )
 
+func translateProgram(translator t.Translator, assemblyCode string) ([]byte, error) {
+	program, err := translator.Translate(assemblyCode)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "LoC: %d; instructions count: %d\n", translator.GetLinesOfCode(), len(program.Instructions))
+	printOptimizations(translator)
+	if *symbolsFile != "" {
+		if err := os.WriteFile(*symbolsFile, t.SerializeSymbolTable(translator.GetSymbols()), 0644); err != nil {
+			return nil, err
+		}
+	}
+	if *listingFile != "" {
+		listing, err := t.SerializeListing(translator.GetListing(), translator.GetSymbols())
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(*listingFile, listing, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return isa.SerializeProgram(program, isa.ProgramFormat(*format))
+}
+
+func translateObject(translator t.Translator, assemblyCode string) ([]byte, error) {
+	object, err := translator.TranslateObject(assemblyCode)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "LoC: %d; symbols: %d; relocations: %d\n", translator.GetLinesOfCode(), len(object.Symbols), len(object.Relocations))
+	printOptimizations(translator)
+	if *inputFile != "" {
+		object.Name = filepath.Base(*inputFile)
+	}
+	return isa.SerializeObject(object)
+}
+
+func printOptimizations(translator t.Translator) {
+	if !*optimize {
+		return
+	}
+	for _, optimization := range translator.GetOptimizations() {
+		_, _ = fmt.Fprintln(os.Stderr, optimization)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "%d instruction(s) removed by optimizations\n", len(translator.GetOptimizations()))
+}
+
+func printDiagnostics(translator t.Translator) error {
+	if *diagnostics == "json" {
+		output, err := t.SerializeDiagnostics(translator.GetDiagnostics())
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(os.Stderr, string(output))
+		return err
+	}
+	_, err := fmt.Fprint(os.Stderr, t.FormatDiagnostics(translator.GetDiagnostics()))
+	return err
+}
+
 func readAssemblyCode(inputFile string) ([]byte, error) {
 	if inputFile == "" {
 		return io.ReadAll(os.Stdin)
@@ -32,6 +112,7 @@ func writeMachineCode(machineCode []byte, targetFile string) error {
 }
 
 func main() {
+	flag.Var(&includePaths, "I", "Directory to search for included files (can be repeated)")
 	flag.Parse()
 
 	var assemblyCode []byte
@@ -42,18 +123,35 @@ func main() {
 		os.Exit(1)
 	}
 
-	translator := t.NewTranslator()
-	translationOutput, err := translator.Translate(string(assemblyCode))
-	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error while translating assembly code: %s", err.Error())
+	if *diagnostics != "text" && *diagnostics != "json" {
+		_, _ = fmt.Fprintf(os.Stderr, "Unknown diagnostics format: %s", *diagnostics)
+		os.Exit(1)
+	}
+	if *format == "obj" && *symbolsFile != "" {
+		_, _ = fmt.Fprintf(os.Stderr, "Symbol table is written only for programs, objects have their own symbols")
+		os.Exit(1)
+	}
+	if *format == "obj" && *listingFile != "" {
+		_, _ = fmt.Fprintf(os.Stderr, "Listing is written only for programs, addresses of objects are assigned by the linker")
 		os.Exit(1)
 	}
 
-	fmt.Printf("LoC: %d; instructions count: %d\n", translator.GetLinesOfCode(), len(translationOutput.Instructions))
-
-	serializationOutput, err := isa.SerializeCode(translationOutput)
+	translator := t.NewTranslatorWithOptions(t.Options{FileName: *inputFile, IncludePaths: includePaths, Optimize: *optimize})
+	var serializationOutput []byte
+	if *format == "obj" {
+		serializationOutput, err = translateObject(translator, string(assemblyCode))
+	} else {
+		serializationOutput, err = translateProgram(translator, string(assemblyCode))
+	}
+	if printErr := printDiagnostics(translator); printErr != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error while printing diagnostics: %s", printErr.Error())
+		os.Exit(1)
+	}
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error while serializing machine code: %s", err.Error())
+		// errors of the source are already printed as diagnostics
+		if !errors.As(err, &t.ErrorList{}) {
+			_, _ = fmt.Fprintf(os.Stderr, "Error while translating assembly code: %s", err.Error())
+		}
 		os.Exit(1)
 	}
 
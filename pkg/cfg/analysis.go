@@ -0,0 +1,220 @@
+package cfg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+type FindingKind string
+
+const (
+	FindingUnreachable    FindingKind = "unreachable-code"
+	FindingIntoData       FindingKind = "flow-into-data"
+	FindingEndlessLoop    FindingKind = "loop-without-exit"
+	FindingHandlerReturn  FindingKind = "return-without-iret"
+	FindingStackImbalance FindingKind = "unbalanced-stack"
+	FindingStackUnderflow FindingKind = "stack-underflow"
+	FindingClobberedAC    FindingKind = "handler-clobbers-ac"
+)
+
+// Finding is a problem of the control flow at the address
+type Finding struct {
+	Kind    FindingKind
+	Address int
+	Message string
+}
+
+// Analyze builds the graph of the program and checks it: code which is never executed, control reaching data
+// words, loops which can't be left, interrupt handlers which can end without `iret`, the balance of the stack
+// and AC which handlers change under the interrupted code
+func Analyze(program isa.Program) (*Graph, []Finding) {
+	graph, b := build(program)
+	findings := make([]Finding, 0)
+	findings = append(findings, b.unreachable(graph)...)
+	findings = append(findings, b.flowIntoData(graph)...)
+	findings = append(findings, graph.endlessLoops()...)
+	findings = append(findings, graph.handlerReturns()...)
+	findings = append(findings, graph.checkStack()...)
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return a.Address - b.Address
+	})
+	return graph, findings
+}
+
+// unreachable reports runs of instructions of a program which are never reached, images have no such
+// instructions because all their words are numbers
+func (b *builder) unreachable(graph *Graph) []Finding {
+	findings := make([]Finding, 0)
+	addresses := make([]int, 0)
+	for address, term := range b.words {
+		if _, ok := b.instructions[address]; !ok && !b.image && !isa.IsConstant(term) {
+			addresses = append(addresses, address)
+		}
+	}
+	slices.Sort(addresses)
+	for i := 0; i < len(addresses); {
+		end := i + 1
+		for end < len(addresses) && addresses[end] == addresses[end-1]+1 {
+			end++
+		}
+		message := fmt.Sprintf("%d unreachable instruction(s) at %s", end-i, graph.Name(addresses[i]))
+		if end-i == 1 {
+			message = fmt.Sprintf("unreachable instruction '%s' at %s", b.describe(addresses[i]), graph.Name(addresses[i]))
+		}
+		findings = append(findings, Finding{Kind: FindingUnreachable, Address: addresses[i], Message: message})
+		i = end
+	}
+	return findings
+}
+
+func (b *builder) flowIntoData(graph *Graph) []Finding {
+	findings := make([]Finding, 0)
+	for _, next := range b.edges {
+		target := b.target(graph, next.target)
+		var message string
+		switch {
+		case next.vector:
+			message = fmt.Sprintf("interrupt vector points to %s", target)
+		case next.jump:
+			message = fmt.Sprintf("'%s' at %s jumps to %s", b.describe(next.from), graph.Name(next.from), target)
+		default:
+			message = fmt.Sprintf("'%s' at %s falls through into %s", b.describe(next.from), graph.Name(next.from), target)
+		}
+		findings = append(findings, Finding{Kind: FindingIntoData, Address: next.from, Message: message})
+	}
+	return findings
+}
+
+func (b *builder) target(graph *Graph, address int) string {
+	if address >= isa.ImageSize {
+		return "the end of memory"
+	}
+	if _, ok := b.words[address]; !ok {
+		return fmt.Sprintf("unused memory at %s", graph.Name(address))
+	}
+	return fmt.Sprintf("data at %s", graph.Name(address))
+}
+
+func (b *builder) describe(address int) string {
+	if term, ok := b.instructions[address]; ok {
+		return strings.ToLower(term.Opcode.String())
+	}
+	return strings.ToLower(b.words[address].Opcode.String())
+}
+
+// endlessLoops finds strongly connected components of blocks which have no edges leaving them
+func (g *Graph) endlessLoops() []Finding {
+	findings := make([]Finding, 0)
+	for _, component := range g.components() {
+		first := component[0]
+		cycle := len(component) > 1 || slices.Contains(first.Successors, first.Start)
+		if !cycle || g.leaves(component) {
+			continue
+		}
+		findings = append(findings, Finding{
+			Kind:    FindingEndlessLoop,
+			Address: first.Start,
+			Message: fmt.Sprintf("loop at %s has no exit", g.Name(first.Start)),
+		})
+	}
+	return findings
+}
+
+func (g *Graph) leaves(component []*Block) bool {
+	inside := make(map[int]bool)
+	for _, block := range component {
+		inside[block.Start] = true
+	}
+	for _, block := range component {
+		for _, successor := range block.Successors {
+			if !inside[successor] {
+				return true
+			}
+		}
+		// an instruction which transfers control to data leaves the loop too, it's reported separately
+		if len(block.Successors) < expectedSuccessors(block.last()) {
+			return true
+		}
+	}
+	return false
+}
+
+func expectedSuccessors(instruction isa.MachineCodeTerm) int {
+	switch opcode := instruction.Opcode; {
+	case opcode == isa.OpcodeHlt || opcode == isa.OpcodeIret:
+		return 0
+	case opcode.Type() == isa.OpcodeTypeBranch && opcode != isa.OpcodeJmp && *instruction.Operand != instruction.Index+1:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// components are strongly connected components of blocks by Tarjan's algorithm, blocks of a component are
+// ordered by addresses and components by their first blocks
+func (g *Graph) components() [][]*Block {
+	index := make(map[int]int)
+	lowLink := make(map[int]int)
+	onStack := make(map[int]bool)
+	stack := make([]*Block, 0)
+	components := make([][]*Block, 0)
+
+	var connect func(block *Block)
+	connect = func(block *Block) {
+		index[block.Start] = len(index)
+		lowLink[block.Start] = index[block.Start]
+		stack = append(stack, block)
+		onStack[block.Start] = true
+		for _, address := range block.Successors {
+			successor, _ := g.Block(address)
+			if _, visited := index[address]; !visited {
+				connect(successor)
+				lowLink[block.Start] = min(lowLink[block.Start], lowLink[address])
+			} else if onStack[address] {
+				lowLink[block.Start] = min(lowLink[block.Start], index[address])
+			}
+		}
+		if lowLink[block.Start] != index[block.Start] {
+			return
+		}
+		component := make([]*Block, 0)
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top.Start] = false
+			component = append(component, top)
+			if top == block {
+				break
+			}
+		}
+		slices.SortFunc(component, func(a, b *Block) int { return a.Start - b.Start })
+		components = append(components, component)
+	}
+	for _, block := range g.Blocks {
+		if _, visited := index[block.Start]; !visited {
+			connect(block)
+		}
+	}
+	slices.SortFunc(components, func(a, b []*Block) int { return a[0].Start - b[0].Start })
+	return components
+}
+
+// handlerReturns finds paths of the interrupt handler which end with `hlt`: the control unit returns from
+// the interrupt on it like on `iret`, but it was likely meant to stop the program
+func (g *Graph) handlerReturns() []Finding {
+	findings := make([]Finding, 0)
+	for _, block := range g.Blocks {
+		if !block.Handler || block.last().Opcode != isa.OpcodeHlt {
+			continue
+		}
+		findings = append(findings, Finding{
+			Kind:    FindingHandlerReturn,
+			Address: block.End(),
+			Message: fmt.Sprintf("'hlt' at %s returns from the interrupt handler at %s without 'iret'", g.Name(block.End()), g.Name(g.Handler)),
+		})
+	}
+	return findings
+}
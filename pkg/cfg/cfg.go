@@ -0,0 +1,247 @@
+package cfg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/machine"
+)
+
+// NoHandler is the handler address of programs which don't enable interrupts
+const NoHandler = -1
+
+// Block is a basic block: instructions at consecutive addresses which are executed one after another
+type Block struct {
+	Start        int
+	Instructions []isa.MachineCodeTerm
+	// Successors are start addresses of blocks where control goes after the last instruction
+	Successors []int
+	// Handler marks blocks reachable from the interrupt handler
+	Handler bool
+}
+
+// End is the address of the last instruction of the block
+func (b *Block) End() int {
+	return b.Start + len(b.Instructions) - 1
+}
+
+func (b *Block) last() isa.MachineCodeTerm {
+	return b.Instructions[len(b.Instructions)-1]
+}
+
+type Graph struct {
+	Entry   int
+	Handler int
+	// Blocks are ordered by their addresses
+	Blocks []*Block
+	// StackDepth and HandlerStackDepth are the worst-case numbers of pushed words, they are set by Analyze
+	StackDepth        int
+	HandlerStackDepth int
+	labels            map[int]string
+}
+
+// Block returns the block starting at the address
+func (g *Graph) Block(address int) (*Block, bool) {
+	index, ok := slices.BinarySearchFunc(g.Blocks, address, func(block *Block, address int) int {
+		return block.Start - address
+	})
+	if !ok {
+		return nil, false
+	}
+	return g.Blocks[index], true
+}
+
+// Name is the label of the address if the program has one, otherwise the address itself
+func (g *Graph) Name(address int) string {
+	if label, ok := g.labels[address]; ok {
+		return label
+	}
+	return fmt.Sprintf("0x%04X", address)
+}
+
+// edge is a transfer of control found while walking the program, the target may be not an instruction
+type edge struct {
+	from   int
+	target int
+	jump   bool
+	// vector is the edge from the interrupt vector to the handler
+	vector bool
+}
+
+type builder struct {
+	program isa.Program
+	words   map[int]isa.MachineCodeTerm
+	// image is set for memory images where every word is a number and code is recognized by decoding
+	image        bool
+	instructions map[int]isa.MachineCodeTerm
+	leaders      map[int]bool
+	edges        []edge
+	handler      int
+}
+
+// Build walks the control flow of the program from the start address and from the interrupt handler, which
+// is taken from the interrupt vector once `ei` is reachable. Instructions of programs are terms with opcodes,
+// words of memory images are decoded when they are reached.
+func Build(program isa.Program) *Graph {
+	graph, _ := build(program)
+	return graph
+}
+
+func build(program isa.Program) (*Graph, *builder) {
+	b := builder{
+		program:      program,
+		words:        make(map[int]isa.MachineCodeTerm),
+		image:        !slices.ContainsFunc(program.Instructions, func(term isa.MachineCodeTerm) bool { return !isa.IsConstant(term) }),
+		instructions: make(map[int]isa.MachineCodeTerm),
+		leaders:      map[int]bool{program.StartAddress: true},
+		handler:      NoHandler,
+	}
+	graph := &Graph{Entry: program.StartAddress, Handler: NoHandler, labels: make(map[int]string)}
+	for _, term := range program.Instructions {
+		b.words[term.Index] = term
+		// anonymous labels like `1@2` aren't unique in the source, addresses name them better
+		if term.Label != nil && !strings.Contains(*term.Label, "@") {
+			graph.labels[term.Index] = *term.Label
+		}
+	}
+	b.walk(program.StartAddress)
+	graph.Handler = b.handler
+	graph.Blocks = b.blocks()
+	if b.handler != NoHandler {
+		graph.markHandler()
+	}
+	return graph, &b
+}
+
+// instruction returns the instruction at the address, words which are data aren't instructions
+func (b *builder) instruction(address int) (isa.MachineCodeTerm, bool) {
+	if address < 0 || address >= isa.ImageSize {
+		return isa.MachineCodeTerm{}, false
+	}
+	term, ok := b.words[address]
+	if !b.image {
+		return term, ok && !isa.IsConstant(term)
+	}
+	// memory images skip zero words, they hold `nop`
+	var word uint32
+	if ok {
+		encoded, err := isa.EncodeTerm(term)
+		if err != nil {
+			return isa.MachineCodeTerm{}, false
+		}
+		word = encoded
+	}
+	decoded, err := isa.DecodeTerm(address, isa.WordKindInstruction, word)
+	if err != nil || decoded.Opcode.Type() != isa.OpcodeTypeAddressless && decoded.Operand == nil {
+		return isa.MachineCodeTerm{}, false
+	}
+	decoded.Label = term.Label
+	decoded.Writable = term.Writable
+	return decoded, true
+}
+
+func (b *builder) walk(entry int) {
+	pending := []int{entry}
+	for len(pending) > 0 {
+		address := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, ok := b.instructions[address]; ok {
+			continue
+		}
+		instruction, ok := b.instruction(address)
+		if !ok {
+			continue
+		}
+		b.instructions[address] = instruction
+		for _, next := range b.successors(instruction) {
+			if _, ok := b.instruction(next.target); !ok {
+				b.edges = append(b.edges, next)
+				continue
+			}
+			if next.jump {
+				b.leaders[next.target] = true
+			}
+			pending = append(pending, next.target)
+		}
+		if instruction.Opcode.Type() == isa.OpcodeTypeBranch {
+			b.leaders[address+1] = true
+		}
+		if instruction.Opcode == isa.OpcodeEi && b.handler == NoHandler {
+			b.enableInterrupts(&pending)
+		}
+	}
+}
+
+// enableInterrupts adds the handler from the interrupt vector, it's a data word before the program
+func (b *builder) enableInterrupts(pending *[]int) {
+	vector, ok := b.words[machine.InterruptVectorFirst]
+	if !ok || b.program.StartAddress == machine.InterruptVectorFirst || !b.image && !isa.IsConstant(vector) || vector.Operand == nil {
+		return
+	}
+	b.handler = *vector.Operand
+	if _, ok := b.instruction(b.handler); !ok {
+		b.edges = append(b.edges, edge{from: machine.InterruptVectorFirst, target: b.handler, jump: true, vector: true})
+		return
+	}
+	b.leaders[b.handler] = true
+	*pending = append(*pending, b.handler)
+}
+
+func (b *builder) successors(instruction isa.MachineCodeTerm) []edge {
+	address := instruction.Index
+	next := edge{from: address, target: address + 1}
+	switch opcode := instruction.Opcode; {
+	case opcode == isa.OpcodeHlt || opcode == isa.OpcodeIret:
+		return nil
+	case opcode == isa.OpcodeJmp:
+		return []edge{{from: address, target: *instruction.Operand, jump: true}}
+	case opcode.Type() == isa.OpcodeTypeBranch:
+		return []edge{{from: address, target: *instruction.Operand, jump: true}, next}
+	default:
+		return []edge{next}
+	}
+}
+
+// blocks splits reached instructions at leaders and after instructions which transfer control
+func (b *builder) blocks() []*Block {
+	addresses := make([]int, 0, len(b.instructions))
+	for address := range b.instructions {
+		addresses = append(addresses, address)
+	}
+	slices.Sort(addresses)
+
+	blocks := make([]*Block, 0)
+	var current *Block
+	for _, address := range addresses {
+		if current == nil || b.leaders[address] || current.End() != address-1 {
+			current = &Block{Start: address}
+			blocks = append(blocks, current)
+		}
+		instruction := b.instructions[address]
+		current.Instructions = append(current.Instructions, instruction)
+		if _, ok := b.instructions[address+1]; instruction.Opcode.Type() == isa.OpcodeTypeBranch || !ok || b.leaders[address+1] {
+			for _, next := range b.successors(instruction) {
+				if _, ok := b.instructions[next.target]; ok && !slices.Contains(current.Successors, next.target) {
+					current.Successors = append(current.Successors, next.target)
+				}
+			}
+			current = nil
+		}
+	}
+	return blocks
+}
+
+func (g *Graph) markHandler() {
+	pending := []int{g.Handler}
+	for len(pending) > 0 {
+		block, ok := g.Block(pending[len(pending)-1])
+		pending = pending[:len(pending)-1]
+		if !ok || block.Handler {
+			continue
+		}
+		block.Handler = true
+		pending = append(pending, block.Successors...)
+	}
+}
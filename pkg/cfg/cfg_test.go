@@ -0,0 +1,180 @@
+package cfg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+	"gotest.tools/v3/assert"
+)
+
+func translate(t *testing.T, source string) isa.Program {
+	t.Helper()
+	program, err := translator.NewTranslator().Translate(source)
+	assert.NilError(t, err, source)
+	return program
+}
+
+const faulty = `vector: word: handler
+value: word: 5
+start: ei
+  ld value
+  jz stop
+spin: inc
+  jmp spin
+stop: hlt
+  ld value
+handler: ld value
+  jz 1f
+  hlt
+1: iret
+tail: ld value
+  inc`
+
+func TestAnalyze(t *testing.T) {
+	graph, findings := Analyze(translate(t, faulty))
+	assert.Equal(t, string(SerializeText(graph, findings)), `entry: start
+interrupt handler: handler
+stack depth: 0, handler 0, worst case 2
+
+block start
+  0002  ei
+  0003  ld value
+  0004  jz stop
+  -> stop, spin
+
+block spin
+  0005  inc
+  0006  jmp spin
+  -> spin
+
+block stop
+  0007  hlt
+
+block handler (handler)
+  0009  ld value
+  000A  jz 0x000C
+  -> 0x000C, 0x000B
+
+block 0x000B (handler)
+  000B  hlt
+
+block 0x000C (handler)
+  000C  iret
+
+5 finding(s)
+0005: loop-without-exit: loop at spin has no exit
+0008: unreachable-code: unreachable instruction 'ld' at 0x0008
+0009: handler-clobbers-ac: interrupt handler at handler returns with AC changed by 'ld' at handler, AC is used after 'ld' at 0x0003 where interrupts are enabled
+000B: return-without-iret: 'hlt' at 0x000B returns from the interrupt handler at handler without 'iret'
+000D: unreachable-code: 2 unreachable instruction(s) at tail
+`)
+}
+
+func TestFlowIntoData(t *testing.T) {
+	_, findings := Analyze(translate(t, `out_port: word: 1
+start: ld out_port
+  jz message
+  out out_port
+message: word: 'a', 0`))
+	assert.DeepEqual(t, findings, []Finding{
+		{Kind: FindingIntoData, Address: 2, Message: "'jz' at 0x0002 jumps to data at message"},
+		{Kind: FindingIntoData, Address: 3, Message: "'out' at 0x0003 falls through into data at message"},
+	})
+}
+
+// images have no labels and no instructions, code is decoded while walking and nothing is unreachable
+func TestImage(t *testing.T) {
+	output, err := isa.SerializeImage(translate(t, faulty))
+	assert.NilError(t, err)
+	memory, err := isa.ReadImage(bytes.NewReader(output))
+	assert.NilError(t, err)
+
+	graph, findings := Analyze(memory)
+	starts := make([]int, 0)
+	for _, block := range graph.Blocks {
+		starts = append(starts, block.Start)
+	}
+	assert.DeepEqual(t, starts, []int{2, 5, 7, 9, 11, 12})
+	assert.Equal(t, graph.Handler, 9)
+	assert.DeepEqual(t, findings, []Finding{
+		{Kind: FindingEndlessLoop, Address: 5, Message: "loop at 0x0005 has no exit"},
+		{Kind: FindingClobberedAC, Address: 9, Message: "interrupt handler at 0x0009 returns with AC changed by 'ld' at 0x0009, AC is used after 'ld' at 0x0003 where interrupts are enabled"},
+		{Kind: FindingHandlerReturn, Address: 11, Message: "'hlt' at 0x000B returns from the interrupt handler at 0x0009 without 'iret'"},
+	})
+}
+
+func TestStackBalance(t *testing.T) {
+	graph, findings := Analyze(translate(t, `start: push
+  push
+  pop
+  jz done
+  pop
+  pop
+done: hlt`))
+	assert.Equal(t, graph.StackDepth, 2)
+	assert.DeepEqual(t, findings, []Finding{
+		{Kind: FindingStackUnderflow, Address: 5, Message: "'pop' at 0x0005 with the empty stack"},
+		{Kind: FindingStackImbalance, Address: 6, Message: "stack depth at done is 0 or 1 depending on the path"},
+	})
+
+	_, findings = Analyze(translate(t, `start: push
+  jnz start
+  hlt`))
+	assert.DeepEqual(t, findings, []Finding{
+		{Kind: FindingStackImbalance, Address: 0, Message: "stack depth at start is 0 or 1 depending on the path"},
+		{Kind: FindingStackImbalance, Address: 2, Message: "1 value(s) left on the stack at 'hlt' at 0x0002"},
+	})
+}
+
+const counter = `vector: word: handler
+in_port: word: 0
+limit: word: 10
+start: ei
+  cla
+loop: inc
+  cmp limit
+  jnz loop
+  hlt
+handler: `
+
+// AC is live in the loop, so the handler has to restore it, flags are restored by the control unit
+func TestHandlerClobbersAccumulator(t *testing.T) {
+	_, findings := Analyze(translate(t, counter+`in in_port
+  iret`))
+	assert.DeepEqual(t, findings, []Finding{
+		{Kind: FindingClobberedAC, Address: 9, Message: "interrupt handler at handler returns with AC changed by 'in' at handler, AC is used after 'cla' at 0x0004 where interrupts are enabled"},
+	})
+
+	graph, findings := Analyze(translate(t, counter+`push
+  in in_port
+  cmp limit
+  pop
+  iret`))
+	assert.Equal(t, len(findings), 0)
+	assert.Equal(t, graph.HandlerStackDepth, 1)
+}
+
+func TestDot(t *testing.T) {
+	graph := Build(translate(t, `vector: word: handler
+start: ei
+loop: jnz loop
+  hlt
+handler: iret`))
+	assert.Equal(t, string(SerializeDot(graph)), `digraph cfg {
+  node [shape=box, fontname="monospace"];
+  entry [shape=point];
+  b0001 [label="start:\l0001  ei\l"];
+  b0002 [label="loop:\l0002  jnz loop\l"];
+  b0003 [label="0003  hlt\l"];
+  b0004 [label="handler:\l0004  iret\l", style=filled, fillcolor=lightgrey];
+  entry -> b0001;
+  interrupt [shape=point];
+  interrupt -> b0004 [style=dashed];
+  b0001 -> b0002;
+  b0002 -> b0002 [label="jnz"];
+  b0002 -> b0003;
+}
+`)
+}
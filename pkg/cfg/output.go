@@ -0,0 +1,109 @@
+package cfg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// SerializeText lists blocks with their instructions and successors followed by findings
+func SerializeText(graph *Graph, findings []Finding) []byte {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("entry: %s\n", graph.Name(graph.Entry)))
+	if graph.Handler != NoHandler {
+		builder.WriteString(fmt.Sprintf("interrupt handler: %s\n", graph.Name(graph.Handler)))
+		builder.WriteString(fmt.Sprintf("stack depth: %d, handler %d, worst case %d\n",
+			graph.StackDepth, graph.HandlerStackDepth, graph.StackDepth+interruptFrame+graph.HandlerStackDepth))
+	} else {
+		builder.WriteString(fmt.Sprintf("stack depth: %d\n", graph.StackDepth))
+	}
+	for _, block := range graph.Blocks {
+		builder.WriteString("\n")
+		builder.WriteString(fmt.Sprintf("block %s", graph.Name(block.Start)))
+		if block.Handler {
+			builder.WriteString(" (handler)")
+		}
+		builder.WriteString("\n")
+		for _, instruction := range block.Instructions {
+			builder.WriteString(fmt.Sprintf("  %04X  %s\n", instruction.Index, graph.instructionText(instruction)))
+		}
+		successors := make([]string, 0, len(block.Successors))
+		for _, successor := range block.Successors {
+			successors = append(successors, graph.Name(successor))
+		}
+		if len(successors) > 0 {
+			builder.WriteString(fmt.Sprintf("  -> %s\n", strings.Join(successors, ", ")))
+		}
+	}
+	builder.WriteString(fmt.Sprintf("\n%d finding(s)\n", len(findings)))
+	for _, finding := range findings {
+		builder.WriteString(fmt.Sprintf("%04X: %s: %s\n", finding.Address, finding.Kind, finding.Message))
+	}
+	return []byte(builder.String())
+}
+
+// SerializeDot draws the graph in the Graphviz DOT language: `dot -Tsvg`. Blocks of the interrupt handler
+// are filled, conditional branches are labeled with their mnemonics.
+func SerializeDot(graph *Graph) []byte {
+	builder := strings.Builder{}
+	builder.WriteString("digraph cfg {\n")
+	builder.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	builder.WriteString("  entry [shape=point];\n")
+	for _, block := range graph.Blocks {
+		lines := make([]string, 0, len(block.Instructions)+1)
+		if label, ok := graph.labels[block.Start]; ok {
+			lines = append(lines, label+":")
+		}
+		for _, instruction := range block.Instructions {
+			lines = append(lines, fmt.Sprintf("%04X  %s", instruction.Index, graph.instructionText(instruction)))
+		}
+		style := ""
+		if block.Handler {
+			style = ", style=filled, fillcolor=lightgrey"
+		}
+		builder.WriteString(fmt.Sprintf("  %s [label=\"%s\\l\"%s];\n", nodeName(block.Start), dotEscape(strings.Join(lines, "\n")), style))
+	}
+	if _, ok := graph.Block(graph.Entry); ok {
+		builder.WriteString(fmt.Sprintf("  entry -> %s;\n", nodeName(graph.Entry)))
+	}
+	if _, ok := graph.Block(graph.Handler); ok {
+		builder.WriteString("  interrupt [shape=point];\n")
+		builder.WriteString(fmt.Sprintf("  interrupt -> %s [style=dashed];\n", nodeName(graph.Handler)))
+	}
+	for _, block := range graph.Blocks {
+		last := block.last()
+		for _, successor := range block.Successors {
+			attributes := ""
+			if last.Opcode.Type() == isa.OpcodeTypeBranch && last.Opcode != isa.OpcodeJmp && *last.Operand == successor {
+				attributes = fmt.Sprintf(" [label=\"%s\"]", strings.ToLower(last.Opcode.String()))
+			}
+			builder.WriteString(fmt.Sprintf("  %s -> %s%s;\n", nodeName(block.Start), nodeName(successor), attributes))
+		}
+	}
+	builder.WriteString("}\n")
+	return []byte(builder.String())
+}
+
+func nodeName(address int) string {
+	return fmt.Sprintf("b%04X", address)
+}
+
+func dotEscape(text string) string {
+	text = strings.ReplaceAll(text, "\\", "\\\\")
+	text = strings.ReplaceAll(text, "\"", "\\\"")
+	// lines are left-justified
+	return strings.ReplaceAll(text, "\n", "\\l")
+}
+
+func (g *Graph) instructionText(instruction isa.MachineCodeTerm) string {
+	text := strings.ToLower(instruction.Opcode.String())
+	if instruction.Operand == nil {
+		return text
+	}
+	operand := g.Name(*instruction.Operand)
+	if instruction.OperandType == isa.ValueTypeAddressIndirect {
+		operand = "(" + operand + ")"
+	}
+	return text + " " + operand
+}
@@ -0,0 +1,250 @@
+package cfg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// interruptFrame is the number of words the control unit pushes on interrupt: IP and PS
+const interruptFrame = 2
+
+// stackState is the state of a path: the stack depth relative to the entry and what happened to AC of the
+// interrupted code, it's tracked for the interrupt handler only
+type stackState struct {
+	depth int
+	// saved is the depth where the original AC is pushed, -1 if it isn't
+	saved int
+	// changed is the address of the instruction which changed AC first, -1 while AC is original
+	changed int
+}
+
+type stackItem struct {
+	block *Block
+	state stackState
+}
+
+type stackWalk struct {
+	graph    *Graph
+	handler  bool
+	maxDepth int
+	depths   map[int]int
+	findings []Finding
+	reported map[string]bool
+	// exits are addresses of instructions which changed AC before the handler returned
+	exits []int
+}
+
+// checkStack finds the worst-case stack depth of the program and of the interrupt handler, paths which leave
+// values on the stack or pop from the empty one, and handlers which return with AC changed while the
+// interrupted code still needs it. PS with flags is saved by the control unit on interrupt, so flags are safe.
+func (g *Graph) checkStack() []Finding {
+	main := g.walkStack(g.Entry, false)
+	g.StackDepth = main.maxDepth
+	findings := main.findings
+	if _, ok := g.Block(g.Handler); !ok {
+		return findings
+	}
+	handler := g.walkStack(g.Handler, true)
+	g.HandlerStackDepth = handler.maxDepth
+	findings = append(findings, handler.findings...)
+	live, ok := g.liveAccumulator()
+	if !ok {
+		return findings
+	}
+	for _, changed := range handler.exits {
+		findings = append(findings, Finding{
+			Kind:    FindingClobberedAC,
+			Address: changed,
+			Message: fmt.Sprintf("interrupt handler at %s returns with AC changed by '%s' at %s, AC is used after '%s' at %s where interrupts are enabled",
+				g.Name(g.Handler), g.mnemonic(changed), g.Name(changed), g.mnemonic(live), g.Name(live)),
+		})
+	}
+	return findings
+}
+
+func (g *Graph) walkStack(entry int, handler bool) *stackWalk {
+	walk := &stackWalk{graph: g, handler: handler, depths: make(map[int]int), reported: make(map[string]bool)}
+	first, ok := g.Block(entry)
+	if !ok {
+		return walk
+	}
+	pending := []stackItem{{block: first, state: stackState{saved: -1, changed: -1}}}
+	visited := make(map[stackItem]bool)
+	for len(pending) > 0 {
+		item := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		block := item.block
+		if depth, ok := walk.depths[block.Start]; ok && depth != item.state.depth {
+			walk.report(FindingStackImbalance, block.Start, fmt.Sprintf("stack depth at %s is %d or %d depending on the path",
+				g.Name(block.Start), min(depth, item.state.depth), max(depth, item.state.depth)))
+			continue
+		}
+		walk.depths[block.Start] = item.state.depth
+		if visited[item] {
+			continue
+		}
+		visited[item] = true
+		state := item.state
+		for _, instruction := range block.Instructions {
+			state = walk.step(state, instruction)
+		}
+		for _, successor := range block.Successors {
+			next, _ := g.Block(successor)
+			pending = append(pending, stackItem{block: next, state: state})
+		}
+	}
+	slices.Sort(walk.exits)
+	walk.exits = slices.Compact(walk.exits)
+	return walk
+}
+
+func (w *stackWalk) step(state stackState, instruction isa.MachineCodeTerm) stackState {
+	address := instruction.Index
+	switch opcode := instruction.Opcode; {
+	case opcode == isa.OpcodePush:
+		if state.changed == -1 && state.saved == -1 {
+			state.saved = state.depth
+		}
+		state.depth++
+		w.maxDepth = max(w.maxDepth, state.depth)
+	case opcode == isa.OpcodePop:
+		if state.depth == 0 {
+			w.report(FindingStackUnderflow, address, fmt.Sprintf("'pop' at %s with the empty stack", w.graph.Name(address)))
+			if state.changed == -1 {
+				state.changed = address
+			}
+			break
+		}
+		state.depth--
+		if state.depth == state.saved {
+			state.saved, state.changed = -1, -1
+		} else if state.changed == -1 {
+			state.changed = address
+		}
+	case opcode == isa.OpcodeHlt || opcode == isa.OpcodeIret:
+		if state.depth != 0 {
+			w.report(FindingStackImbalance, address, fmt.Sprintf("%d value(s) left on the stack at '%s' at %s",
+				state.depth, strings.ToLower(opcode.String()), w.graph.Name(address)))
+		}
+		if w.handler && state.changed != -1 {
+			w.exits = append(w.exits, state.changed)
+		}
+	case writesAccumulator(opcode) && state.changed == -1:
+		state.changed = address
+	}
+	return state
+}
+
+func (w *stackWalk) report(kind FindingKind, address int, message string) {
+	key := fmt.Sprintf("%s:%d", kind, address)
+	if w.reported[key] {
+		return
+	}
+	w.reported[key] = true
+	w.findings = append(w.findings, Finding{Kind: kind, Address: address, Message: message})
+}
+
+func writesAccumulator(opcode isa.Opcode) bool {
+	switch opcode {
+	case isa.OpcodeAdd, isa.OpcodeSub, isa.OpcodeMod, isa.OpcodeInc, isa.OpcodeDec, isa.OpcodeLoad, isa.OpcodeIn, isa.OpcodePop, isa.OpcodeCla:
+		return true
+	}
+	return false
+}
+
+func readsAccumulator(opcode isa.Opcode) bool {
+	switch opcode {
+	case isa.OpcodeAdd, isa.OpcodeSub, isa.OpcodeCmp, isa.OpcodeMod, isa.OpcodeInc, isa.OpcodeDec, isa.OpcodeStore, isa.OpcodeOut, isa.OpcodePush:
+		return true
+	}
+	return false
+}
+
+// liveAccumulator finds an instruction of the program after which interrupts may be enabled and the value
+// of AC is used later. Interrupts are enabled by `ei` and disabled at start and by `di`.
+func (g *Graph) liveAccumulator() (int, bool) {
+	blocks := g.reachable(g.Entry)
+	enabledIn := make(map[int]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, block := range blocks {
+			enabled := enabledIn[block.Start]
+			for _, instruction := range block.Instructions {
+				enabled = enabled && instruction.Opcode != isa.OpcodeDi || instruction.Opcode == isa.OpcodeEi
+			}
+			for _, successor := range block.Successors {
+				if enabled && !enabledIn[successor] {
+					enabledIn[successor], changed = true, true
+				}
+			}
+		}
+	}
+
+	liveIn := make(map[int]bool)
+	liveAfter := make(map[int]bool)
+	for changed := true; changed; {
+		changed = false
+		for i := len(blocks) - 1; i >= 0; i-- {
+			block := blocks[i]
+			live := false
+			for _, successor := range block.Successors {
+				live = live || liveIn[successor]
+			}
+			for j := len(block.Instructions) - 1; j >= 0; j-- {
+				instruction := block.Instructions[j]
+				liveAfter[instruction.Index] = live
+				opcode := instruction.Opcode
+				live = readsAccumulator(opcode) || live && !writesAccumulator(opcode)
+			}
+			if live != liveIn[block.Start] {
+				liveIn[block.Start], changed = live, true
+			}
+		}
+	}
+
+	for _, block := range blocks {
+		enabled := enabledIn[block.Start]
+		for _, instruction := range block.Instructions {
+			enabled = enabled && instruction.Opcode != isa.OpcodeDi || instruction.Opcode == isa.OpcodeEi
+			if enabled && liveAfter[instruction.Index] {
+				return instruction.Index, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// reachable lists blocks reachable from the address ordered by addresses
+func (g *Graph) reachable(address int) []*Block {
+	seen := make(map[int]bool)
+	pending := []int{address}
+	for len(pending) > 0 {
+		start := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		block, ok := g.Block(start)
+		if !ok || seen[start] {
+			continue
+		}
+		seen[start] = true
+		pending = append(pending, block.Successors...)
+	}
+	blocks := make([]*Block, 0, len(seen))
+	for _, block := range g.Blocks {
+		if seen[block.Start] {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+func (g *Graph) mnemonic(address int) string {
+	for _, block := range g.Blocks {
+		if address >= block.Start && address <= block.End() {
+			return strings.ToLower(block.Instructions[address-block.Start].Opcode.String())
+		}
+	}
+	return ""
+}
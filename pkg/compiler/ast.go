@@ -0,0 +1,198 @@
+package compiler
+
+// program is a parsed source: global variables and functions in the order of declaration
+type program struct {
+	globals   []*varStatement
+	functions []*function
+}
+
+type function struct {
+	name       string
+	parameters []string
+	body       []statement
+	position   Position
+}
+
+type statement interface {
+	statement()
+}
+
+// varStatement declares a variable, global variables are initialized with constants
+type varStatement struct {
+	name     string
+	value    expression
+	position Position
+}
+
+type assignStatement struct {
+	name     string
+	value    expression
+	position Position
+}
+
+type ifStatement struct {
+	condition expression
+	then      []statement
+	otherwise []statement
+}
+
+type whileStatement struct {
+	condition expression
+	body      []statement
+}
+
+type returnStatement struct {
+	value    expression
+	position Position
+}
+
+type breakStatement struct {
+	position Position
+}
+
+type continueStatement struct {
+	position Position
+}
+
+// printStatement prints numbers in decimal and string literals as text
+type printStatement struct {
+	arguments []expression
+}
+
+// putcStatement prints the character with the code
+type putcStatement struct {
+	value expression
+}
+
+type expressionStatement struct {
+	value expression
+}
+
+func (*varStatement) statement()        {}
+func (*assignStatement) statement()     {}
+func (*ifStatement) statement()         {}
+func (*whileStatement) statement()      {}
+func (*returnStatement) statement()     {}
+func (*breakStatement) statement()      {}
+func (*continueStatement) statement()   {}
+func (*printStatement) statement()      {}
+func (*putcStatement) statement()       {}
+func (*expressionStatement) statement() {}
+
+type expression interface {
+	expression()
+}
+
+type numberLiteral int
+
+// stringLiteral is allowed only as an argument of print
+type stringLiteral struct {
+	value    string
+	position Position
+}
+
+type variable struct {
+	name     string
+	position Position
+}
+
+type call struct {
+	name      string
+	arguments []expression
+	position  Position
+}
+
+// readCall waits for the next character of the input and returns its code
+type readCall struct{}
+
+type unary struct {
+	operator string
+	operand  expression
+}
+
+type binary struct {
+	operator    string
+	left, right expression
+}
+
+func (numberLiteral) expression()  {}
+func (*stringLiteral) expression() {}
+func (*variable) expression()      {}
+func (*call) expression()          {}
+func (readCall) expression()       {}
+func (*unary) expression()         {}
+func (*binary) expression()        {}
+
+// localDeclarations lists `var` statements of the body including nested blocks
+func localDeclarations(body []statement) []*varStatement {
+	declarations := make([]*varStatement, 0)
+	walkStatements(body, func(s statement) {
+		if declaration, ok := s.(*varStatement); ok {
+			declarations = append(declarations, declaration)
+		}
+	}, func(expression) {})
+	return declarations
+}
+
+// calledFunctions lists functions called by the body, multiplication and division are calls of the library
+func calledFunctions(body []statement) []string {
+	called := make([]string, 0)
+	walkStatements(body, func(statement) {}, func(e expression) {
+		switch e := e.(type) {
+		case *call:
+			called = append(called, e.name)
+		case *binary:
+			if name, ok := libraryFunctions[e.operator]; ok {
+				called = append(called, name)
+			}
+		}
+	})
+	return called
+}
+
+func walkStatements(body []statement, visitStatement func(statement), visitExpression func(expression)) {
+	for _, s := range body {
+		visitStatement(s)
+		switch s := s.(type) {
+		case *varStatement:
+			walkExpression(s.value, visitExpression)
+		case *assignStatement:
+			walkExpression(s.value, visitExpression)
+		case *ifStatement:
+			walkExpression(s.condition, visitExpression)
+			walkStatements(s.then, visitStatement, visitExpression)
+			walkStatements(s.otherwise, visitStatement, visitExpression)
+		case *whileStatement:
+			walkExpression(s.condition, visitExpression)
+			walkStatements(s.body, visitStatement, visitExpression)
+		case *returnStatement:
+			walkExpression(s.value, visitExpression)
+		case *printStatement:
+			for _, argument := range s.arguments {
+				walkExpression(argument, visitExpression)
+			}
+		case *putcStatement:
+			walkExpression(s.value, visitExpression)
+		case *expressionStatement:
+			walkExpression(s.value, visitExpression)
+		}
+	}
+}
+
+func walkExpression(e expression, visit func(expression)) {
+	if e == nil {
+		return
+	}
+	visit(e)
+	switch e := e.(type) {
+	case *call:
+		for _, argument := range e.arguments {
+			walkExpression(argument, visit)
+		}
+	case *unary:
+		walkExpression(e.operand, visit)
+	case *binary:
+		walkExpression(e.left, visit)
+		walkExpression(e.right, visit)
+	}
+}
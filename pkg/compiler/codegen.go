@@ -0,0 +1,776 @@
+package compiler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// line is an instruction, a directive or a comment of the generated code
+type line struct {
+	label     string
+	opcode    string
+	operand   string
+	directive bool
+}
+
+// dataWord is a word placed after the code of a function, the reference is a label added to the value
+type dataWord struct {
+	label     string
+	value     string
+	reference string
+}
+
+type loop struct {
+	start, end string
+}
+
+// functionContext is the state of the function being generated. Variables are static words, so a call which may
+// reenter the callee saves the words of its frame on the stack.
+type functionContext struct {
+	function *function
+	locals   map[string]bool
+	data     []dataWord
+	loops    []loop
+	// returns is set when a return statement jumps to the epilogue
+	returns bool
+}
+
+type generator struct {
+	program   *program
+	functions map[string]*function
+	globals   map[string]bool
+	calls     map[string][]string
+	// used marks runtime words and routines referenced by the code
+	used    map[string]bool
+	lines   []line
+	pending []string
+	aliases map[string]string
+	current *functionContext
+	labels  int
+	// generated are labels made by newLabel, they are unique in the program
+	generated map[string]bool
+
+	constants []int
+	strings   []string
+}
+
+func newGenerator(p *program) *generator {
+	g := &generator{
+		program:   p,
+		functions: make(map[string]*function),
+		globals:   make(map[string]bool),
+		calls:     make(map[string][]string),
+		used:      make(map[string]bool),
+		aliases:   make(map[string]string),
+		generated: make(map[string]bool),
+	}
+	for _, f := range p.functions {
+		g.functions[f.name] = f
+		g.calls[f.name] = calledFunctions(f.body)
+	}
+	return g
+}
+
+// reaches checks whether the function may call the target directly or through other functions
+func (g *generator) reaches(from string, target string) bool {
+	seen := make(map[string]bool)
+	pending := []string{from}
+	for len(pending) > 0 {
+		name := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, callee := range g.calls[name] {
+			if callee == target {
+				return true
+			}
+			if !seen[callee] {
+				seen[callee] = true
+				pending = append(pending, callee)
+			}
+		}
+	}
+	return false
+}
+
+func (g *generator) newLabel(kind string) string {
+	g.labels++
+	label := fmt.Sprintf(".%s%d", kind, g.labels)
+	g.generated[label] = true
+	return label
+}
+
+// place puts the label on the next instruction. Several labels of one instruction are merged into one, the entry
+// of the function or `.ret` of the epilogue is kept because only generated labels are unique.
+func (g *generator) place(label string) {
+	g.pending = append(g.pending, label)
+}
+
+func (g *generator) emit(opcode string, operand string) {
+	label := ""
+	if len(g.pending) > 0 {
+		label = g.pending[len(g.pending)-1]
+		for _, pending := range g.pending {
+			if !g.generated[pending] {
+				label = pending
+			}
+		}
+		for _, alias := range g.pending {
+			if alias != label {
+				g.aliases[alias] = label
+			}
+		}
+		g.pending = g.pending[:0]
+	}
+	g.lines = append(g.lines, line{label: label, opcode: opcode, operand: operand})
+}
+
+func (g *generator) directive(text string) {
+	g.lines = append(g.lines, line{opcode: text, directive: true})
+}
+
+func (g *generator) runtime(name string) string {
+	g.used[name] = true
+	return name
+}
+
+func constantLabel(value int) string {
+	if value < 0 {
+		return fmt.Sprintf("c_m%d", -value)
+	}
+	return fmt.Sprintf("c_%d", value)
+}
+
+func (g *generator) constant(value int) string {
+	if !slices.Contains(g.constants, value) {
+		g.constants = append(g.constants, value)
+	}
+	return constantLabel(value)
+}
+
+// resolve returns the operand of a variable: a word of the current function or a global word
+func (g *generator) resolve(name string, position Position) (string, error) {
+	if g.current.locals[name] {
+		return ".v_" + name, nil
+	}
+	if g.globals[name] {
+		return "v_" + name, nil
+	}
+	if _, ok := g.functions[name]; ok {
+		return "", errorAt(position, "function '%s' is used as a variable", name)
+	}
+	return "", errorAt(position, "undefined variable '%s'", name)
+}
+
+// addressable returns the operand of an expression which is already in memory, it's empty for other expressions
+func (g *generator) addressable(e expression) string {
+	switch e := e.(type) {
+	case numberLiteral:
+		return g.constant(int(e))
+	case *variable:
+		operand, err := g.resolve(e.name, e.position)
+		if err != nil {
+			return ""
+		}
+		return operand
+	}
+	return ""
+}
+
+func (g *generator) generate() (string, error) {
+	for _, global := range g.program.globals {
+		if g.globals[global.name] {
+			return "", errorAt(global.position, "variable '%s' is already declared", global.name)
+		}
+		if _, ok := global.value.(numberLiteral); global.value != nil && !ok {
+			return "", errorAt(global.position, "global variable '%s' must be initialized with a number", global.name)
+		}
+		g.globals[global.name] = true
+	}
+	declared := make(map[string]bool)
+	for _, f := range g.program.functions {
+		if declared[f.name] {
+			return "", errorAt(f.position, "function '%s' is already defined", f.name)
+		}
+		declared[f.name] = true
+		if g.globals[f.name] {
+			return "", errorAt(f.position, "function '%s' has the name of a global variable", f.name)
+		}
+	}
+	main, ok := g.functions["main"]
+	if !ok {
+		return "", errorAt(Position{Line: 1, Column: 1}, "function 'main' is not defined")
+	}
+	if len(main.parameters) > 0 {
+		return "", errorAt(main.position, "function 'main' must have no parameters")
+	}
+
+	functionsCode := make([]string, 0)
+	for _, f := range g.program.functions {
+		if strings.HasPrefix(f.name, "__") && !g.called(f.name) {
+			continue
+		}
+		code, err := g.function(f)
+		if err != nil {
+			return "", err
+		}
+		functionsCode = append(functionsCode, code)
+	}
+	return g.render(functionsCode), nil
+}
+
+// called checks whether a function of the source calls the library function
+func (g *generator) called(name string) bool {
+	for _, f := range g.program.functions {
+		if !strings.HasPrefix(f.name, "__") && g.reaches(f.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) isCalled(name string) bool {
+	for _, callees := range g.calls {
+		if slices.Contains(callees, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// function generates the code of the function followed by its variables, all of them are visible in the whole
+// function like parameters
+func (g *generator) function(f *function) (string, error) {
+	context := &functionContext{function: f, locals: make(map[string]bool)}
+	for _, parameter := range f.parameters {
+		if context.locals[parameter] {
+			return "", errorAt(f.position, "parameter '%s' of function '%s' is repeated", parameter, f.name)
+		}
+		context.locals[parameter] = true
+	}
+	for _, declaration := range localDeclarations(f.body) {
+		if context.locals[declaration.name] {
+			return "", errorAt(declaration.position, "variable '%s' is already declared in function '%s'", declaration.name, f.name)
+		}
+		context.locals[declaration.name] = true
+	}
+	g.current = context
+	g.lines = g.lines[:0]
+	g.aliases = make(map[string]string)
+
+	g.directive(fmt.Sprintf("; func %s(%s)", f.name, strings.Join(f.parameters, ", ")))
+	g.place("f_" + f.name)
+	for i, s := range f.body {
+		if err := g.statement(s, i == len(f.body)-1); err != nil {
+			return "", err
+		}
+	}
+	if len(f.body) == 0 || !isReturn(f.body[len(f.body)-1]) {
+		g.emit("cla", "")
+	}
+	g.epilogue()
+	for _, name := range frameOf(f) {
+		context.data = append(context.data, dataWord{label: ".v_" + name, value: "0"})
+	}
+	return g.renderFunction(), nil
+}
+
+// epilogue is the return jump, callers write `jmp <return address>` there. Without a call it stops the program.
+func (g *generator) epilogue() {
+	g.directive("writable")
+	if g.current.returns || g.isCalled(g.current.function.name) {
+		g.place(".ret")
+	}
+	g.emit("jmp", "rt_exit")
+	g.directive("endwritable")
+}
+
+func isReturn(s statement) bool {
+	_, ok := s.(*returnStatement)
+	return ok
+}
+
+func (g *generator) statements(statements []statement) error {
+	for _, s := range statements {
+		if err := g.statement(s, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statement generates the statement, last is set for the last statement of the function body
+func (g *generator) statement(s statement, last bool) error {
+	switch s := s.(type) {
+	case *varStatement:
+		if s.value == nil {
+			g.emit("cla", "")
+			g.emit("st", ".v_"+s.name)
+			return nil
+		}
+		if err := g.expression(s.value); err != nil {
+			return err
+		}
+		g.emit("st", ".v_"+s.name)
+	case *assignStatement:
+		operand, err := g.resolve(s.name, s.position)
+		if err != nil {
+			return err
+		}
+		if err := g.expression(s.value); err != nil {
+			return err
+		}
+		g.emit("st", operand)
+	case *ifStatement:
+		otherwise, end := g.newLabel("else"), g.newLabel("end")
+		if len(s.otherwise) == 0 {
+			otherwise = end
+		}
+		if err := g.branch(s.condition, otherwise, false); err != nil {
+			return err
+		}
+		if err := g.statements(s.then); err != nil {
+			return err
+		}
+		if len(s.otherwise) > 0 {
+			if len(s.then) == 0 || !isJump(s.then[len(s.then)-1]) {
+				g.emit("jmp", end)
+			}
+			g.place(otherwise)
+			if err := g.statements(s.otherwise); err != nil {
+				return err
+			}
+		}
+		g.place(end)
+	case *whileStatement:
+		l := loop{start: g.newLabel("while"), end: g.newLabel("done")}
+		g.place(l.start)
+		if err := g.branch(s.condition, l.end, false); err != nil {
+			return err
+		}
+		g.current.loops = append(g.current.loops, l)
+		if err := g.statements(s.body); err != nil {
+			return err
+		}
+		g.current.loops = g.current.loops[:len(g.current.loops)-1]
+		g.emit("jmp", l.start)
+		g.place(l.end)
+	case *returnStatement:
+		if s.value == nil {
+			g.emit("cla", "")
+		} else if err := g.expression(s.value); err != nil {
+			return err
+		}
+		if !last {
+			g.current.returns = true
+			g.emit("jmp", ".ret")
+		}
+	case *breakStatement:
+		if len(g.current.loops) == 0 {
+			return errorAt(s.position, "break outside of a loop")
+		}
+		g.emit("jmp", g.current.loops[len(g.current.loops)-1].end)
+	case *continueStatement:
+		if len(g.current.loops) == 0 {
+			return errorAt(s.position, "continue outside of a loop")
+		}
+		g.emit("jmp", g.current.loops[len(g.current.loops)-1].start)
+	case *printStatement:
+		for _, argument := range s.arguments {
+			if err := g.print(argument); err != nil {
+				return err
+			}
+		}
+	case *putcStatement:
+		if err := g.expression(s.value); err != nil {
+			return err
+		}
+		g.emit("out", g.runtime("rt_port_char"))
+	case *expressionStatement:
+		return g.expression(s.value)
+	}
+	return nil
+}
+
+func isJump(s statement) bool {
+	switch s.(type) {
+	case *returnStatement, *breakStatement, *continueStatement:
+		return true
+	}
+	return false
+}
+
+func (g *generator) print(argument expression) error {
+	text, ok := argument.(*stringLiteral)
+	if !ok {
+		if err := g.expression(argument); err != nil {
+			return err
+		}
+		g.emit("out", g.runtime("rt_port_number"))
+		return nil
+	}
+	switch len(text.value) {
+	case 0:
+	case 1:
+		g.emit("ld", g.constant(int(text.value[0])))
+		g.emit("out", g.runtime("rt_port_char"))
+	default:
+		g.strings = append(g.strings, text.value)
+		g.emit("ld", fmt.Sprintf("p_%d", len(g.strings)))
+		g.emit("st", g.runtime("rt_pointer"))
+		g.callRoutine(g.runtime("rt_puts"))
+	}
+	return nil
+}
+
+// callRoutine writes the return jump to the routine and jumps to it, the return address is the next instruction
+func (g *generator) callRoutine(name string) {
+	returnLabel := g.newLabel("call")
+	word := g.newLabel("return")
+	g.current.data = append(g.current.data, dataWord{label: word, value: "RT_JUMP + ", reference: returnLabel})
+	g.emit("ld", word)
+	g.emit("st", name+".ret")
+	g.emit("jmp", name)
+	g.place(returnLabel)
+}
+
+// expression leaves the value in AC, flags are set by the value
+func (g *generator) expression(e expression) error {
+	switch e := e.(type) {
+	case numberLiteral:
+		if e == 0 {
+			g.emit("cla", "")
+		} else {
+			g.emit("ld", g.constant(int(e)))
+		}
+	case *variable:
+		operand, err := g.resolve(e.name, e.position)
+		if err != nil {
+			return err
+		}
+		g.emit("ld", operand)
+	case *call:
+		return g.call(e)
+	case readCall:
+		g.used["rt_read"] = true
+		g.callRoutine("rt_read")
+	case *unary:
+		if e.operator == "!" {
+			return g.boolean(e)
+		}
+		if operand := g.addressable(e.operand); operand != "" {
+			g.emit("cla", "")
+			g.emit("sub", operand)
+			return nil
+		}
+		if err := g.expression(e.operand); err != nil {
+			return err
+		}
+		g.emit("st", g.runtime("rt_tmp"))
+		g.emit("cla", "")
+		g.emit("sub", "rt_tmp")
+	case *binary:
+		switch e.operator {
+		case "+", "-":
+			operand, err := g.operands(e.left, e.right)
+			if err != nil {
+				return err
+			}
+			g.emit(map[string]string{"+": "add", "-": "sub"}[e.operator], operand)
+		case "%":
+			return g.remainder(e)
+		case "*", "/":
+			return g.call(&call{name: libraryFunctions[e.operator], arguments: []expression{e.left, e.right}})
+		default:
+			return g.boolean(e)
+		}
+	}
+	return nil
+}
+
+// operands evaluates the left operand into AC and returns the operand of the right one. A computed right operand
+// is stored into a scratch word while the left one waits on the stack.
+func (g *generator) operands(left expression, right expression) (string, error) {
+	if err := g.expression(left); err != nil {
+		return "", err
+	}
+	if operand := g.addressable(right); operand != "" {
+		return operand, nil
+	}
+	g.emit("push", "")
+	if err := g.expression(right); err != nil {
+		return "", err
+	}
+	g.emit("st", g.runtime("rt_tmp"))
+	g.emit("pop", "")
+	return "rt_tmp", nil
+}
+
+// remainder has the sign of the dividend, the remainder of division by zero is the dividend
+func (g *generator) remainder(e *binary) error {
+	operand, err := g.operands(e.left, e.right)
+	if err != nil {
+		return err
+	}
+	if number, ok := e.right.(numberLiteral); ok && number != 0 {
+		g.emit("mod", operand)
+		return nil
+	}
+	zero, end := g.newLabel("zero"), g.newLabel("end")
+	g.emit("st", g.runtime("rt_dividend"))
+	g.emit("ld", operand)
+	g.emit("jz", zero)
+	g.emit("ld", "rt_dividend")
+	g.emit("mod", operand)
+	g.emit("jmp", end)
+	g.place(zero)
+	g.emit("ld", "rt_dividend")
+	g.place(end)
+	return nil
+}
+
+// boolean computes 1 or 0 for comparisons and logical operators
+func (g *generator) boolean(e expression) error {
+	otherwise, end := g.newLabel("false"), g.newLabel("end")
+	if err := g.branch(e, otherwise, false); err != nil {
+		return err
+	}
+	g.emit("ld", g.constant(1))
+	g.emit("jmp", end)
+	g.place(otherwise)
+	g.emit("cla", "")
+	g.place(end)
+	return nil
+}
+
+var negatedComparison = map[string]string{"<": ">=", ">=": "<", "==": "!=", "!=": "==", "<=": ">", ">": "<="}
+
+// branch jumps to the target if the truth of the condition is equal to when and falls through otherwise.
+// Comparisons are `cmp` of the operands followed by branches on the flags of the difference.
+func (g *generator) branch(condition expression, target string, when bool) error {
+	switch c := condition.(type) {
+	case numberLiteral:
+		if (c != 0) == when {
+			g.emit("jmp", target)
+		}
+		return nil
+	case *unary:
+		if c.operator == "!" {
+			return g.branch(c.operand, target, !when)
+		}
+	case *binary:
+		switch c.operator {
+		case "&&", "||":
+			// the right operand decides only if the left one doesn't
+			if (c.operator == "||") == when {
+				if err := g.branch(c.left, target, when); err != nil {
+					return err
+				}
+				return g.branch(c.right, target, when)
+			}
+			skip := g.newLabel("skip")
+			if err := g.branch(c.left, skip, !when); err != nil {
+				return err
+			}
+			if err := g.branch(c.right, target, when); err != nil {
+				return err
+			}
+			g.place(skip)
+			return nil
+		case "<", "<=", ">", ">=", "==", "!=":
+			operand, err := g.operands(c.left, c.right)
+			if err != nil {
+				return err
+			}
+			g.emit("cmp", operand)
+			operator := c.operator
+			if !when {
+				operator = negatedComparison[operator]
+			}
+			g.compareBranch(operator, target)
+			return nil
+		}
+	}
+	if err := g.expression(condition); err != nil {
+		return err
+	}
+	if when {
+		g.emit("jnz", target)
+	} else {
+		g.emit("jz", target)
+	}
+	return nil
+}
+
+func (g *generator) compareBranch(operator string, target string) {
+	switch operator {
+	case "<":
+		g.emit("jn", target)
+	case ">=":
+		g.emit("jnn", target)
+	case "==":
+		g.emit("jz", target)
+	case "!=":
+		g.emit("jnz", target)
+	case "<=":
+		g.emit("jn", target)
+		g.emit("jz", target)
+	case ">":
+		skip := g.newLabel("skip")
+		g.emit("jn", skip)
+		g.emit("jz", skip)
+		g.emit("jmp", target)
+		g.place(skip)
+	}
+}
+
+// call passes arguments in the words of the callee's parameters and writes the return jump of the callee.
+// If the callee may be active, it's a recursive call, the frame of the callee is saved on the stack before
+// and restored after the call.
+func (g *generator) call(c *call) error {
+	callee, ok := g.functions[c.name]
+	if !ok {
+		if g.current.locals[c.name] || g.globals[c.name] {
+			return errorAt(c.position, "variable '%s' is called as a function", c.name)
+		}
+		return errorAt(c.position, "undefined function '%s'", c.name)
+	}
+	if len(c.arguments) != len(callee.parameters) {
+		return errorAt(c.position, "function '%s' takes %d argument(s), got %d", c.name, len(callee.parameters), len(c.arguments))
+	}
+	entry := "f_" + callee.name
+	frame := []string{entry + ".ret"}
+	for _, name := range frameOf(callee) {
+		frame = append(frame, entry+".v_"+name)
+	}
+	recursive := g.reaches(callee.name, g.current.function.name)
+	if recursive {
+		for _, word := range frame {
+			g.emit("ld", word)
+			g.emit("push", "")
+		}
+	}
+	for i, argument := range c.arguments {
+		if err := g.expression(argument); err != nil {
+			return err
+		}
+		if i < len(c.arguments)-1 {
+			g.emit("push", "")
+		}
+	}
+	for i := len(c.arguments) - 1; i >= 0; i-- {
+		if i < len(c.arguments)-1 {
+			g.emit("pop", "")
+		}
+		g.emit("st", entry+".v_"+callee.parameters[i])
+	}
+	g.callRoutine(entry)
+	if recursive {
+		g.emit("st", g.runtime("rt_result"))
+		for i := len(frame) - 1; i >= 0; i-- {
+			g.emit("pop", "")
+			g.emit("st", frame[i])
+		}
+		g.emit("ld", "rt_result")
+	}
+	return nil
+}
+
+// frameOf lists parameters and locals of the function, it's the order of words after the code
+func frameOf(f *function) []string {
+	frame := slices.Clone(f.parameters)
+	for _, declaration := range localDeclarations(f.body) {
+		if !slices.Contains(frame, declaration.name) {
+			frame = append(frame, declaration.name)
+		}
+	}
+	return frame
+}
+
+func (g *generator) alias(label string) string {
+	if target, ok := g.aliases[label]; ok {
+		return target
+	}
+	return label
+}
+
+func (g *generator) renderFunction() string {
+	builder := strings.Builder{}
+	for _, l := range g.lines {
+		switch {
+		case strings.HasPrefix(l.opcode, ";"):
+			builder.WriteString(l.opcode + "\n")
+		case l.directive:
+			builder.WriteString("    " + l.opcode + "\n")
+		case l.label != "":
+			builder.WriteString(strings.TrimRight(fmt.Sprintf("%s: %s %s", l.label, l.opcode, g.alias(l.operand)), " ") + "\n")
+		default:
+			builder.WriteString(strings.TrimRight(fmt.Sprintf("    %s %s", l.opcode, g.alias(l.operand)), " ") + "\n")
+		}
+	}
+	for _, word := range g.current.data {
+		value := word.value
+		if word.reference != "" {
+			value += g.alias(word.reference)
+		}
+		builder.WriteString(fmt.Sprintf("%s: word: %s\n", word.label, value))
+	}
+	return builder.String()
+}
+
+// render places data at the start of memory: the interrupt vector must be the word 0
+func (g *generator) render(functionsCode []string) string {
+	builder := strings.Builder{}
+	jump, _ := isa.EncodeTerm(isa.MachineCodeTerm{Opcode: isa.OpcodeJmp, OperandType: isa.ValueTypeAddressDirect, Operand: new(int)})
+	builder.WriteString(fmt.Sprintf("RT_JUMP equ 0x%08X ; 'jmp 0', return addresses are added to it\n", jump))
+	if g.used["rt_read"] {
+		builder.WriteString("rt_vector: word: rt_interrupt\n")
+	}
+	for _, routine := range runtimeRoutines {
+		for _, word := range routine.requires {
+			g.used[word] = g.used[word] || g.used[routine.name]
+		}
+	}
+	for _, word := range runtimeWords {
+		if g.used[word.label] {
+			builder.WriteString(fmt.Sprintf("%s: word: %s\n", word.label, word.value))
+		}
+	}
+	for _, value := range g.constants {
+		builder.WriteString(fmt.Sprintf("%s: word: %d\n", constantLabel(value), value))
+	}
+	for i, text := range g.strings {
+		codes := make([]string, 0, len(text)+1)
+		for _, char := range []byte(text) {
+			codes = append(codes, fmt.Sprintf("%d", char))
+		}
+		codes = append(codes, "0")
+		builder.WriteString(fmt.Sprintf("s_%d: word: %s ; %q\n", i+1, strings.Join(codes, ", "), text))
+		builder.WriteString(fmt.Sprintf("p_%d: word: s_%d\n", i+1, i+1))
+	}
+	for _, global := range g.program.globals {
+		value := 0
+		if number, ok := global.value.(numberLiteral); ok {
+			value = int(number)
+		}
+		builder.WriteString(fmt.Sprintf("v_%s: word: %d\n", global.name, value))
+	}
+
+	builder.WriteString("\n")
+	if g.used["rt_read"] {
+		builder.WriteString("start: ei\n    jmp f_main\n")
+	} else {
+		builder.WriteString("start: jmp f_main\n")
+	}
+	builder.WriteString("rt_exit: hlt\n")
+	for _, code := range functionsCode {
+		builder.WriteString("\n" + code)
+	}
+	for _, routine := range runtimeRoutines {
+		if g.used[routine.name] {
+			builder.WriteString("\n" + routine.code)
+		}
+	}
+	return builder.String()
+}
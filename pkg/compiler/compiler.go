@@ -0,0 +1,35 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+)
+
+// Compile translates the source of the structured language into assembly accepted by the translator
+func Compile(source string) (string, error) {
+	parsed, err := parse(source, false)
+	if err != nil {
+		return "", err
+	}
+	runtime, err := parse(library, true)
+	if err != nil {
+		return "", fmt.Errorf("library: %w", err)
+	}
+	parsed.functions = append(parsed.functions, runtime.functions...)
+	return newGenerator(parsed).generate()
+}
+
+// CompileProgram compiles the source and translates the assembly into machine code
+func CompileProgram(source string, options translator.Options) (isa.Program, error) {
+	assembly, err := Compile(source)
+	if err != nil {
+		return isa.Program{}, err
+	}
+	program, err := translator.NewTranslatorWithOptions(options).Translate(assembly)
+	if err != nil {
+		return isa.Program{}, fmt.Errorf("generated assembly isn't translated: %w", err)
+	}
+	return program, nil
+}
@@ -0,0 +1,183 @@
+package compiler
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/machine"
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+	"gotest.tools/v3/assert"
+)
+
+func run(t *testing.T, source string, input string, optimize bool) string {
+	t.Helper()
+	program, err := CompileProgram(source, translator.Options{Optimize: optimize})
+	assert.NilError(t, err)
+	ioData := make([]isa.IoData, 0)
+	for i, char := range input {
+		ioData = append(ioData, isa.IoData{ArrivesAt: 10 * (i + 1), Char: string(char)})
+	}
+	output := bytes.NewBuffer([]byte{})
+	assert.NilError(t, machine.RunSimulation(machine.DefaultConfig(), ioData, program, output, io.Discard))
+	return output.String()
+}
+
+func TestPrograms(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		input  string
+		output string
+	}{
+		{"expressions", `
+var base = 10;
+func main() {
+    var x = 2 + 3 * 4 - -1;
+    print(x, " ", (base - x) * 3, " ", 100 / 7, " ", 100 % 7, "\n");
+    print(-7 / 2, " ", -7 % 2, " ", 7 / -2, " ", 5 / 0, " ", 5 % 0, "\n");
+    print(3 < 4, 4 < 3, 3 <= 3, 4 >= 5, 2 == 2, 2 != 2, !0, !7, "\n");
+}`, "", "15 -15 14 2\n-3 -1 -3 0 5\n10101010\n"},
+		{"recursion", `
+func fact(n) {
+    if (n <= 1) {
+        return 1;
+    }
+    return n * fact(n - 1);
+}
+func fib(n) {
+    if (n < 2) {
+        return n;
+    }
+    return fib(n - 1) + fib(n - 2);
+}
+func main() {
+    print(fact(10), " ", fib(12), "\n");
+}`, "", "3628800 144\n"},
+		{"mutual recursion", `
+func even(n) {
+    if (n == 0) {
+        return 1;
+    }
+    return odd(n - 1);
+}
+func odd(n) {
+    if (n == 0) {
+        return 0;
+    }
+    return even(n - 1);
+}
+func main() {
+    print(even(10), odd(10), even(7), odd(7));
+}`, "", "1001"},
+		{"nested calls", `
+func add(a, b) {
+    return a + b;
+}
+func twice(x) {
+    return add(x, x);
+}
+func main() {
+    print(add(add(1, 2), twice(add(3, 4))), " ", twice(twice(5)));
+}`, "", "17 20"},
+		{"loops", `
+func main() {
+    var i = 0;
+    while (1) {
+        i = i + 1;
+        if (i % 2 == 0) {
+            continue;
+        } else if (i > 9) {
+            break;
+        }
+        print(i);
+    }
+    putc(10);
+}`, "", "13579\n"},
+		{"short circuit", `
+var calls = 0;
+func check(value) {
+    calls = calls + 1;
+    return value;
+}
+func main() {
+    if (check(0) && check(1)) {
+        print("wrong");
+    }
+    if (check(1) || check(0)) {
+        print("or ");
+    }
+    var both = check(1) && check(2);
+    print(both, " ", calls);
+}`, "", "or 1 4"},
+		{"read", `
+func main() {
+    var c = read();
+    var count = 0;
+    while (c != '\n') {
+        if (c >= 'a' && c <= 'z') {
+            c = c - 'a' + 'A';
+        }
+        putc(c);
+        count = count + 1;
+        c = read();
+    }
+    print("\n", count, " characters\n");
+}`, "Hello!\n", "HELLO!\n6 characters\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, run(t, test.source, test.input, false), test.output)
+			assert.Equal(t, run(t, test.source, test.input, true), test.output)
+		})
+	}
+}
+
+// frames are saved on the stack only by calls which may reenter the callee
+func TestRecursiveCallsSaveFrames(t *testing.T) {
+	assembly, err := Compile(`
+func square(x) {
+    return x * x;
+}
+func countdown(n) {
+    if (n > 0) {
+        countdown(n - 1);
+    }
+    return square(n);
+}
+func main() {
+    print(countdown(3));
+}`)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(assembly, "    ld f_countdown.ret\n    push\n    ld f_countdown.v_n\n    push\n"))
+	assert.Assert(t, !strings.Contains(assembly, "ld f_square.ret"))
+	assert.Assert(t, !strings.Contains(assembly, "ld f___mul.ret"))
+	// the library is compiled only for used operators
+	assert.Assert(t, !strings.Contains(assembly, "f___div"))
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{"func main() { x = 1; }", "1:15: undefined variable 'x'"},
+		{"func main() { print(f(1)); }", "1:21: undefined function 'f'"},
+		{"func f(a) { return a; }\nfunc main() { f(1, 2); }", "2:15: function 'f' takes 1 argument(s), got 2"},
+		{"func main() { break; }", "1:15: break outside of a loop"},
+		{"func main() { var s = \"text\"; }", "1:23: string literals are allowed only as arguments of print"},
+		{"func main() { var a; var a; }", "1:26: variable 'a' is already declared in function 'main'"},
+		{"var g = 1 + 2;\nfunc main() {}", "1:5: global variable 'g' must be initialized with a number"},
+		{"func f() {}", "1:1: function 'main' is not defined"},
+		{"func main() { var __x; }", "1:19: identifier '__x' is reserved, names starting with '__' are used by the compiler"},
+		{"func main() { print(1) }", "1:24: expected ';', found '}'"},
+		{"func main() { print(\"open); }", "1:21: unterminated string literal"},
+		{"func main() { x = 1 # 2; }", "1:21: unexpected character '#'"},
+	}
+	for _, test := range tests {
+		_, err := Compile(test.source)
+		assert.Error(t, err, test.err, test.source)
+	}
+}
@@ -0,0 +1,232 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenKeyword
+	tokenNumber
+	tokenString
+	tokenPunctuation
+)
+
+var keywords = map[string]bool{
+	"var": true, "func": true, "if": true, "else": true, "while": true, "return": true,
+	"break": true, "continue": true, "print": true, "putc": true, "read": true,
+}
+
+// punctuation is ordered so that longer operators are matched first
+var punctuation = []string{"==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "=", "(", ")", "{", "}", ",", ";"}
+
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Error is a lexical, syntax or semantic error of the source at the position
+type Error struct {
+	Position Position
+	Message  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Position, e.Message)
+}
+
+func errorAt(position Position, format string, args ...any) *Error {
+	return &Error{Position: position, Message: fmt.Sprintf(format, args...)}
+}
+
+type token struct {
+	kind     tokenKind
+	text     string
+	value    int
+	position Position
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of file"
+	case tokenString:
+		return "string literal"
+	default:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+}
+
+type lexer struct {
+	input    string
+	offset   int
+	position Position
+}
+
+func tokenize(input string) ([]token, error) {
+	l := &lexer{input: input, position: Position{Line: 1, Column: 1}}
+	tokens := make([]token, 0)
+	for {
+		next, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, next)
+		if next.kind == tokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) advance(count int) {
+	for i := 0; i < count; i++ {
+		if l.input[l.offset] == '\n' {
+			l.position.Line++
+			l.position.Column = 1
+		} else {
+			l.position.Column++
+		}
+		l.offset++
+	}
+}
+
+func (l *lexer) skipSpaceAndComments() {
+	for l.offset < len(l.input) {
+		switch {
+		case strings.HasPrefix(l.input[l.offset:], "//"):
+			for l.offset < len(l.input) && l.input[l.offset] != '\n' {
+				l.advance(1)
+			}
+		case strings.ContainsRune(" \t\r\n", rune(l.input[l.offset])):
+			l.advance(1)
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipSpaceAndComments()
+	start := l.position
+	if l.offset >= len(l.input) {
+		return token{kind: tokenEOF, position: start}, nil
+	}
+	char := l.input[l.offset]
+	switch {
+	case isLetter(char):
+		end := l.offset
+		for end < len(l.input) && (isLetter(l.input[end]) || isDigit(l.input[end])) {
+			end++
+		}
+		text := l.input[l.offset:end]
+		l.advance(end - l.offset)
+		if keywords[text] {
+			return token{kind: tokenKeyword, text: text, position: start}, nil
+		}
+		return token{kind: tokenIdentifier, text: text, position: start}, nil
+	case isDigit(char):
+		end := l.offset
+		for end < len(l.input) && (isLetter(l.input[end]) || isDigit(l.input[end])) {
+			end++
+		}
+		text := l.input[l.offset:end]
+		l.advance(end - l.offset)
+		value, err := strconv.ParseInt(text, 0, 64)
+		if err != nil || value > 1<<31-1 {
+			return token{}, errorAt(start, "invalid number '%s'", text)
+		}
+		return token{kind: tokenNumber, text: text, value: int(value), position: start}, nil
+	case char == '\'':
+		value, length, err := l.character(start)
+		if err != nil {
+			return token{}, err
+		}
+		text := l.input[l.offset : l.offset+length]
+		l.advance(length)
+		return token{kind: tokenNumber, text: text, value: value, position: start}, nil
+	case char == '"':
+		return l.string(start)
+	}
+	for _, operator := range punctuation {
+		if strings.HasPrefix(l.input[l.offset:], operator) {
+			l.advance(len(operator))
+			return token{kind: tokenPunctuation, text: operator, position: start}, nil
+		}
+	}
+	return token{}, errorAt(start, "unexpected character '%c'", char)
+}
+
+// character reads a character literal like 'a' or '\n' and returns its code and length
+func (l *lexer) character(start Position) (int, int, error) {
+	rest := l.input[l.offset+1:]
+	if rest == "" || rest[0] == '\'' || rest[0] == '\n' {
+		return 0, 0, errorAt(start, "empty character literal")
+	}
+	value, length, ok := unescape(rest)
+	if !ok {
+		return 0, 0, errorAt(start, "unknown escape sequence in character literal")
+	}
+	if length >= len(rest) || rest[length] != '\'' {
+		return 0, 0, errorAt(start, "unterminated character literal")
+	}
+	return int(value), length + 2, nil
+}
+
+func (l *lexer) string(start Position) (token, error) {
+	builder := strings.Builder{}
+	i := l.offset + 1
+	for {
+		if i >= len(l.input) || l.input[i] == '\n' {
+			return token{}, errorAt(start, "unterminated string literal")
+		}
+		if l.input[i] == '"' {
+			break
+		}
+		value, length, ok := unescape(l.input[i:])
+		if !ok {
+			return token{}, errorAt(start, "unknown escape sequence in string literal")
+		}
+		builder.WriteByte(value)
+		i += length
+	}
+	l.advance(i + 1 - l.offset)
+	return token{kind: tokenString, text: builder.String(), position: start}, nil
+}
+
+// unescape reads a character which may be an escape sequence and returns it with the length of its source
+func unescape(input string) (byte, int, bool) {
+	if input[0] != '\\' {
+		return input[0], 1, true
+	}
+	if len(input) < 2 {
+		return 0, 0, false
+	}
+	switch input[1] {
+	case 'n':
+		return '\n', 2, true
+	case 't':
+		return '\t', 2, true
+	case '0':
+		return 0, 2, true
+	case '\\', '\'', '"':
+		return input[1], 2, true
+	}
+	return 0, 0, false
+}
+
+func isLetter(char byte) bool {
+	return char == '_' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z'
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
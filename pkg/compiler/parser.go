@@ -0,0 +1,337 @@
+package compiler
+
+import "strings"
+
+// precedence of binary operators, higher binds tighter
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+type parser struct {
+	tokens  []token
+	current int
+	// internal allows reserved names in the runtime library
+	internal bool
+}
+
+func parse(source string, internal bool) (*program, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, internal: internal}
+	result := &program{}
+	for !p.at(tokenEOF, "") {
+		switch {
+		case p.accept(tokenKeyword, "var"):
+			global, err := p.varStatement()
+			if err != nil {
+				return nil, err
+			}
+			result.globals = append(result.globals, global)
+		case p.accept(tokenKeyword, "func"):
+			f, err := p.function()
+			if err != nil {
+				return nil, err
+			}
+			result.functions = append(result.functions, f)
+		default:
+			return nil, p.unexpected("'var' or 'func'")
+		}
+	}
+	return result, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.current]
+}
+
+func (p *parser) at(kind tokenKind, text string) bool {
+	next := p.peek()
+	return next.kind == kind && (text == "" || next.text == text)
+}
+
+func (p *parser) accept(kind tokenKind, text string) bool {
+	if !p.at(kind, text) {
+		return false
+	}
+	p.current++
+	return true
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(tokenPunctuation, text) {
+		return p.unexpected("'" + text + "'")
+	}
+	return nil
+}
+
+func (p *parser) identifier() (token, error) {
+	next := p.peek()
+	if next.kind != tokenIdentifier {
+		return token{}, p.unexpected("identifier")
+	}
+	if strings.HasPrefix(next.text, "__") && !p.internal {
+		return token{}, errorAt(next.position, "identifier '%s' is reserved, names starting with '__' are used by the compiler", next.text)
+	}
+	p.current++
+	return next, nil
+}
+
+func (p *parser) unexpected(expected string) error {
+	return errorAt(p.peek().position, "expected %s, found %s", expected, p.peek())
+}
+
+func (p *parser) function() (*function, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	f := &function{name: name.text, position: name.position}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.accept(tokenPunctuation, ")") {
+		if len(f.parameters) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		parameter, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		f.parameters = append(f.parameters, parameter.text)
+	}
+	f.body, err = p.block()
+	return f, err
+}
+
+func (p *parser) block() ([]statement, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	statements := make([]statement, 0)
+	for !p.accept(tokenPunctuation, "}") {
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, s)
+	}
+	return statements, nil
+}
+
+func (p *parser) statement() (statement, error) {
+	start := p.peek()
+	switch {
+	case p.accept(tokenKeyword, "var"):
+		return p.varStatement()
+	case p.accept(tokenKeyword, "if"):
+		return p.ifStatement()
+	case p.accept(tokenKeyword, "while"):
+		condition, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		body, err := p.block()
+		return &whileStatement{condition: condition, body: body}, err
+	case p.accept(tokenKeyword, "return"):
+		s := &returnStatement{position: start.position}
+		if !p.at(tokenPunctuation, ";") {
+			value, err := p.expression(0)
+			if err != nil {
+				return nil, err
+			}
+			s.value = value
+		}
+		return s, p.expect(";")
+	case p.accept(tokenKeyword, "break"):
+		return &breakStatement{position: start.position}, p.expect(";")
+	case p.accept(tokenKeyword, "continue"):
+		return &continueStatement{position: start.position}, p.expect(";")
+	case p.accept(tokenKeyword, "print"):
+		arguments, err := p.arguments(true)
+		if err != nil {
+			return nil, err
+		}
+		if len(arguments) == 0 {
+			return nil, errorAt(start.position, "print needs at least one argument")
+		}
+		return &printStatement{arguments: arguments}, p.expect(";")
+	case p.accept(tokenKeyword, "putc"):
+		arguments, err := p.arguments(false)
+		if err != nil {
+			return nil, err
+		}
+		if len(arguments) != 1 {
+			return nil, errorAt(start.position, "putc takes 1 argument, got %d", len(arguments))
+		}
+		return &putcStatement{value: arguments[0]}, p.expect(";")
+	case start.kind == tokenIdentifier && p.tokens[p.current+1].kind == tokenPunctuation && p.tokens[p.current+1].text == "=":
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		p.current++
+		value, err := p.expression(0)
+		if err != nil {
+			return nil, err
+		}
+		return &assignStatement{name: name.text, value: value, position: name.position}, p.expect(";")
+	}
+	value, err := p.expression(0)
+	if err != nil {
+		return nil, err
+	}
+	return &expressionStatement{value: value}, p.expect(";")
+}
+
+func (p *parser) varStatement() (*varStatement, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	s := &varStatement{name: name.text, position: name.position}
+	if p.accept(tokenPunctuation, "=") {
+		if s.value, err = p.expression(0); err != nil {
+			return nil, err
+		}
+	}
+	return s, p.expect(";")
+}
+
+func (p *parser) ifStatement() (*ifStatement, error) {
+	condition, err := p.condition()
+	if err != nil {
+		return nil, err
+	}
+	s := &ifStatement{condition: condition}
+	if s.then, err = p.block(); err != nil {
+		return nil, err
+	}
+	if !p.accept(tokenKeyword, "else") {
+		return s, nil
+	}
+	if p.accept(tokenKeyword, "if") {
+		nested, err := p.ifStatement()
+		s.otherwise = []statement{nested}
+		return s, err
+	}
+	s.otherwise, err = p.block()
+	return s, err
+}
+
+func (p *parser) condition() (expression, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	condition, err := p.expression(0)
+	if err != nil {
+		return nil, err
+	}
+	return condition, p.expect(")")
+}
+
+// arguments parses a parenthesized list of expressions, string literals are allowed for print only
+func (p *parser) arguments(allowStrings bool) ([]expression, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	arguments := make([]expression, 0)
+	for !p.accept(tokenPunctuation, ")") {
+		if len(arguments) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		if next := p.peek(); allowStrings && next.kind == tokenString {
+			p.current++
+			arguments = append(arguments, &stringLiteral{value: next.text, position: next.position})
+			continue
+		}
+		argument, err := p.expression(0)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, argument)
+	}
+	return arguments, nil
+}
+
+// expression parses binary operators which bind tighter than the level by precedence climbing
+func (p *parser) expression(level int) (expression, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		next := p.peek()
+		operatorLevel, ok := precedence[next.text]
+		if next.kind != tokenPunctuation || !ok || operatorLevel <= level {
+			return left, nil
+		}
+		p.current++
+		right, err := p.expression(operatorLevel)
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{operator: next.text, left: left, right: right}
+	}
+}
+
+func (p *parser) unary() (expression, error) {
+	next := p.peek()
+	if p.accept(tokenPunctuation, "-") || p.accept(tokenPunctuation, "!") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if number, ok := operand.(numberLiteral); ok && next.text == "-" {
+			return -number, nil
+		}
+		return &unary{operator: next.text, operand: operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (expression, error) {
+	next := p.peek()
+	switch {
+	case p.accept(tokenNumber, ""):
+		return numberLiteral(next.value), nil
+	case p.accept(tokenString, ""):
+		return nil, errorAt(next.position, "string literals are allowed only as arguments of print")
+	case p.accept(tokenKeyword, "read"):
+		arguments, err := p.arguments(false)
+		if err != nil {
+			return nil, err
+		}
+		if len(arguments) != 0 {
+			return nil, errorAt(next.position, "read takes no arguments, got %d", len(arguments))
+		}
+		return readCall{}, nil
+	case p.accept(tokenPunctuation, "("):
+		inner, err := p.expression(0)
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	case next.kind == tokenIdentifier:
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if !p.at(tokenPunctuation, "(") {
+			return &variable{name: name.text, position: name.position}, nil
+		}
+		arguments, err := p.arguments(false)
+		return &call{name: name.text, arguments: arguments, position: name.position}, err
+	}
+	return nil, p.unexpected("expression")
+}
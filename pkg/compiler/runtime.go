@@ -0,0 +1,133 @@
+package compiler
+
+// libraryFunctions implement operators which have no instructions, they are compiled from the library source
+// when a program uses them
+var libraryFunctions = map[string]string{"*": "__mul", "/": "__div"}
+
+// library computes products and quotients from the highest power of two, division truncates toward zero and
+// division by zero gives zero
+const library = `
+func __mul(a, b) {
+    if (b < 0) {
+        a = -a;
+        b = -b;
+    }
+    var product = 0;
+    while (b > 0) {
+        var term = a;
+        var count = 1;
+        while (count <= b - count) {
+            term = term + term;
+            count = count + count;
+        }
+        product = product + term;
+        b = b - count;
+    }
+    return product;
+}
+
+func __div(a, b) {
+    var negative = 0;
+    if (a < 0) {
+        a = -a;
+        negative = 1 - negative;
+    }
+    if (b < 0) {
+        b = -b;
+        negative = 1 - negative;
+    }
+    if (b == 0) {
+        return 0;
+    }
+    var quotient = 0;
+    while (b <= a) {
+        var term = b;
+        var count = 1;
+        while (term <= a - term) {
+            term = term + term;
+            count = count + count;
+        }
+        a = a - term;
+        quotient = quotient + count;
+    }
+    if (negative) {
+        return -quotient;
+    }
+    return quotient;
+}
+`
+
+type runtimeWord struct {
+	label string
+	value string
+}
+
+// runtimeWords are ports and scratch words, scratch words hold a value between two adjacent instructions
+var runtimeWords = []runtimeWord{
+	{"rt_port_char", "1"},
+	{"rt_port_number", "2"},
+	{"rt_tmp", "0"},
+	{"rt_dividend", "0"},
+	{"rt_result", "0"},
+	{"rt_pointer", "0"},
+}
+
+type runtimeRoutine struct {
+	name     string
+	requires []string
+	code     string
+}
+
+// runtimeRoutines are called like functions: the caller writes the return jump to `.ret`.
+// Characters arrive by interrupts into a ring buffer, `rt_read` waits until it isn't empty.
+var runtimeRoutines = []runtimeRoutine{
+	{name: "rt_puts", requires: []string{"rt_port_char", "rt_pointer"}, code: `; prints the string at rt_pointer
+rt_puts: ld (rt_pointer)
+    jz .ret
+    out rt_port_char
+    ld rt_pointer
+    inc
+    st rt_pointer
+    jmp rt_puts
+    writable
+.ret: jmp rt_exit
+    endwritable
+`},
+	{name: "rt_read", code: `; returns the next character of the input
+rt_read: ld rt_input_head
+    cmp rt_input_tail
+    jz rt_read
+    ld (rt_input_head)
+    st rt_char
+    ld rt_input_head
+    inc
+    cmp rt_input_end
+    jnz .next
+    ld rt_input_start
+.next: st rt_input_head
+    ld rt_char
+    writable
+.ret: jmp rt_exit
+    endwritable
+
+; stores the character into the ring buffer, AC of the interrupted code is kept on the stack
+rt_interrupt: push
+    in rt_port_input
+    st (rt_input_tail)
+    ld rt_input_tail
+    inc
+    cmp rt_input_end
+    jnz .next
+    ld rt_input_start
+.next: st rt_input_tail
+    pop
+    iret
+rt_port_input: word: 0
+rt_char: word: 0
+rt_input_head: word: rt_input_buffer
+rt_input_tail: word: rt_input_buffer
+rt_input_start: word: rt_input_buffer
+rt_input_end: word: rt_input_buffer + 32
+rt_input_buffer: res 32
+`},
+}
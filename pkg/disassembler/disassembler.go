@@ -0,0 +1,299 @@
+package disassembler
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+const startLabel = "start"
+
+type word struct {
+	term isa.MachineCodeTerm
+	// instruction is the word decoded as an instruction, it's set for words which are code
+	instruction *isa.MachineCodeTerm
+	label       string
+}
+
+type disassembler struct {
+	program   isa.Program
+	words     map[int]*word
+	addresses []int
+}
+
+// Disassemble reconstructs assembly which translates into the same memory. Instructions of programs stay code
+// and constants stay data. Memory images hold only numbers, so code is found by following branches from the start
+// address and from the interrupt vector. Labels of the program are kept, targets of operands get labels `l_XXXX`
+// for code and `d_XXXX` for data.
+func Disassemble(program isa.Program) []byte {
+	d := disassembler{program: program, words: make(map[int]*word)}
+	for _, term := range program.Instructions {
+		d.words[term.Index] = &word{term: term}
+		d.addresses = append(d.addresses, term.Index)
+	}
+	slices.Sort(d.addresses)
+
+	if slices.ContainsFunc(program.Instructions, func(term isa.MachineCodeTerm) bool { return !isa.IsConstant(term) }) {
+		d.markInstructions()
+	} else {
+		d.markReachable()
+	}
+	d.assignLabels()
+	return d.format()
+}
+
+func (d *disassembler) markInstructions() {
+	for _, w := range d.words {
+		if !isa.IsConstant(w.term) && expressible(w.term) {
+			instruction := w.term
+			w.instruction = &instruction
+		}
+	}
+}
+
+// markReachable walks the control flow of an image from the start address. Images skip zero words,
+// so a reachable address without a word holds `nop`.
+func (d *disassembler) markReachable() {
+	defer slices.Sort(d.addresses)
+	pending := []int{d.program.StartAddress}
+	vectorUsed := false
+	for len(pending) > 0 {
+		address := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, ok := d.words[address]; !ok && address >= 0 && address < isa.ImageSize {
+			zero := 0
+			d.words[address] = &word{term: isa.MachineCodeTerm{Index: address, Operand: &zero, OperandType: isa.ValueTypeNumber}}
+			d.addresses = append(d.addresses, address)
+		}
+		w, ok := d.words[address]
+		if !ok || w.instruction != nil {
+			continue
+		}
+		instruction, ok := decode(w.term)
+		if !ok {
+			continue
+		}
+		w.instruction = &instruction
+		opcode := instruction.Opcode
+		switch {
+		case opcode == isa.OpcodeJmp:
+			pending = append(pending, *instruction.Operand)
+		case opcode.Type() == isa.OpcodeTypeBranch:
+			pending = append(pending, *instruction.Operand, address+1)
+		case opcode == isa.OpcodeHlt || opcode == isa.OpcodeIret:
+		default:
+			pending = append(pending, address+1)
+		}
+		// the interrupt vector holds the address of the handler
+		if opcode == isa.OpcodeEi && !vectorUsed {
+			vectorUsed = true
+			if vector, ok := d.words[0]; ok && vector.instruction == nil && d.program.StartAddress != 0 {
+				vector.term.OperandType = isa.ValueTypeAddressDirect
+				pending = append(pending, *vector.term.Operand)
+			}
+		}
+	}
+}
+
+// decode reads an instruction from a word of an image, it fails for words which the translator can't produce
+func decode(term isa.MachineCodeTerm) (isa.MachineCodeTerm, bool) {
+	encoded, err := isa.EncodeTerm(term)
+	if err != nil {
+		return isa.MachineCodeTerm{}, false
+	}
+	instruction, err := isa.DecodeTerm(term.Index, isa.WordKindInstruction, encoded)
+	if err != nil || !expressible(instruction) {
+		return isa.MachineCodeTerm{}, false
+	}
+	if reencoded, err := isa.EncodeTerm(instruction); err != nil || reencoded != encoded {
+		return isa.MachineCodeTerm{}, false
+	}
+	instruction.Writable = term.Writable
+	return instruction, true
+}
+
+// expressible checks that the instruction has an operand the translator accepts for its opcode
+func expressible(term isa.MachineCodeTerm) bool {
+	switch term.Opcode.Type() {
+	case isa.OpcodeTypeAddressless:
+		return term.OperandType == isa.ValueTypeNone
+	case isa.OpcodeTypeAddress:
+		return term.OperandType == isa.ValueTypeAddressDirect || term.OperandType == isa.ValueTypeAddressIndirect
+	default:
+		return term.OperandType == isa.ValueTypeAddressDirect
+	}
+}
+
+func (d *disassembler) assignLabels() {
+	for _, w := range d.words {
+		if w.term.Label != nil && isValidLabel(*w.term.Label) {
+			w.label = *w.term.Label
+		}
+	}
+	if start, ok := d.words[d.program.StartAddress]; ok {
+		start.label = startLabel
+	}
+	for _, address := range d.addresses {
+		w := d.words[address]
+		if target, ok := d.operandTarget(w); ok {
+			d.labelWord(target)
+		}
+		// data lines start with a label
+		if previous, ok := d.words[address-1]; w.instruction == nil && (!ok || previous.instruction != nil || previous.term.Writable != w.term.Writable) {
+			d.labelWord(address)
+		}
+	}
+}
+
+func (d *disassembler) labelWord(address int) {
+	w, ok := d.words[address]
+	if !ok || w.label != "" {
+		return
+	}
+	prefix := "d"
+	if w.instruction != nil {
+		prefix = "l"
+	}
+	w.label = fmt.Sprintf("%s_%04x", prefix, address)
+}
+
+func (d *disassembler) operandTarget(w *word) (int, bool) {
+	switch {
+	case w.instruction != nil && w.instruction.Operand != nil:
+		return *w.instruction.Operand, true
+	case w.instruction == nil && w.term.OperandType == isa.ValueTypeAddressDirect && w.term.Operand != nil:
+		return *w.term.Operand, true
+	default:
+		return 0, false
+	}
+}
+
+// expansionLabel matches labels of macro expansions like `loop__2`, the translator reserves them
+var expansionLabel = regexp.MustCompile(`__[0-9]+$`)
+
+// isValidLabel rejects qualified anonymous labels like `1@2` and labels of macro expansions, they are replaced
+// with generated ones
+func isValidLabel(label string) bool {
+	if label == "" || strings.Contains(label, "@") || expansionLabel.MatchString(label) {
+		return false
+	}
+	first := label[0]
+	return first == '_' || first >= 'a' && first <= 'z' || first >= 'A' && first <= 'Z'
+}
+
+func (d *disassembler) format() []byte {
+	builder := strings.Builder{}
+	next, writable := 0, false
+	for i := 0; i < len(d.addresses); {
+		address := d.addresses[i]
+		w := d.words[address]
+		if address != next {
+			builder.WriteString(fmt.Sprintf("  org %d\n", address))
+		}
+		if w.term.Writable && !writable {
+			builder.WriteString("  writable\n")
+		} else if !w.term.Writable && writable {
+			builder.WriteString("  endwritable\n")
+		}
+		writable = w.term.Writable
+		if w.instruction != nil {
+			builder.WriteString(d.formatInstruction(w))
+			next, i = address+1, i+1
+			continue
+		}
+		run := d.dataRun(i)
+		builder.WriteString(fmt.Sprintf("%s: word: %s\n", w.label, strings.Join(d.formatData(run), ", ")))
+		next, i = address+len(run), i+len(run)
+	}
+	if writable {
+		builder.WriteString("  endwritable\n")
+	}
+	return []byte(builder.String())
+}
+
+func (d *disassembler) formatInstruction(w *word) string {
+	line := "  "
+	if w.label != "" {
+		line = w.label + ": "
+	}
+	line += strings.ToLower(w.instruction.Opcode.String())
+	if w.instruction.Operand != nil {
+		operand := d.addressName(*w.instruction.Operand)
+		if w.instruction.OperandType == isa.ValueTypeAddressIndirect {
+			operand = "(" + operand + ")"
+		}
+		line += " " + operand
+	}
+	return line + "\n"
+}
+
+// dataRun collects consecutive data words starting at the position, they share the label of the first word
+func (d *disassembler) dataRun(position int) []*word {
+	first := d.words[d.addresses[position]]
+	run := []*word{first}
+	for i := position + 1; i < len(d.addresses); i++ {
+		w := d.words[d.addresses[i]]
+		if d.addresses[i] != d.addresses[i-1]+1 || w.instruction != nil || w.label != "" || w.term.Writable != first.term.Writable {
+			break
+		}
+		run = append(run, w)
+	}
+	return run
+}
+
+// formatData turns characters ending with zero back into strings
+func (d *disassembler) formatData(run []*word) []string {
+	elements := make([]string, 0, len(run))
+	for i := 0; i < len(run); i++ {
+		if end := stringEnd(run, i); end > i {
+			text := make([]byte, 0, end-i)
+			for _, w := range run[i:end] {
+				text = append(text, byte(*w.term.Operand))
+			}
+			elements = append(elements, fmt.Sprintf("'%s'", text))
+			i = end
+			continue
+		}
+		elements = append(elements, d.formatConstant(run[i].term))
+	}
+	return elements
+}
+
+// stringEnd returns the position of the terminating zero of a string starting at the position, or the position itself
+func stringEnd(run []*word, position int) int {
+	for i := position; i < len(run); i++ {
+		term := run[i].term
+		if term.OperandType != isa.ValueTypeChar || term.Operand == nil {
+			return position
+		}
+		char := *term.Operand
+		if char == 0 {
+			return i
+		}
+		if char < ' ' || char > '~' || char == '\'' || char == ';' {
+			return position
+		}
+	}
+	return position
+}
+
+func (d *disassembler) formatConstant(term isa.MachineCodeTerm) string {
+	value := 0
+	if term.Operand != nil {
+		value = *term.Operand
+	}
+	if term.OperandType == isa.ValueTypeAddressDirect {
+		return d.addressName(value)
+	}
+	return fmt.Sprint(value)
+}
+
+func (d *disassembler) addressName(address int) string {
+	if w, ok := d.words[address]; ok && w.label != "" {
+		return w.label
+	}
+	return fmt.Sprint(address)
+}
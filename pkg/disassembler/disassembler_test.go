@@ -0,0 +1,94 @@
+package disassembler
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+	"gotest.tools/v3/assert"
+)
+
+const program = `vector: word: handler
+message: word: 'Hi', 64
+out_port: word: 1
+  org 10
+start: ei
+1: ld (pointer)
+  jz 1f
+  out out_port
+  jmp 1b
+1: hlt
+handler: iret
+pointer: word: message`
+
+func translate(t *testing.T, source string, options translator.Options) isa.Program {
+	t.Helper()
+	program, err := translator.NewTranslatorWithOptions(options).Translate(source)
+	assert.NilError(t, err, source)
+	return program
+}
+
+func image(t *testing.T, program isa.Program) []byte {
+	t.Helper()
+	output, err := isa.SerializeImage(program)
+	assert.NilError(t, err)
+	return output
+}
+
+func TestDisassembleProgram(t *testing.T) {
+	assert.Equal(t, string(Disassemble(translate(t, program, translator.Options{}))), `vector: word: handler
+message: word: 'Hi', 64
+out_port: word: 1
+  org 10
+start: ei
+l_000b: ld (pointer)
+  jz l_000f
+  out out_port
+  jmp l_000b
+l_000f: hlt
+handler: iret
+pointer: word: message
+`)
+}
+
+func TestDisassembleImage(t *testing.T) {
+	memory, err := isa.ReadImage(bytes.NewReader(image(t, translate(t, program, translator.Options{}))))
+	assert.NilError(t, err)
+	assert.Equal(t, string(Disassemble(memory)), `d_0000: word: l_0010, 72, 105
+  org 4
+d_0004: word: 64
+d_0005: word: 1
+  org 10
+start: ei
+l_000b: ld (d_0011)
+  jz l_000f
+  out d_0005
+  jmp l_000b
+l_000f: hlt
+l_0010: iret
+d_0011: word: 1
+`)
+}
+
+func TestRoundTripThroughTranslator(t *testing.T) {
+	files, err := filepath.Glob("../../tests/assembly/*.asm")
+	assert.NilError(t, err)
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			source, err := os.ReadFile(file)
+			assert.NilError(t, err)
+			original := translate(t, string(source), translator.Options{FileName: file})
+
+			fromProgram := translate(t, string(Disassemble(original)), translator.Options{})
+			assert.DeepEqual(t, image(t, fromProgram), image(t, original))
+
+			memory, err := isa.ReadImage(bytes.NewReader(image(t, original)))
+			assert.NilError(t, err)
+			fromImage := translate(t, string(Disassemble(memory)), translator.Options{})
+			assert.DeepEqual(t, image(t, fromImage), image(t, original))
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package isa
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Instruction word layout:
+//
+//	31      24 23  21 20       11 10        0
+//	| opcode  | mode |  unused    |  address  |
+//
+// mode is the ValueType of the operand. Constants occupy the whole word as a signed 32-bit value.
+const (
+	opcodeShift = 24
+	opcodeMask  = 0xFF
+	modeShift   = 21
+	modeMask    = 0b111
+	addressMask = AddrMaxValue
+)
+
+var binaryMagic = []byte("GMC1")
+
+// WordKind tells whether a word of the binary format is an instruction or a constant.
+// For constants it's the ValueType of the constant. The highest bit marks writable code.
+type WordKind uint8
+
+const (
+	WordKindInstruction WordKind = 0
+	WordKindWritable    WordKind = 0x80
+)
+
+func IsConstant(term MachineCodeTerm) bool {
+	return term.Opcode == OpcodeNop && term.OperandType != ValueTypeNone
+}
+
+func EncodeTerm(term MachineCodeTerm) (uint32, error) {
+	operand := 0
+	if term.Operand != nil {
+		operand = *term.Operand
+	}
+	if IsConstant(term) {
+		if operand < WordMinValue || operand > WordMaxValue {
+			return 0, fmt.Errorf("constant %d at %d doesn't fit in %d bits", operand, term.Index, WordWidth)
+		}
+		return uint32(int32(operand)), nil
+	}
+	if term.Opcode.Type() == OpcodeTypeAddress && term.Operand == nil {
+		return 0, fmt.Errorf("address instruction without operand at %d: %s", term.Index, term.Opcode)
+	}
+	if operand < 0 || operand > AddrMaxValue {
+		return 0, fmt.Errorf("operand %d of %s at %d doesn't fit in %d bits", operand, term.Opcode, term.Index, AddrWidth)
+	}
+	return uint32(term.Opcode)<<opcodeShift | uint32(term.OperandType)<<modeShift | uint32(operand), nil
+}
+
+func DecodeInstruction(word uint32) (Opcode, ValueType, int, error) {
+	opcode := Opcode(word >> opcodeShift & opcodeMask)
+	if _, ok := opcodeToInfo[opcode]; !ok {
+		return OpcodeNop, ValueTypeNone, 0, fmt.Errorf("unknown opcode: %d", opcode)
+	}
+	mode := ValueType(word >> modeShift & modeMask)
+	if mode > ValueTypeAddressIndirect {
+		return OpcodeNop, ValueTypeNone, 0, fmt.Errorf("unknown addressing mode: %d", mode)
+	}
+	return opcode, mode, int(word & addressMask), nil
+}
+
+func DecodeTerm(index int, kind WordKind, word uint32) (MachineCodeTerm, error) {
+	term := MachineCodeTerm{Index: index, Writable: kind&WordKindWritable != 0}
+	kind &^= WordKindWritable
+	if kind != WordKindInstruction {
+		value := int(int32(word))
+		term.Opcode = OpcodeNop
+		term.Operand = &value
+		term.OperandType = ValueType(kind)
+		return term, nil
+	}
+	opcode, mode, address, err := DecodeInstruction(word)
+	if err != nil {
+		return MachineCodeTerm{}, fmt.Errorf("word %08X at %d: %w", word, index, err)
+	}
+	term.Opcode = opcode
+	term.OperandType = mode
+	if mode != ValueTypeNone {
+		term.Operand = &address
+	}
+	return term, nil
+}
+
+func wordKind(term MachineCodeTerm) WordKind {
+	kind := WordKindInstruction
+	if IsConstant(term) {
+		kind = WordKind(term.OperandType)
+	}
+	if term.Writable {
+		kind |= WordKindWritable
+	}
+	return kind
+}
+
+// SerializeBinary writes the program in the binary format:
+//
+//	"GMC1" | start: u32 | n: u32 | n * (address: u16, kind: u8, word: u32) | m: u32 | m * (address: u16, len: u8, label)
+//
+// All numbers are little-endian. Labels are kept as debug info, source lines are not.
+func SerializeBinary(program Program) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+	buffer.Write(binaryMagic)
+	write := func(data any) {
+		_ = binary.Write(buffer, binary.LittleEndian, data)
+	}
+
+	write(uint32(program.StartAddress))
+	write(uint32(len(program.Instructions)))
+	labels := make([]MachineCodeTerm, 0)
+	for _, term := range program.Instructions {
+		word, err := EncodeTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		write(uint16(term.Index))
+		write(wordKind(term))
+		write(word)
+		if term.Label != nil {
+			labels = append(labels, term)
+		}
+	}
+
+	write(uint32(len(labels)))
+	for _, term := range labels {
+		if len(*term.Label) > 0xFF {
+			return nil, fmt.Errorf("label is too long: %s", *term.Label)
+		}
+		write(uint16(term.Index))
+		write(uint8(len(*term.Label)))
+		buffer.WriteString(*term.Label)
+	}
+	return buffer.Bytes(), nil
+}
+
+func ReadBinary(input io.Reader) (Program, error) {
+	reader := bufio.NewReader(input)
+	magic := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || !bytes.Equal(magic, binaryMagic) {
+		return Program{}, errors.New("not a binary program: bad magic")
+	}
+
+	var err error
+	read := func(data any) {
+		if err == nil {
+			err = binary.Read(reader, binary.LittleEndian, data)
+		}
+	}
+	var startAddress, count uint32
+	read(&startAddress)
+	read(&count)
+	if err != nil {
+		return Program{}, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	program := Program{StartAddress: int(startAddress), Instructions: make([]MachineCodeTerm, 0, count)}
+	termByIndex := make(map[int]int)
+	for i := 0; i < int(count); i++ {
+		var index uint16
+		var kind WordKind
+		var word uint32
+		read(&index)
+		read(&kind)
+		read(&word)
+		if err != nil {
+			return Program{}, fmt.Errorf("failed to read word %d: %w", i, err)
+		}
+		term, decodeErr := DecodeTerm(int(index), kind, word)
+		if decodeErr != nil {
+			return Program{}, decodeErr
+		}
+		termByIndex[term.Index] = len(program.Instructions)
+		program.Instructions = append(program.Instructions, term)
+	}
+
+	var labelsCount uint32
+	read(&labelsCount)
+	for i := 0; i < int(labelsCount); i++ {
+		var index uint16
+		var length uint8
+		read(&index)
+		read(&length)
+		label := make([]byte, length)
+		if err == nil {
+			_, err = io.ReadFull(reader, label)
+		}
+		if err != nil {
+			return Program{}, fmt.Errorf("failed to read label %d: %w", i, err)
+		}
+		position, ok := termByIndex[int(index)]
+		if !ok {
+			return Program{}, fmt.Errorf("label '%s' points to empty address %d", label, index)
+		}
+		program.Instructions[position].Label = new(string)
+		*program.Instructions[position].Label = string(label)
+	}
+	if err != nil {
+		return Program{}, fmt.Errorf("failed to read labels: %w", err)
+	}
+	return program, nil
+}
+
+// ReadProgram reads the program in any of the formats, see DetectFormat
+func ReadProgram(input io.Reader) (Program, ProgramFormat, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return Program{}, "", err
+	}
+	format := DetectFormat(data)
+	program, err := ReadProgramFormat(bytes.NewReader(data), format)
+	return program, format, err
+}
+
+// SerializeHexDump formats encoded words for inspection, one word per line with the source line
+func SerializeHexDump(program Program) ([]byte, error) {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("; start: %04X\n", program.StartAddress))
+	for _, term := range program.Instructions {
+		word, err := EncodeTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		builder.WriteString(fmt.Sprintf("%04X: %08X  %-10s", term.Index, word, formatTerm(term)))
+		if term.TermInfo.OriginalContent != "" {
+			builder.WriteString(fmt.Sprintf(" ; %s: %s", term.TermInfo.Position(), term.TermInfo.OriginalContent))
+		}
+		builder.WriteString("\n")
+	}
+	return []byte(builder.String()), nil
+}
+
+func formatTerm(term MachineCodeTerm) string {
+	switch {
+	case IsConstant(term):
+		return fmt.Sprintf("%d", *term.Operand)
+	case term.Operand == nil:
+		return term.Opcode.String()
+	case term.OperandType == ValueTypeAddressIndirect:
+		return fmt.Sprintf("%s (%d)", term.Opcode, *term.Operand)
+	default:
+		return fmt.Sprintf("%s %d", term.Opcode, *term.Operand)
+	}
+}
@@ -0,0 +1,72 @@
+package isa_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+	"gotest.tools/v3/assert"
+)
+
+const program = `vector: word: interrupt
+message: word: 'hi'
+pointer: word: message
+big: word: 100000
+
+start: ld (pointer)
+  out pointer
+  jz start
+  wait
+  hlt
+
+interrupt: iret`
+
+func TestEncodeInstruction(t *testing.T) {
+	operand := 6
+	word, err := isa.EncodeTerm(isa.MachineCodeTerm{Opcode: isa.OpcodeLoad, Operand: &operand, OperandType: isa.ValueTypeAddressIndirect})
+	assert.NilError(t, err)
+	assert.Equal(t, word, uint32(0x0B800006))
+
+	opcode, mode, address, err := isa.DecodeInstruction(word)
+	assert.NilError(t, err)
+	assert.Equal(t, opcode, isa.OpcodeLoad)
+	assert.Equal(t, mode, isa.ValueTypeAddressIndirect)
+	assert.Equal(t, address, 6)
+}
+
+func TestEncodeOperandOverflow(t *testing.T) {
+	operand := isa.AddrMaxValue + 1
+	_, err := isa.EncodeTerm(isa.MachineCodeTerm{Opcode: isa.OpcodeJmp, Operand: &operand, OperandType: isa.ValueTypeAddressDirect})
+	assert.Error(t, err, "operand 2048 of JMP at 0 doesn't fit in 11 bits")
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	expected, err := translator.NewTranslator().Translate(program)
+	assert.NilError(t, err)
+
+	serialized, err := isa.SerializeBinary(expected)
+	assert.NilError(t, err)
+	actual, format, err := isa.ReadProgram(bytes.NewReader(serialized))
+	assert.NilError(t, err)
+	assert.Equal(t, format, isa.FormatBinary)
+
+	assert.Equal(t, actual.StartAddress, expected.StartAddress)
+	assert.Equal(t, len(actual.Instructions), len(expected.Instructions))
+	for i, term := range expected.Instructions {
+		term.TermInfo = isa.TermMetaInfo{}
+		assert.DeepEqual(t, actual.Instructions[i], term)
+	}
+}
+
+func TestReadProgramDetectsJson(t *testing.T) {
+	expected, err := translator.NewTranslator().Translate(program)
+	assert.NilError(t, err)
+	serialized, err := isa.SerializeCode(expected)
+	assert.NilError(t, err)
+
+	actual, format, err := isa.ReadProgram(bytes.NewReader(serialized))
+	assert.NilError(t, err)
+	assert.Equal(t, format, isa.FormatJSON)
+	assert.DeepEqual(t, actual, expected)
+}
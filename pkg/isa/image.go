@@ -0,0 +1,340 @@
+package isa
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ImageSize is the number of words in a memory image, i.e. the whole address space
+const ImageSize = AddrMaxValue + 1
+
+const rawImageBytes = ImageSize * 4
+
+// intelHexRecordWords is the number of words in one data record of Intel HEX
+const intelHexRecordWords = 4
+
+type ProgramFormat string
+
+const (
+	FormatJSON     ProgramFormat = "json"
+	FormatBinary   ProgramFormat = "bin"
+	FormatHexDump  ProgramFormat = "hexdump"
+	FormatImage    ProgramFormat = "image"
+	FormatIntelHex ProgramFormat = "ihex"
+	FormatRaw      ProgramFormat = "raw"
+)
+
+const (
+	intelHexData               = 0x00
+	intelHexEndOfFile          = 0x01
+	intelHexExtendedLinearAddr = 0x04
+	intelHexStartLinearAddr    = 0x05
+)
+
+// memoryImage encodes the program into the whole address space. defined marks cells which belong to the program.
+func memoryImage(program Program) (words []uint32, defined []bool, err error) {
+	words = make([]uint32, ImageSize)
+	defined = make([]bool, ImageSize)
+	for _, term := range program.Instructions {
+		if term.Index < 0 || term.Index >= ImageSize {
+			return nil, nil, fmt.Errorf("address %d is outside of memory image", term.Index)
+		}
+		words[term.Index], err = EncodeTerm(term)
+		if err != nil {
+			return nil, nil, err
+		}
+		defined[term.Index] = true
+	}
+	return words, defined, nil
+}
+
+// imageProgram turns image words into constants. Images don't tell code from data,
+// which doesn't matter for the machine: it decodes instructions from raw words.
+func imageProgram(words []uint32, startAddress int) Program {
+	program := Program{StartAddress: startAddress, Instructions: make([]MachineCodeTerm, 0)}
+	for address, word := range words {
+		if word == 0 {
+			continue
+		}
+		value := int(int32(word))
+		program.Instructions = append(program.Instructions, MachineCodeTerm{
+			Index:       address,
+			Opcode:      OpcodeNop,
+			Operand:     &value,
+			OperandType: ValueTypeNumber,
+		})
+	}
+	return program
+}
+
+// SerializeImage writes a flat memory image: the start address header and one hex word per line for every address
+func SerializeImage(program Program) ([]byte, error) {
+	words, _, err := memoryImage(program)
+	if err != nil {
+		return nil, err
+	}
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("; start: %04X\n", program.StartAddress))
+	for _, word := range words {
+		builder.WriteString(fmt.Sprintf("%08X\n", word))
+	}
+	return []byte(builder.String()), nil
+}
+
+func ReadImage(input io.Reader) (Program, error) {
+	scanner := bufio.NewScanner(input)
+	words := make([]uint32, 0, ImageSize)
+	startAddress := -1
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if start, ok := strings.CutPrefix(line, "; start:"); ok {
+			address, err := strconv.ParseUint(strings.TrimSpace(start), 16, 16)
+			if err != nil {
+				return Program{}, fmt.Errorf("line %d: invalid start address: %w", lineNumber, err)
+			}
+			startAddress = int(address)
+			continue
+		}
+		line, _, _ = strings.Cut(line, ";")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		word, err := strconv.ParseUint(line, 16, 32)
+		if err != nil {
+			return Program{}, fmt.Errorf("line %d: invalid word: %w", lineNumber, err)
+		}
+		if len(words) == ImageSize {
+			return Program{}, fmt.Errorf("line %d: image is larger than %d words", lineNumber, ImageSize)
+		}
+		words = append(words, uint32(word))
+	}
+	if err := scanner.Err(); err != nil {
+		return Program{}, err
+	}
+	if startAddress < 0 {
+		return Program{}, errors.New("image has no start address")
+	}
+	return imageProgram(words, startAddress), nil
+}
+
+// SerializeIntelHex writes the memory image in Intel HEX. Addresses are in bytes, words are little-endian.
+// Only records with words of the program are written. The start address is written as a start linear address record.
+func SerializeIntelHex(program Program) ([]byte, error) {
+	words, defined, err := memoryImage(program)
+	if err != nil {
+		return nil, err
+	}
+	builder := strings.Builder{}
+	for address := 0; address < ImageSize; address += intelHexRecordWords {
+		used := false
+		for _, isDefined := range defined[address : address+intelHexRecordWords] {
+			used = used || isDefined
+		}
+		if !used {
+			continue
+		}
+		data := make([]byte, 0, intelHexRecordWords*4)
+		for _, word := range words[address : address+intelHexRecordWords] {
+			data = binary.LittleEndian.AppendUint32(data, word)
+		}
+		builder.WriteString(intelHexRecord(address*4, intelHexData, data))
+	}
+	builder.WriteString(intelHexRecord(0, intelHexStartLinearAddr, binary.BigEndian.AppendUint32(nil, uint32(program.StartAddress*4))))
+	builder.WriteString(intelHexRecord(0, intelHexEndOfFile, nil))
+	return []byte(builder.String()), nil
+}
+
+func intelHexRecord(address int, recordType byte, data []byte) string {
+	record := []byte{byte(len(data)), byte(address >> 8), byte(address), recordType}
+	record = append(record, data...)
+	checksum := byte(0)
+	for _, b := range record {
+		checksum -= b
+	}
+	return ":" + strings.ToUpper(hex.EncodeToString(append(record, checksum))) + "\n"
+}
+
+func ReadIntelHex(input io.Reader) (Program, error) {
+	scanner := bufio.NewScanner(input)
+	memory := make([]byte, rawImageBytes)
+	baseAddress := 0
+	startAddress := -1
+	endOfFile := false
+	for lineNumber := 1; scanner.Scan() && !endOfFile; lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		record, err := parseIntelHexRecord(line)
+		if err != nil {
+			return Program{}, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		address := int(binary.BigEndian.Uint16(record[1:3]))
+		data := record[4:]
+		switch record[3] {
+		case intelHexData:
+			start := baseAddress + address
+			if start+len(data) > len(memory) {
+				return Program{}, fmt.Errorf("line %d: data at byte %d is outside of memory image", lineNumber, start)
+			}
+			copy(memory[start:], data)
+		case intelHexEndOfFile:
+			endOfFile = true
+		case intelHexExtendedLinearAddr:
+			if len(data) != 2 {
+				return Program{}, fmt.Errorf("line %d: extended linear address must have 2 bytes", lineNumber)
+			}
+			baseAddress = int(binary.BigEndian.Uint16(data)) << 16
+		case intelHexStartLinearAddr:
+			if len(data) != 4 {
+				return Program{}, fmt.Errorf("line %d: start linear address must have 4 bytes", lineNumber)
+			}
+			startAddress = int(binary.BigEndian.Uint32(data))
+		default:
+			return Program{}, fmt.Errorf("line %d: unsupported record type %02X", lineNumber, record[3])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Program{}, err
+	}
+	if !endOfFile {
+		return Program{}, errors.New("no end of file record")
+	}
+	if startAddress < 0 {
+		return Program{}, errors.New("no start linear address record")
+	}
+	if startAddress%4 != 0 {
+		return Program{}, fmt.Errorf("start address %d is not aligned to a word", startAddress)
+	}
+	return imageProgram(wordsFromBytes(memory), startAddress/4), nil
+}
+
+func parseIntelHexRecord(line string) ([]byte, error) {
+	if !strings.HasPrefix(line, ":") {
+		return nil, errors.New("record must start with ':'")
+	}
+	record, err := hex.DecodeString(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid record: %w", err)
+	}
+	if len(record) < 5 || len(record) != int(record[0])+5 {
+		return nil, errors.New("invalid record length")
+	}
+	checksum := byte(0)
+	for _, b := range record {
+		checksum += b
+	}
+	if checksum != 0 {
+		return nil, errors.New("checksum mismatch")
+	}
+	return record[:len(record)-1], nil
+}
+
+// SerializeRaw writes the whole address space as little-endian words without any header
+func SerializeRaw(program Program) ([]byte, error) {
+	words, _, err := memoryImage(program)
+	if err != nil {
+		return nil, err
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, rawImageBytes))
+	_ = binary.Write(buffer, binary.LittleEndian, words)
+	return buffer.Bytes(), nil
+}
+
+// ReadRaw reads a raw image. It has no start address, so the program starts at 0 unless the reset vector is configured.
+func ReadRaw(input io.Reader) (Program, error) {
+	memory := make([]byte, rawImageBytes)
+	if _, err := io.ReadFull(input, memory); err != nil {
+		return Program{}, fmt.Errorf("raw image must be %d bytes: %w", rawImageBytes, err)
+	}
+	return imageProgram(wordsFromBytes(memory), 0), nil
+}
+
+func wordsFromBytes(memory []byte) []uint32 {
+	words := make([]uint32, len(memory)/4)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(memory[i*4:])
+	}
+	return words
+}
+
+// DetectFormat guesses the format of the program by its first bytes. Raw images have no header, so they are
+// recognized by size after the textual formats.
+func DetectFormat(data []byte) ProgramFormat {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(data, binaryMagic):
+		return FormatBinary
+	case bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")):
+		return FormatJSON
+	case bytes.HasPrefix(trimmed, []byte(":")):
+		return FormatIntelHex
+	case isTextImage(trimmed):
+		return FormatImage
+	case len(data) == rawImageBytes:
+		return FormatRaw
+	default:
+		return FormatImage
+	}
+}
+
+// isTextImage checks that the data is lines of hex words and comments
+func isTextImage(data []byte) bool {
+	if len(data) == 0 || data[0] != ';' && !isHexDigit(data[0]) {
+		return false
+	}
+	for _, char := range data {
+		if char != '\n' && char != '\r' && char != '\t' && (char < ' ' || char > '~') {
+			return false
+		}
+	}
+	return true
+}
+
+func isHexDigit(char byte) bool {
+	return char >= '0' && char <= '9' || char >= 'a' && char <= 'f' || char >= 'A' && char <= 'F'
+}
+
+func ReadProgramFormat(input io.Reader, format ProgramFormat) (Program, error) {
+	switch format {
+	case FormatJSON:
+		return ReadCode(input)
+	case FormatBinary:
+		return ReadBinary(input)
+	case FormatImage:
+		return ReadImage(input)
+	case FormatIntelHex:
+		return ReadIntelHex(input)
+	case FormatRaw:
+		return ReadRaw(input)
+	default:
+		return Program{}, fmt.Errorf("unknown program format: %s", format)
+	}
+}
+
+func SerializeProgram(program Program, format ProgramFormat) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return SerializeCode(program)
+	case FormatBinary:
+		return SerializeBinary(program)
+	case FormatHexDump:
+		return SerializeHexDump(program)
+	case FormatImage:
+		return SerializeImage(program)
+	case FormatIntelHex:
+		return SerializeIntelHex(program)
+	case FormatRaw:
+		return SerializeRaw(program)
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", format)
+	}
+}
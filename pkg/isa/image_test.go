@@ -0,0 +1,98 @@
+package isa_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+	"gotest.tools/v3/assert"
+)
+
+func assertSameMemory(t *testing.T, actual isa.Program, expected isa.Program) {
+	t.Helper()
+	words := make(map[int]uint32)
+	for _, term := range actual.Instructions {
+		word, err := isa.EncodeTerm(term)
+		assert.NilError(t, err)
+		words[term.Index] = word
+	}
+	for _, term := range expected.Instructions {
+		word, err := isa.EncodeTerm(term)
+		assert.NilError(t, err)
+		assert.Equal(t, words[term.Index], word, "word at %d", term.Index)
+		delete(words, term.Index)
+	}
+	assert.Equal(t, len(words), 0, "unexpected words: %v", words)
+}
+
+func TestImageRoundTrip(t *testing.T) {
+	expected, err := translator.NewTranslator().Translate(program)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		format    isa.ProgramFormat
+		serialize func(isa.Program) ([]byte, error)
+		start     int
+	}{
+		{format: isa.FormatImage, serialize: isa.SerializeImage, start: expected.StartAddress},
+		{format: isa.FormatIntelHex, serialize: isa.SerializeIntelHex, start: expected.StartAddress},
+		{format: isa.FormatRaw, serialize: isa.SerializeRaw, start: 0},
+	}
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			serialized, err := test.serialize(expected)
+			assert.NilError(t, err)
+
+			actual, format, err := isa.ReadProgram(bytes.NewReader(serialized))
+			assert.NilError(t, err)
+			assert.Equal(t, format, test.format)
+			assert.Equal(t, actual.StartAddress, test.start)
+			assertSameMemory(t, actual, expected)
+		})
+	}
+}
+
+func TestSerializeIntelHex(t *testing.T) {
+	operand := 5
+	serialized, err := isa.SerializeIntelHex(isa.Program{StartAddress: 5, Instructions: []isa.MachineCodeTerm{
+		{Index: 5, Opcode: isa.OpcodeJmp, Operand: &operand, OperandType: isa.ValueTypeAddressDirect},
+	}})
+	assert.NilError(t, err)
+	assert.Equal(t, string(serialized), `:100010000000000005006012000000000000000069
+:0400000500000014E3
+:00000001FF
+`)
+}
+
+func TestReadIntelHexChecksum(t *testing.T) {
+	_, err := isa.ReadIntelHex(strings.NewReader(":10001000000000000500601200000000000000006A\n:00000001FF\n"))
+	assert.Error(t, err, "line 1: checksum mismatch")
+}
+
+// textual formats are recognized before the size of a raw image
+func TestDetectFormatOfRawImageSize(t *testing.T) {
+	expected, err := translator.NewTranslator().Translate(program)
+	assert.NilError(t, err)
+	rawSize := isa.ImageSize * 4
+
+	code, err := isa.SerializeCode(expected)
+	assert.NilError(t, err)
+	code = append(code, bytes.Repeat([]byte(" "), rawSize-len(code))...)
+	assert.Equal(t, isa.DetectFormat(code), isa.FormatJSON)
+
+	intelHex, err := isa.SerializeIntelHex(expected)
+	assert.NilError(t, err)
+	intelHex = append(intelHex, bytes.Repeat([]byte("\n"), rawSize-len(intelHex))...)
+	assert.Equal(t, isa.DetectFormat(intelHex), isa.FormatIntelHex)
+
+	image := []byte("; start: 0000\n")
+	image = append(image, bytes.Repeat([]byte("0000000\n"), (rawSize-len(image))/8)...)
+	image = append(image, bytes.Repeat([]byte("\n"), rawSize-len(image))...)
+	assert.Equal(t, isa.DetectFormat(image), isa.FormatImage)
+
+	raw, err := isa.SerializeRaw(expected)
+	assert.NilError(t, err)
+	assert.Equal(t, isa.DetectFormat(raw), isa.FormatRaw)
+}
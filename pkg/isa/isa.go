@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 )
 
@@ -48,6 +49,8 @@ const (
 	OpcodeJnc
 	OpcodeJn
 	OpcodeJnneg
+
+	OpcodeWait
 )
 
 type OpcodeType int
@@ -166,6 +169,10 @@ var (
 			instructionType:      OpcodeTypeBranch,
 			stringRepresentation: "JNN",
 		},
+		OpcodeWait: {
+			instructionType:      OpcodeTypeAddressless,
+			stringRepresentation: "WAIT",
+		},
 	}
 )
 
@@ -200,6 +207,16 @@ func (o *Opcode) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Opcodes lists all opcodes in the order of their codes
+func Opcodes() []Opcode {
+	opcodes := make([]Opcode, 0, len(opcodeToInfo))
+	for opcode := range opcodeToInfo {
+		opcodes = append(opcodes, opcode)
+	}
+	slices.Sort(opcodes)
+	return opcodes
+}
+
 func GetOpcodeFromString(opcode string) (Opcode, error) {
 	for opcodeObj, opcodeInfo := range opcodeToInfo {
 		if strings.EqualFold(opcodeInfo.stringRepresentation, opcode) {
@@ -214,44 +231,6 @@ type Program struct {
 	Instructions []MachineCodeTerm
 }
 
-type MachineWord struct {
-	Opcode    Opcode
-	Value     int
-	ValueType ValueType
-}
-
-func NewConstantNumber(value int) MachineWord {
-	return MachineWord{
-		Opcode:    OpcodeNop,
-		Value:     value,
-		ValueType: ValueTypeNumber,
-	}
-}
-
-func NewMemoryWordFromIO(ioData IoData) MachineWord {
-	return MachineWord{
-		Opcode:    OpcodeNop,
-		Value:     int(ioData.Char[0]),
-		ValueType: ValueTypeChar,
-	}
-}
-
-func NewMemoryWord(instruction MachineCodeTerm) MachineWord {
-	if instruction.Opcode.Type() == OpcodeTypeAddress && instruction.Operand == nil {
-		panic(fmt.Sprintf("address instruction without operand: %s", instruction.Opcode))
-	}
-
-	operand := 0
-	if instruction.Operand != nil {
-		operand = *instruction.Operand
-	}
-	return MachineWord{
-		Opcode:    instruction.Opcode,
-		Value:     operand,
-		ValueType: instruction.OperandType,
-	}
-}
-
 type ValueType int
 
 const (
@@ -268,12 +247,25 @@ type MachineCodeTerm struct {
 	Opcode      Opcode       `json:"opcode"`
 	Operand     *int         `json:"operand,omitempty"`
 	OperandType ValueType    `json:"operand_type,omitempty"`
+	Writable    bool         `json:"writable,omitempty"`
 	TermInfo    TermMetaInfo `json:"term_info"`
 }
 
 type TermMetaInfo struct {
 	LineNum         int    `json:"line_num"`
 	OriginalContent string `json:"original_content"`
+	// FileName is set for lines from included files and for translation of named files
+	FileName string `json:"file_name,omitempty"`
+	// Expansion is the line produced by a macro, OriginalContent is the invocation then
+	Expansion string `json:"expansion,omitempty"`
+}
+
+// Position formats the source position as `file:line`, or just the line number if the file is unknown
+func (i TermMetaInfo) Position() string {
+	if i.FileName == "" {
+		return fmt.Sprintf("%d", i.LineNum)
+	}
+	return fmt.Sprintf("%s:%d", i.FileName, i.LineNum)
 }
 
 type IoData struct {
@@ -0,0 +1,93 @@
+package isa
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type SectionKind string
+
+const (
+	SectionData SectionKind = "data"
+	SectionCode SectionKind = "code"
+)
+
+// Object is a relocatable translation unit. Term indices are offsets inside of their section,
+// address operands are filled by the linker according to relocations.
+type Object struct {
+	Name        string       `json:"name,omitempty"`
+	Sections    []Section    `json:"sections"`
+	Symbols     []Symbol     `json:"symbols"`
+	Imports     []string     `json:"imports,omitempty"`
+	Relocations []Relocation `json:"relocations,omitempty"`
+}
+
+type Section struct {
+	Kind  SectionKind       `json:"kind"`
+	Terms []MachineCodeTerm `json:"terms"`
+}
+
+// Symbol is a label defined in the object. Only exported symbols are visible to other objects.
+type Symbol struct {
+	Name     string      `json:"name"`
+	Section  SectionKind `json:"section"`
+	Offset   int         `json:"offset"`
+	Exported bool        `json:"exported,omitempty"`
+}
+
+// Relocation sets the operand of the term at Offset of Section to the address of Symbol plus Addend.
+// Without Symbol the address is counted from the start of the Target section of the same object.
+type Relocation struct {
+	Section SectionKind `json:"section"`
+	Offset  int         `json:"offset"`
+	Symbol  string      `json:"symbol,omitempty"`
+	Target  SectionKind `json:"target,omitempty"`
+	Addend  int         `json:"addend,omitempty"`
+}
+
+// Library is an archive of objects. The linker takes only objects which define referenced symbols.
+type Library struct {
+	Objects []Object `json:"objects"`
+}
+
+func (o Object) Section(kind SectionKind) *Section {
+	for i := range o.Sections {
+		if o.Sections[i].Kind == kind {
+			return &o.Sections[i]
+		}
+	}
+	return nil
+}
+
+func (o Object) FindSymbol(name string) (Symbol, bool) {
+	for _, symbol := range o.Symbols {
+		if symbol.Name == name {
+			return symbol, true
+		}
+	}
+	return Symbol{}, false
+}
+
+func SerializeObject(object Object) ([]byte, error) {
+	return json.MarshalIndent(object, "", "  ")
+}
+
+func ReadObject(input io.Reader) (Object, error) {
+	var object Object
+	if err := json.NewDecoder(input).Decode(&object); err != nil {
+		return Object{}, err
+	}
+	return object, nil
+}
+
+func SerializeLibrary(library Library) ([]byte, error) {
+	return json.MarshalIndent(library, "", "  ")
+}
+
+func ReadLibrary(input io.Reader) (Library, error) {
+	var library Library
+	if err := json.NewDecoder(input).Decode(&library); err != nil {
+		return Library{}, err
+	}
+	return library, nil
+}
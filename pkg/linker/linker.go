@@ -0,0 +1,191 @@
+package linker
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+const DefaultEntry = "start"
+
+// sectionOrder places all data first, so the interrupt vector of the first object stays at address 0
+var sectionOrder = []isa.SectionKind{isa.SectionData, isa.SectionCode}
+
+type definition struct {
+	object int
+	symbol isa.Symbol
+}
+
+type placement struct {
+	object int
+	kind   isa.SectionKind
+}
+
+// Link combines objects into a program. Objects from libraries are taken only if they export
+// a symbol which is still unresolved. All duplicate and unresolved symbols are reported together.
+func Link(objects []isa.Object, libraries []isa.Library, entry string) (isa.Program, error) {
+	objects = append(slices.Clone(objects), pullFromLibraries(objects, libraries)...)
+
+	errs := make([]error, 0)
+	exports := make(map[string]definition)
+	for i, object := range objects {
+		for _, symbol := range object.Symbols {
+			if !symbol.Exported {
+				continue
+			}
+			if previous, ok := exports[symbol.Name]; ok {
+				errs = append(errs, fmt.Errorf("duplicate symbol '%s': defined in %s and %s", symbol.Name, objectName(objects, previous.object), objectName(objects, i)))
+				continue
+			}
+			exports[symbol.Name] = definition{object: i, symbol: symbol}
+		}
+	}
+
+	program := isa.Program{Instructions: make([]isa.MachineCodeTerm, 0)}
+	bases := make(map[placement]int)
+	for _, kind := range sectionOrder {
+		for i, object := range objects {
+			section := object.Section(kind)
+			if section == nil {
+				continue
+			}
+			base := len(program.Instructions)
+			bases[placement{i, kind}] = base
+			for _, term := range section.Terms {
+				term.Index += base
+				if term.Operand != nil {
+					operand := *term.Operand
+					term.Operand = &operand
+				}
+				program.Instructions = append(program.Instructions, term)
+			}
+		}
+	}
+	if len(program.Instructions) > isa.AddrMaxValue+1 {
+		return isa.Program{}, fmt.Errorf("program doesn't fit in memory: %d words, %d available", len(program.Instructions), isa.AddrMaxValue+1)
+	}
+
+	address := func(definition definition) int {
+		return bases[placement{definition.object, definition.symbol.Section}] + definition.symbol.Offset
+	}
+	resolve := func(object int, name string) (int, bool) {
+		if symbol, ok := objects[object].FindSymbol(name); ok {
+			return address(definition{object, symbol}), true
+		}
+		if definition, ok := exports[name]; ok {
+			return address(definition), true
+		}
+		return 0, false
+	}
+
+	for i, object := range objects {
+		for _, relocation := range object.Relocations {
+			section := object.Section(relocation.Section)
+			if section == nil || relocation.Offset < 0 || relocation.Offset >= len(section.Terms) {
+				errs = append(errs, fmt.Errorf("relocation of '%s' in %s points outside of %s section", relocation.Symbol, objectName(objects, i), relocation.Section))
+				continue
+			}
+			var target int
+			var ok bool
+			if relocation.Symbol == "" {
+				target, ok = bases[placement{i, relocation.Target}]
+			} else {
+				target, ok = resolve(i, relocation.Symbol)
+			}
+			if !ok {
+				errs = append(errs, fmt.Errorf("unresolved symbol '%s' referenced in %s", relocation.Symbol, objectName(objects, i)))
+				continue
+			}
+			target += relocation.Addend
+			term := &program.Instructions[bases[placement{i, relocation.Section}]+relocation.Offset]
+			if !isa.IsConstant(*term) && (target < 0 || target > isa.AddrMaxValue) {
+				errs = append(errs, fmt.Errorf("address %d of '%s' in %s is out of range", target, relocation.Symbol, objectName(objects, i)))
+				continue
+			}
+			term.Operand = &target
+		}
+	}
+
+	startAddress, err := findEntry(objects, exports, entry, address)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return isa.Program{}, errors.Join(errs...)
+	}
+	program.StartAddress = startAddress
+	return program, nil
+}
+
+// findEntry looks for the exported entry symbol first, then for a local one defined in a single object
+func findEntry(objects []isa.Object, exports map[string]definition, entry string, address func(definition) int) (int, error) {
+	if definition, ok := exports[entry]; ok {
+		return address(definition), nil
+	}
+	candidates := make([]definition, 0)
+	for i, object := range objects {
+		if symbol, ok := object.FindSymbol(entry); ok {
+			candidates = append(candidates, definition{object: i, symbol: symbol})
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return 0, fmt.Errorf("entry symbol '%s' not found", entry)
+	case 1:
+		return address(candidates[0]), nil
+	default:
+		return 0, fmt.Errorf("entry symbol '%s' is defined in several objects, export one of them", entry)
+	}
+}
+
+func pullFromLibraries(objects []isa.Object, libraries []isa.Library) []isa.Object {
+	defined := make(map[string]bool)
+	referenced := make([]string, 0)
+	use := func(object isa.Object) {
+		for _, symbol := range object.Symbols {
+			if symbol.Exported {
+				defined[symbol.Name] = true
+			}
+		}
+		referenced = append(referenced, object.Imports...)
+	}
+	for _, object := range objects {
+		use(object)
+	}
+
+	pulled := make([]isa.Object, 0)
+	taken := make(map[[2]int]bool)
+	for changed := true; changed; {
+		changed = false
+		for l, library := range libraries {
+			for o, object := range library.Objects {
+				if taken[[2]int{l, o}] || !resolvesAny(object, referenced, defined) {
+					continue
+				}
+				taken[[2]int{l, o}] = true
+				pulled = append(pulled, object)
+				use(object)
+				changed = true
+			}
+		}
+	}
+	return pulled
+}
+
+func resolvesAny(object isa.Object, referenced []string, defined map[string]bool) bool {
+	for _, name := range referenced {
+		if symbol, ok := object.FindSymbol(name); ok && symbol.Exported && !defined[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func objectName(objects []isa.Object, index int) string {
+	if objects[index].Name != "" {
+		return objects[index].Name
+	}
+	return fmt.Sprintf("object #%d", index)
+}
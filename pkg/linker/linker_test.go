@@ -0,0 +1,96 @@
+package linker
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/machine"
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+	"gotest.tools/v3/assert"
+)
+
+const mainUnit = `global start
+extern print
+message: word: 'hi'
+pointer: word: message
+
+start: ld pointer
+  st text
+  jmp print
+finish: hlt
+global finish, text
+text: word: 0`
+
+const printUnit = `global print
+extern text, finish
+out_port: word: 1
+
+print: ld (text)
+  jz done
+  out out_port
+  ld text
+  inc
+  st text
+  jmp print
+done: jmp finish`
+
+const unusedUnit = `global unused
+unused: hlt`
+
+func translateObject(t *testing.T, name string, source string) isa.Object {
+	t.Helper()
+	object, err := translator.NewTranslator().TranslateObject(source)
+	assert.NilError(t, err)
+	object.Name = name
+	return object
+}
+
+func TestLinkWithLibrary(t *testing.T) {
+	mainObject := translateObject(t, "main.o", mainUnit)
+	library := isa.Library{Objects: []isa.Object{
+		translateObject(t, "unused.o", unusedUnit),
+		translateObject(t, "print.o", printUnit),
+	}}
+
+	program, err := Link([]isa.Object{mainObject}, []isa.Library{library}, DefaultEntry)
+	assert.NilError(t, err)
+	// data: 'hi' + 0, pointer, text, out_port; code: 3 instructions + hlt, then print
+	assert.Equal(t, len(program.Instructions), 6+4+8)
+	assert.Equal(t, program.StartAddress, 6)
+
+	output := bytes.NewBuffer([]byte{})
+	err = machine.RunSimulation(machine.DefaultConfig(), nil, program, output, io.Discard)
+	assert.NilError(t, err)
+	assert.Equal(t, output.String(), "hi")
+}
+
+func TestLinkReportsAllErrors(t *testing.T) {
+	first := translateObject(t, "first.o", "global start\nextern missing\nstart: jmp missing")
+	second := translateObject(t, "second.o", "global start\nstart: hlt")
+
+	_, err := Link([]isa.Object{first, second}, nil, DefaultEntry)
+	assert.Error(t, err, "duplicate symbol 'start': defined in first.o and second.o\n"+
+		"unresolved symbol 'missing' referenced in first.o")
+}
+
+func TestLinkLocalSymbolsAreNotShared(t *testing.T) {
+	first := translateObject(t, "first.o", "extern helper\nstart: jmp helper")
+	second := translateObject(t, "second.o", "helper: hlt")
+
+	_, err := Link([]isa.Object{first, second}, nil, DefaultEntry)
+	assert.Error(t, err, "unresolved symbol 'helper' referenced in first.o")
+}
+
+func TestLinkRelocationsWithAddend(t *testing.T) {
+	first := translateObject(t, "first.o", "global start\nextern table\nstart: ld table + 1\n  jmp * + 2\n  hlt\n  hlt")
+	second := translateObject(t, "second.o", "global table\ntable: word: 1\nsecond: word: 2")
+
+	program, err := Link([]isa.Object{first, second}, nil, DefaultEntry)
+	assert.NilError(t, err)
+	// data of second.o goes first: table at 0, code of first.o starts at 2
+	assert.Equal(t, program.StartAddress, 2)
+	assert.Equal(t, *program.Instructions[2].Operand, 1)
+	assert.Equal(t, *program.Instructions[3].Operand, 5)
+}
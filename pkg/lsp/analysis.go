@@ -0,0 +1,268 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+)
+
+// analysis is the result of translation of a document
+type analysis struct {
+	fileName    string
+	diagnostics []translator.Diagnostic
+	symbols     []translator.SymbolInfo
+	references  []translator.SymbolReference
+}
+
+// objectDirectives mark units which are linked with others, they are checked as objects without `start`
+var objectDirectives = regexp.MustCompile(`(?mi)^\s*(global|extern)\s`)
+
+// analyze translates the document, a failure of the translator on a half-typed line is reported as a diagnostic
+// instead of stopping the server
+func analyze(fileName string, text string, options translator.Options) (result analysis) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = analysis{fileName: fileName, diagnostics: []translator.Diagnostic{{
+				Severity: translator.SeverityError,
+				Code:     translator.CodeSyntax,
+				Message:  fmt.Sprintf("translator failed: %v", r),
+				FileName: fileName,
+				Line:     1,
+			}}}
+		}
+	}()
+	options.FileName = fileName
+	program := translator.NewTranslatorWithOptions(options)
+	_, _ = program.Translate(text)
+	result = analysis{
+		fileName:    fileName,
+		diagnostics: program.GetDiagnostics(),
+		symbols:     program.GetSymbols(),
+		references:  program.GetReferences(),
+	}
+	if objectDirectives.MatchString(text) {
+		object := translator.NewTranslatorWithOptions(options)
+		_, _ = object.TranslateObject(text)
+		result.diagnostics = object.GetDiagnostics()
+	}
+	return result
+}
+
+// symbolAt finds the symbol which is defined or referenced at the position of the document
+func (a analysis) symbolAt(lines []string, position Position) (translator.SymbolInfo, Range, bool) {
+	if position.Line >= len(lines) {
+		return translator.SymbolInfo{}, Range{}, false
+	}
+	line := lines[position.Line]
+	word, start, end := wordAt(line, byteOffset(line, position.Character))
+	if word == "" {
+		return translator.SymbolInfo{}, Range{}, false
+	}
+	wordRange := Range{Start: Position{position.Line, utf16Length(line[:start])}, End: Position{position.Line, utf16Length(line[:end])}}
+	for _, reference := range a.references {
+		if reference.Written == word && a.isHere(reference.MetaInfo.FileName, reference.MetaInfo.LineNum, position.Line) {
+			if symbol, ok := a.find(reference.Name); ok {
+				return symbol, wordRange, true
+			}
+		}
+	}
+	for _, symbol := range a.symbols {
+		if a.isHere(symbol.MetaInfo.FileName, symbol.MetaInfo.LineNum, position.Line) && writtenName(symbol.Name) == word {
+			return symbol, wordRange, true
+		}
+	}
+	symbol, ok := a.find(word)
+	return symbol, wordRange, ok
+}
+
+func (a analysis) isHere(fileName string, lineNumber int, line int) bool {
+	return fileName == a.fileName && lineNumber == line+1
+}
+
+func (a analysis) find(name string) (translator.SymbolInfo, bool) {
+	for _, symbol := range a.symbols {
+		if symbol.Name == name {
+			return symbol, true
+		}
+	}
+	return translator.SymbolInfo{}, false
+}
+
+// definition is the location of the label or the constant name where the symbol is defined
+func (a analysis) definition(symbol translator.SymbolInfo, sources *sourceCache) (Location, bool) {
+	lines := sources.lines(symbol.MetaInfo.FileName)
+	lineIndex := symbol.MetaInfo.LineNum - 1
+	if lineIndex < 0 || lineIndex >= len(lines) {
+		return Location{}, false
+	}
+	return Location{URI: pathToURI(symbol.MetaInfo.FileName), Range: wordRange(lines[lineIndex], lineIndex, writtenName(symbol.Name))}, true
+}
+
+// usages are locations of references to the symbol, a line with several references has a location for each
+func (a analysis) usages(symbol translator.SymbolInfo, sources *sourceCache) []Location {
+	locations := make([]Location, 0)
+	seen := make(map[string]bool)
+	for _, reference := range a.references {
+		info := reference.MetaInfo
+		key := fmt.Sprintf("%s:%d:%s", info.FileName, info.LineNum, reference.Written)
+		if reference.Name != symbol.Name || seen[key] {
+			continue
+		}
+		seen[key] = true
+		lines := sources.lines(info.FileName)
+		if info.LineNum < 1 || info.LineNum > len(lines) {
+			continue
+		}
+		line := lines[info.LineNum-1]
+		for _, start := range wordOccurrences(line, reference.Written) {
+			locations = append(locations, Location{URI: pathToURI(info.FileName), Range: Range{
+				Start: Position{info.LineNum - 1, utf16Length(line[:start])},
+				End:   Position{info.LineNum - 1, utf16Length(line[:start+len(reference.Written)])},
+			}})
+		}
+	}
+	return locations
+}
+
+func hoverText(symbol translator.SymbolInfo) string {
+	switch symbol.Kind {
+	case translator.SymbolEqu, translator.SymbolSet:
+		return fmt.Sprintf("```\n%s %s %d\n```\nconstant, %d references", symbol.Name, symbol.Kind, symbol.Value, symbol.References)
+	case translator.SymbolLocal:
+		return fmt.Sprintf("```\n%s: ; address %d (0x%04X)\n```\nlocal label, %d references", symbol.Name, symbol.Value, symbol.Value, symbol.References)
+	case translator.SymbolAnonymous:
+		return fmt.Sprintf("```\n%s: ; address %d (0x%04X)\n```\nanonymous label, %d references", writtenName(symbol.Name), symbol.Value, symbol.Value, symbol.References)
+	default:
+		return fmt.Sprintf("```\n%s: ; address %d (0x%04X)\n```\nlabel, %d references", symbol.Name, symbol.Value, symbol.Value, symbol.References)
+	}
+}
+
+// writtenName is the name of a symbol as it's written at the definition: `.loop` for `start.loop`, `1` for `1@3`
+func writtenName(name string) string {
+	if number, _, ok := strings.Cut(name, "@"); ok {
+		return number
+	}
+	if dot := strings.LastIndex(name, "."); dot > 0 {
+		return name[dot:]
+	}
+	return name
+}
+
+func isWordChar(char byte) bool {
+	return char == '_' || char == '.' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9'
+}
+
+func wordAt(line string, offset int) (string, int, int) {
+	code, _, _ := strings.Cut(line, ";")
+	if offset > len(code) {
+		return "", 0, 0
+	}
+	start, end := offset, offset
+	for start > 0 && isWordChar(code[start-1]) {
+		start--
+	}
+	for end < len(code) && isWordChar(code[end]) {
+		end++
+	}
+	return code[start:end], start, end
+}
+
+// wordOccurrences finds the word in the code of the line where it isn't a part of a longer word
+func wordOccurrences(line string, word string) []int {
+	code, _, _ := strings.Cut(line, ";")
+	occurrences := make([]int, 0)
+	for offset := 0; offset < len(code); {
+		index := strings.Index(code[offset:], word)
+		if index == -1 {
+			break
+		}
+		start, end := offset+index, offset+index+len(word)
+		if (start == 0 || !isWordChar(code[start-1])) && (end == len(code) || !isWordChar(code[end])) {
+			occurrences = append(occurrences, start)
+		}
+		offset = end
+	}
+	return occurrences
+}
+
+func wordRange(line string, lineIndex int, word string) Range {
+	start, end := 0, 0
+	if occurrences := wordOccurrences(line, word); len(occurrences) > 0 {
+		start, end = occurrences[0], occurrences[0]+len(word)
+	}
+	return Range{Start: Position{lineIndex, utf16Length(line[:start])}, End: Position{lineIndex, utf16Length(line[:end])}}
+}
+
+// diagnosticRange converts the column in bytes of the translator to UTF-16 characters of the protocol
+func diagnosticRange(diagnostic translator.Diagnostic) Range {
+	line := max(diagnostic.Line-1, 0)
+	if diagnostic.Column == 0 || diagnostic.Column-1+diagnostic.Length > len(diagnostic.Source) {
+		return Range{Start: Position{line, 0}, End: Position{line, utf16Length(diagnostic.Source)}}
+	}
+	start := diagnostic.Column - 1
+	return Range{
+		Start: Position{line, utf16Length(diagnostic.Source[:start])},
+		End:   Position{line, utf16Length(diagnostic.Source[:start+diagnostic.Length])},
+	}
+}
+
+func utf16Length(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// byteOffset converts a character of the protocol to an offset in the line
+func byteOffset(line string, character int) int {
+	units := 0
+	for offset, char := range line {
+		if units >= character {
+			return offset
+		}
+		units += len(utf16.Encode([]rune{char}))
+	}
+	return len(line)
+}
+
+// sourceCache gives lines of open documents and of files on disk, e.g. included ones
+type sourceCache struct {
+	documents map[string]string
+}
+
+func (c *sourceCache) lines(fileName string) []string {
+	if text, ok := c.documents[fileName]; ok {
+		return splitLines(text)
+	}
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil
+	}
+	return splitLines(string(content))
+}
+
+func splitLines(text string) []string {
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
+
+func uriToPath(uri string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme != "file" {
+		return "", errors.New("only file URIs are supported")
+	}
+	return filepath.FromSlash(parsed.Path), nil
+}
+
+func pathToURI(path string) string {
+	if absolute, err := filepath.Abs(path); err == nil {
+		path = absolute
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
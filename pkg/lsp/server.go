@@ -0,0 +1,388 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+)
+
+// Server is a language server working over a stream, usually stdin and stdout of the process.
+// Documents are translated with AsmTranslator when they are opened or saved.
+type Server struct {
+	reader   *bufio.Reader
+	writer   io.Writer
+	options  translator.Options
+	sources  sourceCache
+	analyses map[string]analysis
+	shutdown bool
+}
+
+type handler func(s *Server, params json.RawMessage) (any, error)
+
+var errInvalidParams = errors.New("invalid params")
+
+var handlers = map[string]handler{
+	"initialize":                  (*Server).initialize,
+	"shutdown":                    (*Server).shutdownRequest,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/references":     (*Server).references,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/completion":     (*Server).completion,
+	"textDocument/documentSymbol": (*Server).documentSymbols,
+}
+
+var notifications = map[string]func(s *Server, params json.RawMessage) error{
+	"textDocument/didOpen":   (*Server).didOpen,
+	"textDocument/didChange": (*Server).didChange,
+	"textDocument/didSave":   (*Server).didSave,
+	"textDocument/didClose":  (*Server).didClose,
+}
+
+// NewServer creates a server, options are used for translation, e.g. include paths
+func NewServer(input io.Reader, output io.Writer, options translator.Options) *Server {
+	return &Server{
+		reader:   bufio.NewReader(input),
+		writer:   output,
+		options:  options,
+		sources:  sourceCache{documents: make(map[string]string)},
+		analyses: make(map[string]analysis),
+	}
+}
+
+// Serve handles messages until the `exit` notification or the end of input
+func (s *Server) Serve() error {
+	for {
+		request, err := s.readMessage()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if request.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		}
+		if err := s.handle(request); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(request message) error {
+	if notification, ok := notifications[request.Method]; ok {
+		return notification(s, request.Params)
+	}
+	if request.ID == nil {
+		// other notifications aren't supported and are ignored
+		return nil
+	}
+	response := message{JSONRPC: "2.0", ID: request.ID}
+	method, ok := handlers[request.Method]
+	if !ok {
+		response.Error = &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method '%s' is not supported", request.Method)}
+		return s.writeMessage(response)
+	}
+	result, err := method(s, request.Params)
+	switch {
+	case errors.Is(err, errInvalidParams):
+		response.Error = &responseError{Code: codeInvalidParams, Message: err.Error()}
+	case err != nil:
+		return err
+	default:
+		response.Result = result
+		if result == nil {
+			response.Result = json.RawMessage("null")
+		}
+	}
+	return s.writeMessage(response)
+}
+
+func (s *Server) readMessage() (message, error) {
+	headers, err := textproto.NewReader(s.reader).ReadMIMEHeader()
+	if err != nil {
+		return message{}, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		return message{}, fmt.Errorf("invalid Content-Length: %w", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return message{}, err
+	}
+	var request message
+	if err := json.Unmarshal(body, &request); err != nil {
+		return message{}, fmt.Errorf("invalid message: %w", err)
+	}
+	return request, nil
+}
+
+func (s *Server) writeMessage(response message) error {
+	response.JSONRPC = "2.0"
+	body, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.writer, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *Server) notify(method string, params any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.writeMessage(message{Method: method, Params: body})
+}
+
+func decodeParams[T any](params json.RawMessage) (T, error) {
+	var decoded T
+	if err := json.Unmarshal(params, &decoded); err != nil {
+		return decoded, fmt.Errorf("%w: %s", errInvalidParams, err.Error())
+	}
+	return decoded, nil
+}
+
+func (s *Server) initialize(json.RawMessage) (any, error) {
+	return map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync": map[string]any{
+				"openClose": true,
+				// the whole document is sent on change
+				"change": 1,
+				"save":   map[string]any{"includeText": true},
+			},
+			"definitionProvider":     true,
+			"referencesProvider":     true,
+			"hoverProvider":          true,
+			"completionProvider":     map[string]any{},
+			"documentSymbolProvider": true,
+		},
+		"serverInfo": map[string]any{"name": "asmlsp"},
+	}, nil
+}
+
+func (s *Server) shutdownRequest(json.RawMessage) (any, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) error {
+	opened, err := decodeParams[didOpenParams](params)
+	if err != nil {
+		return nil
+	}
+	return s.update(opened.TextDocument.URI, opened.TextDocument.Text)
+}
+
+// didChange keeps the text and drops the outdated analysis, diagnostics are published again on save
+func (s *Server) didChange(params json.RawMessage) error {
+	changed, err := decodeParams[didChangeParams](params)
+	if err != nil || len(changed.ContentChanges) == 0 {
+		return nil
+	}
+	if path, err := uriToPath(changed.TextDocument.URI); err == nil {
+		s.sources.documents[path] = changed.ContentChanges[len(changed.ContentChanges)-1].Text
+		delete(s.analyses, path)
+	}
+	return nil
+}
+
+func (s *Server) didSave(params json.RawMessage) error {
+	saved, err := decodeParams[didSaveParams](params)
+	if err != nil {
+		return nil
+	}
+	path, err := uriToPath(saved.TextDocument.URI)
+	if err != nil {
+		return nil
+	}
+	text := s.sources.documents[path]
+	if saved.Text != nil {
+		text = *saved.Text
+	}
+	return s.update(saved.TextDocument.URI, text)
+}
+
+func (s *Server) didClose(params json.RawMessage) error {
+	closed, err := decodeParams[didSaveParams](params)
+	if err != nil {
+		return nil
+	}
+	if path, err := uriToPath(closed.TextDocument.URI); err == nil {
+		delete(s.sources.documents, path)
+		delete(s.analyses, path)
+	}
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: closed.TextDocument.URI, Diagnostics: []Diagnostic{}})
+}
+
+// update translates the document and publishes its diagnostics
+func (s *Server) update(uri string, text string) error {
+	path, err := uriToPath(uri)
+	if err != nil {
+		return nil
+	}
+	s.sources.documents[path] = text
+	result := analyze(path, text, s.options)
+	s.analyses[path] = result
+
+	diagnostics := make([]Diagnostic, 0)
+	for _, diagnostic := range result.diagnostics {
+		// diagnostics of included files are shown on their own documents
+		if diagnostic.FileName != path && diagnostic.FileName != "" {
+			continue
+		}
+		severity := severityError
+		if diagnostic.Severity == translator.SeverityWarning {
+			severity = severityWarning
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    diagnosticRange(diagnostic),
+			Severity: severity,
+			Code:     diagnostic.Code,
+			Source:   "asm",
+			Message:  diagnostic.Message,
+		})
+	}
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+// documentAt returns the analysis and lines of the document, the document is translated if it wasn't yet
+func (s *Server) documentAt(uri string) (analysis, []string, error) {
+	path, err := uriToPath(uri)
+	if err != nil {
+		return analysis{}, nil, fmt.Errorf("%w: %s", errInvalidParams, err.Error())
+	}
+	result, ok := s.analyses[path]
+	if !ok {
+		text := strings.Join(s.sources.lines(path), "\n")
+		result = analyze(path, text, s.options)
+		s.analyses[path] = result
+	}
+	return result, s.sources.lines(path), nil
+}
+
+func (s *Server) symbolAt(params json.RawMessage) (analysis, translator.SymbolInfo, Range, bool, error) {
+	request, err := decodeParams[textDocumentPositionParams](params)
+	if err != nil {
+		return analysis{}, translator.SymbolInfo{}, Range{}, false, err
+	}
+	result, lines, err := s.documentAt(request.TextDocument.URI)
+	if err != nil {
+		return analysis{}, translator.SymbolInfo{}, Range{}, false, err
+	}
+	symbol, wordRange, ok := result.symbolAt(lines, request.Position)
+	return result, symbol, wordRange, ok, nil
+}
+
+func (s *Server) definition(params json.RawMessage) (any, error) {
+	result, symbol, _, ok, err := s.symbolAt(params)
+	if err != nil || !ok {
+		return nil, err
+	}
+	location, ok := result.definition(symbol, &s.sources)
+	if !ok {
+		return nil, nil
+	}
+	return location, nil
+}
+
+func (s *Server) references(params json.RawMessage) (any, error) {
+	request, err := decodeParams[referenceParams](params)
+	if err != nil {
+		return nil, err
+	}
+	result, symbol, _, ok, err := s.symbolAt(params)
+	if err != nil || !ok {
+		return []Location{}, err
+	}
+	locations := result.usages(symbol, &s.sources)
+	if request.Context.IncludeDeclaration {
+		if location, ok := result.definition(symbol, &s.sources); ok {
+			locations = append([]Location{location}, locations...)
+		}
+	}
+	return locations, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (any, error) {
+	_, symbol, wordRange, ok, err := s.symbolAt(params)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return Hover{Contents: markupContent{Kind: "markdown", Value: hoverText(symbol)}, Range: wordRange}, nil
+}
+
+// completion offers mnemonics of the instruction set and symbols of the document
+func (s *Server) completion(params json.RawMessage) (any, error) {
+	request, err := decodeParams[textDocumentPositionParams](params)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]CompletionItem, 0)
+	for _, opcode := range isa.Opcodes() {
+		items = append(items, CompletionItem{Label: strings.ToLower(opcode.String()), Kind: completionKeyword, Detail: "instruction"})
+	}
+	result, _, err := s.documentAt(request.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	for _, symbol := range result.symbols {
+		if symbol.Kind == translator.SymbolAnonymous {
+			continue
+		}
+		kind := completionVariable
+		if symbol.Kind == translator.SymbolEqu || symbol.Kind == translator.SymbolSet {
+			kind = completionConstant
+		}
+		items = append(items, CompletionItem{Label: symbol.Name, Kind: kind, Detail: fmt.Sprintf("%s %d", symbol.Kind, symbol.Value)})
+	}
+	return items, nil
+}
+
+func (s *Server) documentSymbols(params json.RawMessage) (any, error) {
+	request, err := decodeParams[struct {
+		TextDocument textDocumentIdentifier `json:"textDocument"`
+	}](params)
+	if err != nil {
+		return nil, err
+	}
+	result, lines, err := s.documentAt(request.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	symbols := make([]DocumentSymbol, 0)
+	for _, symbol := range result.symbols {
+		lineIndex := symbol.MetaInfo.LineNum - 1
+		if symbol.MetaInfo.FileName != result.fileName || symbol.MetaInfo.Expansion != "" || lineIndex < 0 || lineIndex >= len(lines) {
+			continue
+		}
+		kind := symbolFunction
+		switch symbol.Kind {
+		case translator.SymbolEqu:
+			kind = symbolConstant
+		case translator.SymbolSet:
+			kind = symbolVariable
+		}
+		lineRange := Range{Start: Position{lineIndex, 0}, End: Position{lineIndex, utf16Length(lines[lineIndex])}}
+		symbols = append(symbols, DocumentSymbol{
+			Name:           symbol.Name,
+			Detail:         fmt.Sprintf("%s %d", symbol.Kind, symbol.Value),
+			Kind:           kind,
+			Range:          lineRange,
+			SelectionRange: wordRange(lines[lineIndex], lineIndex, writtenName(symbol.Name)),
+		})
+	}
+	return symbols, nil
+}
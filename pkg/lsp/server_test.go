@@ -0,0 +1,174 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+	"gotest.tools/v3/assert"
+)
+
+const documentURI = "file:///work/main.asm"
+
+const document = `COUNT equ 3
+counter: word: COUNT
+start: ld counter
+.loop: dec
+  jnz .loop
+  jmp start
+`
+
+type session struct {
+	input bytes.Buffer
+	id    int
+}
+
+func (s *session) send(method string, params any) int {
+	s.id++
+	s.write(map[string]any{"jsonrpc": "2.0", "id": s.id, "method": method, "params": params})
+	return s.id
+}
+
+func (s *session) notify(method string, params any) {
+	s.write(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (s *session) write(content any) {
+	body, _ := json.Marshal(content)
+	s.input.WriteString(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body))
+}
+
+// run serves the session and returns responses by their ids and notifications by methods
+func (s *session) run(t *testing.T) (map[int]json.RawMessage, map[string][]json.RawMessage) {
+	t.Helper()
+	s.send("shutdown", nil)
+	s.notify("exit", nil)
+	output := bytes.Buffer{}
+	assert.NilError(t, NewServer(&s.input, &output, translator.Options{}).Serve())
+
+	responses := make(map[int]json.RawMessage)
+	notifications := make(map[string][]json.RawMessage)
+	reader := bufio.NewReader(&output)
+	for {
+		headers, err := textproto.NewReader(reader).ReadMIMEHeader()
+		if err != nil {
+			break
+		}
+		length, err := strconv.Atoi(headers.Get("Content-Length"))
+		assert.NilError(t, err)
+		body := make([]byte, length)
+		_, err = io.ReadFull(reader, body)
+		assert.NilError(t, err)
+		var decoded struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Result json.RawMessage `json:"result"`
+			Params json.RawMessage `json:"params"`
+		}
+		assert.NilError(t, json.Unmarshal(body, &decoded))
+		if decoded.ID != nil {
+			responses[*decoded.ID] = decoded.Result
+		} else {
+			notifications[decoded.Method] = append(notifications[decoded.Method], decoded.Params)
+		}
+	}
+	return responses, notifications
+}
+
+func position(line int, character int) map[string]any {
+	return map[string]any{"textDocument": map[string]any{"uri": documentURI}, "position": map[string]any{"line": line, "character": character}}
+}
+
+func decode[T any](t *testing.T, raw json.RawMessage) T {
+	t.Helper()
+	var decoded T
+	assert.NilError(t, json.Unmarshal(raw, &decoded))
+	return decoded
+}
+
+func TestNavigation(t *testing.T) {
+	s := session{}
+	s.send("initialize", map[string]any{})
+	s.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": documentURI, "text": document}})
+	definition := s.send("textDocument/definition", position(4, 7))
+	references := s.send("textDocument/references", map[string]any{
+		"textDocument": map[string]any{"uri": documentURI}, "position": map[string]any{"line": 1, "character": 2}, "context": map[string]any{"includeDeclaration": true},
+	})
+	hoverLabel := s.send("textDocument/hover", position(5, 7))
+	hoverConstant := s.send("textDocument/hover", position(1, 17))
+	responses, notifications := s.run(t)
+
+	assert.Equal(t, len(notifications["textDocument/publishDiagnostics"]), 1)
+	published := decode[publishDiagnosticsParams](t, notifications["textDocument/publishDiagnostics"][0])
+	assert.Equal(t, len(published.Diagnostics), 0)
+
+	assert.DeepEqual(t, decode[Location](t, responses[definition]), Location{URI: documentURI, Range: Range{Start: Position{3, 0}, End: Position{3, 5}}})
+	assert.DeepEqual(t, decode[[]Location](t, responses[references]), []Location{
+		{URI: documentURI, Range: Range{Start: Position{1, 0}, End: Position{1, 7}}},
+		{URI: documentURI, Range: Range{Start: Position{2, 10}, End: Position{2, 17}}},
+	})
+	assert.Equal(t, decode[Hover](t, responses[hoverLabel]).Contents.Value, "```\nstart: ; address 1 (0x0001)\n```\nlabel, 1 references")
+	assert.Equal(t, decode[Hover](t, responses[hoverConstant]).Contents.Value, "```\nCOUNT equ 3\n```\nconstant, 1 references")
+}
+
+// navigation uses the changed text before it's saved
+func TestNavigationAfterChange(t *testing.T) {
+	s := session{}
+	s.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": documentURI, "text": document}})
+	s.notify("textDocument/didChange", map[string]any{"textDocument": map[string]any{"uri": documentURI}, "contentChanges": []any{map[string]any{"text": "; moved\n" + document}}})
+	definition := s.send("textDocument/definition", position(5, 7))
+	responses, _ := s.run(t)
+
+	assert.DeepEqual(t, decode[Location](t, responses[definition]), Location{URI: documentURI, Range: Range{Start: Position{4, 0}, End: Position{4, 5}}})
+}
+
+// a line which is being typed is translated for hover without stopping the server
+func TestHoverAfterUnfinishedLine(t *testing.T) {
+	s := session{}
+	s.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": documentURI, "text": document}})
+	s.notify("textDocument/didChange", map[string]any{"textDocument": map[string]any{"uri": documentURI}, "contentChanges": []any{map[string]any{"text": document + "loop:"}}})
+	hover := s.send("textDocument/hover", position(2, 2))
+	responses, _ := s.run(t)
+
+	assert.Equal(t, decode[Hover](t, responses[hover]).Contents.Value, "```\nstart: ; address 1 (0x0001)\n```\nlabel, 1 references")
+}
+
+func TestDiagnosticsOnSave(t *testing.T) {
+	s := session{}
+	s.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": documentURI, "text": document}})
+	s.notify("textDocument/didChange", map[string]any{"textDocument": map[string]any{"uri": documentURI}, "contentChanges": []any{map[string]any{"text": "start: ld missing\n  hlt 1"}}})
+	s.notify("textDocument/didSave", map[string]any{"textDocument": map[string]any{"uri": documentURI}})
+	_, notifications := s.run(t)
+
+	published := notifications["textDocument/publishDiagnostics"]
+	assert.Equal(t, len(published), 2)
+	diagnostics := decode[publishDiagnosticsParams](t, published[1]).Diagnostics
+	assert.DeepEqual(t, diagnostics, []Diagnostic{
+		{Range: Range{Start: Position{0, 10}, End: Position{0, 17}}, Severity: severityError, Code: translator.CodeLabel, Source: "asm", Message: "label 'missing' not found"},
+		{Range: Range{Start: Position{1, 2}, End: Position{1, 5}}, Severity: severityError, Code: translator.CodeOperand, Source: "asm", Message: "instruction 'hlt' takes no operand"},
+	})
+}
+
+func TestCompletionAndSymbols(t *testing.T) {
+	s := session{}
+	s.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": documentURI, "text": document}})
+	completion := s.send("textDocument/completion", position(2, 8))
+	symbols := s.send("textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": documentURI}})
+	responses, _ := s.run(t)
+
+	items := decode[[]CompletionItem](t, responses[completion])
+	assert.DeepEqual(t, items[0], CompletionItem{Label: "nop", Kind: completionKeyword, Detail: "instruction"})
+	assert.DeepEqual(t, items[len(items)-1], CompletionItem{Label: "start.loop", Kind: completionVariable, Detail: "local 2"})
+
+	names := make([]string, 0)
+	for _, symbol := range decode[[]DocumentSymbol](t, responses[symbols]) {
+		names = append(names, fmt.Sprintf("%s %d:%d", symbol.Name, symbol.SelectionRange.Start.Line, symbol.SelectionRange.Start.Character))
+	}
+	assert.DeepEqual(t, names, []string{"COUNT 0:0", "counter 1:0", "start 2:0", "start.loop 3:0"})
+}
@@ -32,6 +32,8 @@ type BinaryOperationExec func(left int, right int) int
 type Alu struct {
 	bitFlags       BitFlags
 	operation2func map[AluOperation]BinaryOperationExec
+	wordMaxValue   int
+	wordMinValue   int
 }
 
 func add(left int, right int) int {
@@ -62,8 +64,10 @@ func takeRight(_ int, right int) int {
 	return right
 }
 
-func NewAlu() *Alu {
+func NewAlu(config Config) *Alu {
 	return &Alu{
+		wordMaxValue: config.wordMaxValue(),
+		wordMinValue: config.wordMinValue(),
 		operation2func: map[AluOperation]BinaryOperationExec{
 			AluOperationAdd:   add,
 			AluOperationSub:   sub,
@@ -79,44 +83,44 @@ func NewAlu() *Alu {
 type FlagBit int
 
 func (a *Alu) setFlags(value int) {
-	a.bitFlags.Carry = value > isa.WordMaxValue || value < isa.WordMinValue
+	a.bitFlags.Carry = value > a.wordMaxValue || value < a.wordMinValue
 	a.bitFlags.Zero = value == 0
 	a.bitFlags.Negative = value < 0
 }
 
 type ExecutionParams struct {
 	operation   AluOperation
-	left        isa.MachineWord
-	right       isa.MachineWord
+	left        uint32
+	right       uint32
 	updateFlags bool
 }
 
 func NewAluOp(operation AluOperation) *ExecutionParams {
 	return &ExecutionParams{
 		operation:   operation,
-		left:        isa.NewConstantNumber(0),
-		right:       isa.NewConstantNumber(0),
+		left:        0,
+		right:       0,
 		updateFlags: false,
 	}
 }
 
-func (p *ExecutionParams) SetLeft(left isa.MachineWord) *ExecutionParams {
+func (p *ExecutionParams) SetLeft(left uint32) *ExecutionParams {
 	p.left = left
 	return p
 }
 
 func (p *ExecutionParams) SetLeftValue(left int) *ExecutionParams {
-	p.left = isa.NewConstantNumber(left)
+	p.left = uint32(left)
 	return p
 }
 
-func (p *ExecutionParams) SetRight(right isa.MachineWord) *ExecutionParams {
+func (p *ExecutionParams) SetRight(right uint32) *ExecutionParams {
 	p.right = right
 	return p
 }
 
 func (p *ExecutionParams) SetRightValue(right int) *ExecutionParams {
-	p.right = isa.NewConstantNumber(right)
+	p.right = uint32(right)
 	return p
 }
 
@@ -125,15 +129,19 @@ func (p *ExecutionParams) UpdateFlags(updateFlags bool) *ExecutionParams {
 	return p
 }
 
-func (a *Alu) Execute(executionParams ExecutionParams) (isa.MachineWord, BitFlags) {
+// Execute treats inputs as signed 32-bit words. The result is truncated to 32 bits,
+// while flags are computed from the exact result against the configured word width.
+func (a *Alu) Execute(executionParams ExecutionParams) (uint32, BitFlags) {
 	if a.operation2func[executionParams.operation] == nil {
 		panic("unknown operation")
 	}
-	output := a.operation2func[executionParams.operation](executionParams.left.Value, executionParams.right.Value)
-	result := executionParams.left
-	result.Value = output
+	output := a.operation2func[executionParams.operation](toSigned(executionParams.left), toSigned(executionParams.right))
 	if executionParams.updateFlags {
 		a.setFlags(output)
 	}
-	return result, a.bitFlags
+	return uint32(output), a.bitFlags
+}
+
+func toSigned(word uint32) int {
+	return int(int32(word))
 }
@@ -0,0 +1,139 @@
+package machine
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultMaxInstructions = 1_000_000
+
+// Config describes the simulated machine. Zero values are replaced with defaults
+// derived from the isa package, so a config file only has to list what it changes.
+// Memory cells and registers always hold 32-bit words, WordWidth only sets the range for the carry flag.
+type Config struct {
+	MemorySize      int  `yaml:"memory_size,omitempty"`
+	AddrWidth       int  `yaml:"addr_width,omitempty"`
+	WordWidth       int  `yaml:"word_width,omitempty"`
+	StackBase       int  `yaml:"stack_base,omitempty"`
+	ResetVector     *int `yaml:"reset_vector,omitempty"`
+	MaxInstructions int  `yaml:"max_instructions,omitempty"`
+	MaxTicks        int  `yaml:"max_ticks,omitempty"`
+	// InstructionTiming adds extra execution ticks to the instructions with the given mnemonics
+	InstructionTiming map[string]int `yaml:"instruction_timing,omitempty"`
+	// DisableFastForward makes idle loops run tick by tick, e.g. for verification of full logs
+	DisableFastForward bool `yaml:"disable_fast_forward,omitempty"`
+	// CodeWrites sets what happens when the program writes into code outside of writable regions
+	CodeWrites CodeWritePolicy `yaml:"code_writes,omitempty"`
+}
+
+type CodeWritePolicy string
+
+const (
+	CodeWritesAllow CodeWritePolicy = "allow"
+	CodeWritesWarn  CodeWritePolicy = "warn"
+	CodeWritesFault CodeWritePolicy = "fault"
+)
+
+func DefaultConfig() Config {
+	return Config{}.WithDefaults()
+}
+
+func (c Config) WithDefaults() Config {
+	if c.AddrWidth == 0 {
+		c.AddrWidth = isa.AddrWidth
+	}
+	if c.WordWidth == 0 {
+		c.WordWidth = isa.WordWidth
+	}
+	if c.MemorySize == 0 {
+		c.MemorySize = 1 << c.AddrWidth
+	}
+	if c.StackBase == 0 {
+		c.StackBase = c.MemorySize
+	}
+	if c.MaxInstructions == 0 {
+		c.MaxInstructions = DefaultMaxInstructions
+	}
+	if c.CodeWrites == "" {
+		c.CodeWrites = CodeWritesAllow
+	}
+	return c
+}
+
+func (c Config) Validate() error {
+	if c.WordWidth < 2 || c.WordWidth > isa.WordWidth {
+		return fmt.Errorf("word width must be in range [2, %d], got %d", isa.WordWidth, c.WordWidth)
+	}
+	// addresses wider than the address field of an instruction can't be encoded
+	if c.AddrWidth < 1 || c.AddrWidth > isa.AddrWidth {
+		return fmt.Errorf("address width must be in range [1, %d], got %d", isa.AddrWidth, c.AddrWidth)
+	}
+	if c.MemorySize < 1 || c.MemorySize > 1<<c.AddrWidth {
+		return fmt.Errorf("memory size must be in range [1, %d], got %d", 1<<c.AddrWidth, c.MemorySize)
+	}
+	if c.StackBase < 1 || c.StackBase > c.MemorySize {
+		return fmt.Errorf("stack base must be in range [1, %d], got %d", c.MemorySize, c.StackBase)
+	}
+	if c.ResetVector != nil && (*c.ResetVector < 0 || *c.ResetVector >= c.MemorySize) {
+		return fmt.Errorf("reset vector %d is outside of memory", *c.ResetVector)
+	}
+	if c.MaxInstructions < 0 {
+		return fmt.Errorf("instructions limit must not be negative, got %d", c.MaxInstructions)
+	}
+	if c.MaxTicks < 0 {
+		return fmt.Errorf("ticks limit must not be negative, got %d", c.MaxTicks)
+	}
+	switch c.CodeWrites {
+	case CodeWritesAllow, CodeWritesWarn, CodeWritesFault:
+	default:
+		return fmt.Errorf("code writes policy must be one of allow, warn, fault, got '%s'", c.CodeWrites)
+	}
+	for mnemonic, ticks := range c.InstructionTiming {
+		if _, err := isa.GetOpcodeFromString(mnemonic); err != nil {
+			return fmt.Errorf("instruction timing: %w", err)
+		}
+		if ticks < 0 {
+			return fmt.Errorf("instruction timing for '%s' must not be negative, got %d", mnemonic, ticks)
+		}
+	}
+	return nil
+}
+
+func (c Config) wordMaxValue() int {
+	return 1<<(c.WordWidth-1) - 1
+}
+
+func (c Config) wordMinValue() int {
+	return -1 << (c.WordWidth - 1)
+}
+
+func (c Config) extraTicks() map[isa.Opcode]int {
+	extraTicks := make(map[isa.Opcode]int)
+	for mnemonic, ticks := range c.InstructionTiming {
+		opcode, err := isa.GetOpcodeFromString(mnemonic)
+		if err != nil {
+			panic(err)
+		}
+		extraTicks[opcode] = ticks
+	}
+	return extraTicks
+}
+
+// ReadConfig reads a YAML (or JSON, which is a subset of YAML) machine configuration.
+func ReadConfig(input io.Reader) (Config, error) {
+	var config Config
+	decoder := yaml.NewDecoder(input)
+	decoder.KnownFields(true)
+	err := decoder.Decode(&config)
+	if err != nil && err != io.EOF {
+		return Config{}, err
+	}
+	config = config.WithDefaults()
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
@@ -0,0 +1,82 @@
+package machine
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReadConfig(t *testing.T) {
+	config, err := ReadConfig(strings.NewReader("addr_width: 8\ninstruction_timing:\n  mod: 4\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, config.AddrWidth, 8)
+	assert.Equal(t, config.MemorySize, 256)
+	assert.Equal(t, config.StackBase, 256)
+	assert.Equal(t, config.WordWidth, 32)
+	assert.Equal(t, config.MaxInstructions, DefaultMaxInstructions)
+	assert.Equal(t, config.InstructionTiming["mod"], 4)
+}
+
+func TestReadConfigJson(t *testing.T) {
+	config, err := ReadConfig(strings.NewReader(`{"memory_size": 1024, "reset_vector": 16}`))
+	assert.NilError(t, err)
+	assert.Equal(t, config.MemorySize, 1024)
+	assert.Equal(t, *config.ResetVector, 16)
+}
+
+func TestReadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		error string
+	}{
+		{name: "memory larger than address space", input: "addr_width: 4\nmemory_size: 32", error: "memory size must be in range [1, 16], got 32"},
+		{name: "address wider than instruction field", input: "addr_width: 12", error: "address width must be in range [1, 11], got 12"},
+		{name: "stack outside of memory", input: "stack_base: 4096", error: "stack base must be in range [1, 2048], got 4096"},
+		{name: "unknown opcode timing", input: "instruction_timing: {mul: 2}", error: "instruction timing: unknown opcode: 'mul'"},
+		{name: "unknown field", input: "memory: 10", error: "yaml: unmarshal errors:\n  line 1: field memory not found in type machine.Config"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadConfig(strings.NewReader(test.input))
+			assert.Error(t, err, test.error)
+		})
+	}
+}
+
+func TestSimulationWithSmallMemory(t *testing.T) {
+	config, err := ReadConfig(strings.NewReader("memory_size: 64\nstack_base: 40\n"))
+	assert.NilError(t, err)
+	source := `out_port: word: 2
+value: word: 7
+start: ld value
+  push
+  cla
+  pop
+  out out_port
+  hlt`
+	output, log, err := runWithLog(t, config, source)
+	assert.NilError(t, err)
+	assert.Equal(t, output, "7")
+	assert.Assert(t, strings.Contains(log, "SP: 39"), log)
+}
+
+// addresses beyond the memory are errors, they don't wrap around to the beginning
+func TestAccessBeyondSmallMemory(t *testing.T) {
+	config, err := ReadConfig(strings.NewReader("memory_size: 64\n"))
+	assert.NilError(t, err)
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{source: "value: word: 7\nstart: ld 100\n  hlt", expected: "instruction at 1: address 100 is outside of memory of size 64"},
+		{source: "value: word: 7\nstart: ld value\n  st 64\n  hlt", expected: "instruction at 2: address 64 is outside of memory of size 64"},
+		{source: "start: jmp 70", expected: "instruction at 70: address 70 is outside of memory of size 64"},
+		{source: "start: hlt\n  org 80\nfar: word: 1", expected: "is placed at 80, outside of memory of size 64"},
+	}
+	for _, test := range tests {
+		_, _, err := runWithLog(t, config, test.source)
+		assert.ErrorContains(t, err, test.expected, test.source)
+	}
+}
@@ -24,33 +24,100 @@ func (e *ControlUnitError) Error() string {
 	return e.message
 }
 
+// CodeWriteError is returned when the program writes into protected code and the config forbids it
+type CodeWriteError struct {
+	Address       int
+	WriterAddress int
+	Lines         []isa.TermMetaInfo
+}
+
+func (e *CodeWriteError) Error() string {
+	message := fmt.Sprintf("write into code at %d by instruction at %d", e.Address, e.WriterAddress)
+	for _, line := range e.Lines {
+		message += fmt.Sprintf(" (line %s: '%s')", line.Position(), line.OriginalContent)
+	}
+	return message
+}
+
 type ControlUnit struct {
 	program  isa.Program
 	dataPath *DataPath
+	config   Config
+
+	// protectedCode marks addresses of instructions outside of writable regions
+	protectedCode      []bool
+	codeWriteError     error
+	instructionAddress int
+
+	extraTicks map[isa.Opcode]int
 
 	ExecutedInstructions int
 	clock                *Clock
 
+	loop        *loopSnapshot
+	instruction Instruction
+
 	stateOutput io.Writer
 }
 
-const MaxInstructions = 1_000_000
-
-func NewControlUnit(program isa.Program, dataPath *DataPath, stateOutput io.Writer, clock *Clock) *ControlUnit {
-	mapMemory(dataPath, program.Instructions)
-	return &ControlUnit{program: program, dataPath: dataPath, stateOutput: stateOutput, clock: clock}
+func NewControlUnit(config Config, program isa.Program, dataPath *DataPath, stateOutput io.Writer, clock *Clock) (*ControlUnit, error) {
+	if err := mapMemory(dataPath, program.Instructions); err != nil {
+		return nil, err
+	}
+	return &ControlUnit{
+		program:       program,
+		dataPath:      dataPath,
+		config:        config,
+		protectedCode: findProtectedCode(config, program.Instructions),
+		extraTicks:    config.extraTicks(),
+		stateOutput:   stateOutput,
+		clock:         clock,
+	}, nil
+}
+
+func findProtectedCode(config Config, instructions []isa.MachineCodeTerm) []bool {
+	protectedCode := make([]bool, config.MemorySize)
+	if config.CodeWrites == CodeWritesAllow {
+		return protectedCode
+	}
+	for _, instruction := range instructions {
+		protectedCode[instruction.Index] = !isa.IsConstant(instruction) && !instruction.Writable
+	}
+	return protectedCode
 }
 
-func mapMemory(dataPath *DataPath, instructions []isa.MachineCodeTerm) {
+func mapMemory(dataPath *DataPath, instructions []isa.MachineCodeTerm) error {
 	for _, instruction := range instructions {
-		instructionWord := isa.NewMemoryWord(instruction)
+		if instruction.Index < 0 || instruction.Index >= len(dataPath.memory) {
+			return fmt.Errorf("instruction at line %s is placed at %d, outside of memory of size %d", instruction.TermInfo.Position(), instruction.Index, len(dataPath.memory))
+		}
+		instructionWord, err := isa.EncodeTerm(instruction)
+		if err != nil {
+			return fmt.Errorf("instruction at line %s isn't encoded: %w", instruction.TermInfo.Position(), err)
+		}
 		dataPath.memory[instruction.Index] = instructionWord
 	}
+	return nil
+}
+
+// Instruction is the content of CR decoded by the control unit
+type Instruction struct {
+	Opcode  isa.Opcode
+	Mode    isa.ValueType
+	Address int
+}
+
+func decodeInstruction(word uint32) (Instruction, error) {
+	opcode, mode, address, err := isa.DecodeInstruction(word)
+	if err != nil {
+		return Instruction{}, err
+	}
+	return Instruction{Opcode: opcode, Mode: mode, Address: address}, nil
 }
 
 type SingleTickOperation func()
 
-func (cu *ControlUnit) SigLatchRegFunc(register Register, value isa.MachineWord) func() {
+func (cu *ControlUnit) SigLatchRegFunc(register Register, value uint32) func() {
 	return func() {
 		cu.dataPath.SigLatchRegister(register, value)
 	}
@@ -58,37 +125,81 @@ func (cu *ControlUnit) SigLatchRegFunc(register Register, value isa.MachineWord)
 
 func (cu *ControlUnit) SigWriteMemoryFunc() func() {
 	return func() {
+		address, err := cu.dataPath.memoryIndex(cu.GetReg(AR))
+		if err == nil && cu.protectedCode[address] {
+			codeWriteError := &CodeWriteError{Address: address, WriterAddress: cu.instructionAddress, Lines: cu.sourceLines(address, address)}
+			if cu.config.CodeWrites == CodeWritesFault {
+				cu.codeWriteError = codeWriteError
+				return
+			}
+			if _, err := fmt.Fprintf(cu.stateOutput, "warning: %s\n", codeWriteError); err != nil {
+				fmt.Println(err)
+			}
+		}
 		cu.dataPath.WriteMemory()
 	}
 }
 
 func (cu *ControlUnit) SigReadMemoryFunc() func() {
-	return cu.SigLatchRegFunc(DR, cu.dataPath.ReadMemory(cu.GetReg(AR).Value))
+	return cu.SigLatchRegFunc(DR, cu.dataPath.ReadMemory(cu.GetReg(AR)))
 }
 
-func (cu *ControlUnit) GetReg(register Register) isa.MachineWord {
+func (cu *ControlUnit) GetReg(register Register) uint32 {
 	return cu.dataPath.GetRegister(register)
 }
 
 func (cu *ControlUnit) RunInstructionCycle() error {
-	for cu.ExecutedInstructions < MaxInstructions {
+	for cu.ExecutedInstructions < cu.config.MaxInstructions {
+		if cu.config.MaxTicks > 0 && cu.clock.GetCurrentTick() >= cu.config.MaxTicks {
+			return errors.New("ticks limit exceeded")
+		}
+		address := int(cu.GetReg(IP))
+		cu.instructionAddress = address
 		err := cu.DecodeAndExecuteInstruction()
+		if fault := cu.fault(); fault != nil {
+			return fault
+		}
 		if err != nil {
 			return err
 		}
-		cu.interruption()
+		opcode := cu.instruction.Opcode
+		cu.waitExtraTicks(opcode)
+		if err := cu.interruption(); err != nil {
+			return err
+		}
+		if fault := cu.fault(); fault != nil {
+			return fault
+		}
 		err = cu.dumpInstructionEnd()
 		if err != nil {
 			return err
 		}
 		cu.ExecutedInstructions++
+		if err := cu.checkIdleLoop(address, opcode); err != nil {
+			return err
+		}
 	}
 	return errors.New("instructions limit exceeded")
 }
 
+// fault is the error of a tick which stopped the instruction: a write into code or an access beyond the memory
+func (cu *ControlUnit) fault() error {
+	if cu.codeWriteError != nil {
+		return cu.codeWriteError
+	}
+	if cu.dataPath.accessError != nil {
+		return fmt.Errorf("instruction at %d: %w", cu.instructionAddress, cu.dataPath.accessError)
+	}
+	return nil
+}
+
 func (cu *ControlUnit) DecodeAndExecuteInstruction() error {
 	cu.InstructionFetch()
-	instruction := cu.GetReg(CR)
+	instruction, err := decodeInstruction(cu.GetReg(CR))
+	if err != nil {
+		return fmt.Errorf("failed to decode instruction %08X at %d: %w", cu.GetReg(CR), cu.GetReg(IP)-1, err)
+	}
+	cu.instruction = instruction
 	instructionType := instruction.Opcode.Type()
 
 	switch instructionType {
@@ -105,6 +216,12 @@ func (cu *ControlUnit) DecodeAndExecuteInstruction() error {
 	}
 }
 
+func (cu *ControlUnit) waitExtraTicks(opcode isa.Opcode) {
+	for i := 0; i < cu.extraTicks[opcode]; i++ {
+		cu.doInOneTick(fmt.Sprintf("%s: wait", opcode))
+	}
+}
+
 func (cu *ControlUnit) pushOnStack(register Register) {
 	cu.doInOneTick("SP - 1 -> SP",
 		cu.SigLatchRegFunc(SP, cu.dataPath.SigExecuteAluOp(*cu.aluDecrement(SP))),
@@ -130,7 +247,7 @@ func (cu *ControlUnit) popFromStack(target Register) {
 
 func (cu *ControlUnit) InstructionFetch() {
 	cu.doInOneTick("IP -> AR", cu.SigLatchRegFunc(AR, cu.dataPath.SigExecuteAluOp(*cu.aluRegisterPassThrough(IP))))
-	cu.doInOneTick("IP + 1 -> IP; mem[AR] -> DR", cu.SigLatchRegFunc(IP, cu.dataPath.SigExecuteAluOp(*cu.aluIncrement(IP))), cu.SigLatchRegFunc(DR, cu.dataPath.ReadMemory(cu.GetReg(AR).Value)))
+	cu.doInOneTick("IP + 1 -> IP; mem[AR] -> DR", cu.SigLatchRegFunc(IP, cu.dataPath.SigExecuteAluOp(*cu.aluIncrement(IP))), cu.SigLatchRegFunc(DR, cu.dataPath.ReadMemory(cu.GetReg(AR))))
 	cu.doInOneTick("DR -> CR", cu.SigLatchRegFunc(CR, cu.dataPath.SigExecuteAluOp(*cu.aluRegisterPassThrough(DR))))
 }
 
@@ -141,14 +258,18 @@ func (cu *ControlUnit) AddressFetch() {
 
 func (cu *ControlUnit) OperandFetch() {
 	cu.doInOneTick("DR -> AR", cu.SigLatchRegFunc(AR, cu.dataPath.SigExecuteAluOp(*cu.aluRegisterPassThrough(DR))))
-	cu.doInOneTick("mem[AR] -> DR", cu.SigLatchRegFunc(DR, cu.dataPath.ReadMemory(cu.GetReg(AR).Value)))
+	cu.doInOneTick("mem[AR] -> DR", cu.SigLatchRegFunc(DR, cu.dataPath.ReadMemory(cu.GetReg(AR))))
 }
 
-func (cu *ControlUnit) decodeAndExecuteAddressInstruction(instruction isa.MachineWord) error {
-	if instruction.ValueType == isa.ValueTypeAddressIndirect {
+func (cu *ControlUnit) fetchOperand(instruction Instruction) {
+	if instruction.Mode == isa.ValueTypeAddressIndirect {
 		cu.AddressFetch()
 	}
 	cu.OperandFetch()
+}
+
+func (cu *ControlUnit) decodeAndExecuteAddressInstruction(instruction Instruction) error {
+	cu.fetchOperand(instruction)
 
 	opcode := instruction.Opcode
 	switch {
@@ -169,7 +290,7 @@ func (cu *ControlUnit) decodeAndExecuteAddressInstruction(instruction isa.Machin
 	return nil
 }
 
-func (cu *ControlUnit) decodeAndExecuteAddresslessInstruction(instruction isa.MachineWord) error {
+func (cu *ControlUnit) decodeAndExecuteAddresslessInstruction(instruction Instruction) error {
 	switch instruction.Opcode {
 	case isa.OpcodeHlt:
 		return NewControlUnitError("Halt")
@@ -185,10 +306,12 @@ func (cu *ControlUnit) decodeAndExecuteAddresslessInstruction(instruction isa.Ma
 		cu.doInOneTick("0 -> PS[EI]", cu.SigLatchRegFunc(PS, cu.dataPath.SigExecuteAluOp(*NewAluOp(AluOperationAnd).SetLeft(cu.GetReg(PS)).SetRightValue(^(StatusRegisterEnableInterruptBit)))))
 	case isa.OpcodeCla:
 		cu.doInOneTick("0 -> AC", func() {
-			cu.dataPath.SigLatchAC(cu.dataPath.SigExecuteAluOp(*cu.toAluOp(AC, 0, instruction.Opcode).UpdateFlags(true)), AccumulatorSelAlu)
+			cu.dataPath.SigLatchAC(cu.dataPath.SigExecuteAluOp(*NewAluOp(AluOperationRight).SetRightValue(0).UpdateFlags(true)), AccumulatorSelAlu)
 		})
 	case isa.OpcodeNop:
 		cu.doInOneTick("NOP", func() {})
+	case isa.OpcodeWait:
+		return cu.waitForInterrupt()
 	case isa.OpcodeInc:
 		cu.doInOneTick("AC + 1 -> AC", func() {
 			cu.dataPath.SigLatchAC(cu.dataPath.SigExecuteAluOp(*cu.aluIncrement(AC).UpdateFlags(true)), AccumulatorSelAlu)
@@ -203,7 +326,7 @@ func (cu *ControlUnit) decodeAndExecuteAddresslessInstruction(instruction isa.Ma
 	return nil
 }
 
-func (cu *ControlUnit) decodeAndExecuteBranchInstruction(instruction isa.MachineWord) error {
+func (cu *ControlUnit) decodeAndExecuteBranchInstruction(instruction Instruction) error {
 	flags := cu.dataPath.GetFlags()
 	opcode := instruction.Opcode
 
@@ -215,13 +338,32 @@ func (cu *ControlUnit) decodeAndExecuteBranchInstruction(instruction isa.Machine
 	return nil
 }
 
-func (cu *ControlUnit) interruption() {
+// waitForInterrupt fast-forwards the clock to the next external event, which is serviced after the instruction ends
+func (cu *ControlUnit) waitForInterrupt() error {
+	nextEvent, ok := cu.dataPath.nextEventTick()
+	if !ok || !cu.dataPath.IsInterruptEnabled() {
+		address := int(cu.GetReg(IP)) - 1
+		return &IdleError{From: address, To: address, Lines: cu.sourceLines(address, address)}
+	}
+	skipped := max(nextEvent-cu.clock.GetCurrentTick()-1, 0)
+	cu.clock.currentTick += skipped
+	cu.doInOneTick(fmt.Sprintf("WAIT: skipped %d ticks", skipped))
+	return nil
+}
+
+func (cu *ControlUnit) interruption() error {
 	for cu.dataPath.isInputReady() && cu.dataPath.IsInterruptEnabled() {
-		cu.processInterrupt()
+		if err := cu.processInterrupt(); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (cu *ControlUnit) processInterrupt() {
+func (cu *ControlUnit) processInterrupt() error {
+	cu.resetLoopDetection()
+	defer cu.resetLoopDetection()
+
 	cu.doInOneTick("0 -> PS[EI]",
 		cu.SigLatchRegFunc(PS, cu.dataPath.SigExecuteAluOp(*NewAluOp(AluOperationAnd).SetLeft(cu.GetReg(PS)).SetRightValue(^(StatusRegisterEnableInterruptBit)))))
 
@@ -236,7 +378,7 @@ func (cu *ControlUnit) processInterrupt() {
 	if err := cu.RunInstructionCycle(); err != nil {
 		var controlUnitError *ControlUnitError
 		if !errors.As(err, &controlUnitError) {
-			panic(err)
+			return err
 		}
 	}
 
@@ -244,14 +386,24 @@ func (cu *ControlUnit) processInterrupt() {
 	cu.popFromStack(IP)
 
 	cu.doInOneTick("1 -> PS[EI]", cu.SigLatchRegFunc(PS, cu.dataPath.SigExecuteAluOp(*NewAluOp(AluOperationOr).SetLeft(cu.GetReg(PS)).SetRightValue(StatusRegisterEnableInterruptBit))))
+	return nil
 }
 
-func (cu *ControlUnit) executeIOInstruction(instruction isa.MachineWord) error {
+func (cu *ControlUnit) executeIOInstruction(instruction Instruction) error {
+	cu.fetchOperand(instruction)
+	port := cu.GetReg(DR)
+
 	switch instruction.Opcode {
 	case isa.OpcodeIn:
+		if !cu.dataPath.isInputPort(port) {
+			return fmt.Errorf("no input device at port %d", port)
+		}
 		cu.doInOneTick("IN -> AC", func() { cu.dataPath.SigLatchAC(cu.GetReg(DR), AccumulatorSelInput) })
 	case isa.OpcodeOut:
-		cu.doInOneTick("AC -> OUT", cu.dataPath.SigWritePortOut)
+		if !cu.dataPath.isOutputPort(port) {
+			return fmt.Errorf("no output device at port %d", port)
+		}
+		cu.doInOneTick(fmt.Sprintf("AC -> OUT[%d]", port), func() { cu.dataPath.SigWritePortOut(port) })
 	default:
 		return fmt.Errorf("unknown IO instruction: %s", instruction.Opcode)
 	}
@@ -279,7 +431,7 @@ func (cu *ControlUnit) toAluOp(left Register, right Register, operation isa.Opco
 }
 
 func (cu *ControlUnit) PresetInstructionCounter(value int) {
-	cu.dataPath.SigLatchRegister(IP, isa.NewConstantNumber(value))
+	cu.dataPath.SigLatchRegister(IP, uint32(value))
 }
 
 func (cu *ControlUnit) doInOneTick(description string, singleTickOperation ...SingleTickOperation) {
@@ -348,7 +500,7 @@ func (cu *ControlUnit) formatRegistersState() string {
 	registers := []Register{AC, IP, CR, PS, SP, DR, AR}
 	for _, register := range registers {
 		value := cu.GetReg(register)
-		valueToPrint := fmt.Sprintf("%2d", value.Value)
+		valueToPrint := fmt.Sprintf("%2d", toSigned(value))
 		if register == CR {
 			valueToPrint = printInstruction(value)
 		}
@@ -357,32 +509,21 @@ func (cu *ControlUnit) formatRegistersState() string {
 	return strings.Join(strRegisters, ", ")
 }
 
-func (cu *ControlUnit) formatMemByAR(arRegister isa.MachineWord) string {
-	memContent := cu.dataPath.ReadMemory(arRegister.Value)
-
-	argument := fmt.Sprintf("%d", memContent.Value)
-	if isa.ValueTypeChar == memContent.ValueType {
-		if memContent.Value == 0 {
-			argument = "0"
-		} else {
-			argument = fmt.Sprintf("'%c'", memContent.Value)
-		}
-	}
-
-	if memContent.Opcode == isa.OpcodeNop {
-		return argument
-	}
-
-	if memContent.ValueType == isa.ValueTypeNone {
-		return memContent.Opcode.String()
+func (cu *ControlUnit) formatMemByAR(arRegister uint32) string {
+	index, err := cu.dataPath.memoryIndex(arRegister)
+	if err != nil {
+		return "-"
 	}
-
-	return fmt.Sprintf("%s %s", memContent.Opcode, argument)
+	return fmt.Sprintf("%d", toSigned(cu.dataPath.memory[index]))
 }
 
-func printInstruction(word isa.MachineWord) string {
-	if word.ValueType != isa.ValueTypeNone {
-		return fmt.Sprintf("%3s %d", word.Opcode, word.Value)
+func printInstruction(word uint32) string {
+	instruction, err := decodeInstruction(word)
+	if err != nil {
+		return fmt.Sprintf("%08X", word)
+	}
+	if instruction.Mode != isa.ValueTypeNone {
+		return fmt.Sprintf("%3s %d", instruction.Opcode, instruction.Address)
 	}
-	return fmt.Sprintf("%5s", word.Opcode)
+	return fmt.Sprintf("%5s", instruction.Opcode)
 }
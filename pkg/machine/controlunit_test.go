@@ -0,0 +1,107 @@
+package machine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+	"gotest.tools/v3/assert"
+)
+
+const patchingProgram = `out_port: word: 1
+letter_a: word: 'A'
+letter_b: word: 'B'
+first_addr: word: first
+second_addr: word: second
+
+start: ld patch
+  sub first_addr
+  add second_addr
+  st patch
+  patch: jmp first
+  first: ld letter_a
+    out out_port
+    hlt
+  second: ld letter_b
+    out out_port
+    hlt`
+
+func runWithLog(t *testing.T, config Config, source string) (string, string, error) {
+	t.Helper()
+	program, err := translator.NewTranslator().Translate(source)
+	assert.NilError(t, err)
+	output := bytes.NewBuffer([]byte{})
+	log := bytes.NewBuffer([]byte{})
+	err = RunSimulation(config, nil, program, output, log)
+	return output.String(), log.String(), err
+}
+
+func TestCodeWritesAllowed(t *testing.T) {
+	output, log, err := runWithLog(t, DefaultConfig(), patchingProgram)
+	assert.NilError(t, err)
+	assert.Equal(t, output, "B")
+	assert.Assert(t, !bytes.Contains([]byte(log), []byte("warning")))
+}
+
+func TestCodeWritesWarn(t *testing.T) {
+	config := DefaultConfig()
+	config.CodeWrites = CodeWritesWarn
+	output, log, err := runWithLog(t, config, patchingProgram)
+	assert.NilError(t, err)
+	assert.Equal(t, output, "B")
+	assert.Assert(t, bytes.Contains([]byte(log), []byte("warning: write into code at 11 by instruction at 10")), log)
+}
+
+func TestCodeWritesFault(t *testing.T) {
+	config := DefaultConfig()
+	config.CodeWrites = CodeWritesFault
+	output, _, err := runWithLog(t, config, patchingProgram)
+
+	var codeWriteError *CodeWriteError
+	assert.Assert(t, errors.As(err, &codeWriteError), "expected code write error, got: %v", err)
+	assert.Equal(t, output, "")
+	assert.Equal(t, codeWriteError.Address, 11)
+	assert.Equal(t, codeWriteError.WriterAddress, 10)
+	assert.Equal(t, codeWriteError.Lines[0].OriginalContent, "patch: jmp first")
+}
+
+func TestCodeWritesIntoWritableRegion(t *testing.T) {
+	config := DefaultConfig()
+	config.CodeWrites = CodeWritesFault
+	source := `value: word: 5
+start: ld value
+  st patch
+  writable
+  patch: nop
+  endwritable
+  hlt`
+	_, _, err := runWithLog(t, config, source)
+	assert.NilError(t, err)
+}
+
+func TestClaClearsAccumulator(t *testing.T) {
+	source := `out_port: word: 1
+five: word: 5
+letter_a: word: 'A'
+start: ld five
+  cla
+  jnz skip
+  add letter_a
+  out out_port
+  skip: hlt`
+	output, _, err := runWithLog(t, DefaultConfig(), source)
+	assert.NilError(t, err)
+	assert.Equal(t, output, "A")
+}
+
+func TestOperandOutOfRangeIsError(t *testing.T) {
+	operand := isa.AddrMaxValue + 1
+	program := isa.Program{Instructions: []isa.MachineCodeTerm{
+		{Index: 0, Opcode: isa.OpcodeJmp, Operand: &operand, OperandType: isa.ValueTypeAddressDirect, TermInfo: isa.TermMetaInfo{LineNum: 3}},
+	}}
+	err := RunSimulation(DefaultConfig(), nil, program, io.Discard, io.Discard)
+	assert.Error(t, err, "instruction at line 3 isn't encoded: operand 2048 of JMP at 0 doesn't fit in 11 bits")
+}
@@ -61,48 +61,74 @@ const (
 	AccumulatorSelAlu
 )
 
+// Ports of the IO devices. The port number is read from the operand of IN and OUT
+const (
+	PortInput        = 0
+	PortCharOutput   = 1
+	PortNumberOutput = 2
+)
+
 type DataPath struct {
 	inputBuffer  []isa.IoData
 	outputBuffer io.Writer
-	registers    map[Register]isa.MachineWord
-	memory       []isa.MachineWord
+	registers    map[Register]uint32
+	memory       []uint32
+	memoryWrites int
+	// outputWrites counts writes to output ports, output is progress for idle loop detection
+	outputWrites int
+	addressMask  uint32
+	// accessError is the first access beyond the memory, which may be smaller than the address space
+	accessError error
 
 	clock TickProvider
 
 	Alu *Alu
 }
 
-func NewDataPath(dataInput []isa.IoData, output io.Writer, clock TickProvider) *DataPath {
-	registers := make(map[Register]isa.MachineWord)
+func NewDataPath(config Config, dataInput []isa.IoData, output io.Writer, clock TickProvider) *DataPath {
+	registers := make(map[Register]uint32)
 	for _, register := range []Register{AC, IP, CR, PS, SP, DR, AR} {
-		registers[register] = isa.NewConstantNumber(0)
+		registers[register] = 0
+	}
+	registers[SP] = uint32(config.StackBase)
+	memory := make([]uint32, config.MemorySize)
+	alu := NewAlu(config)
+	return &DataPath{
+		inputBuffer:  dataInput,
+		outputBuffer: output,
+		memory:       memory,
+		registers:    registers,
+		addressMask:  1<<config.AddrWidth - 1,
+		Alu:          alu,
+		clock:        clock,
 	}
-	registers[SP] = isa.NewConstantNumber(isa.AddrMaxValue + 1)
-	memory := make([]isa.MachineWord, isa.AddrMaxValue+1)
-	alu := NewAlu()
-	return &DataPath{inputBuffer: dataInput, outputBuffer: output, memory: memory, registers: registers, Alu: alu, clock: clock}
 }
 
 func (dp *DataPath) GetFlags() BitFlags {
 	return BitFlags{
-		Zero:             dp.registers[PS].Value&StatusRegisterZeroBit > 0,
-		Negative:         dp.registers[PS].Value&StatusRegisterNegativeBit > 0,
-		Carry:            dp.registers[PS].Value&StatusRegisterCarryBit > 0,
-		EnableInterrupts: dp.registers[PS].Value&StatusRegisterEnableInterruptBit > 0,
+		Zero:             dp.registers[PS]&StatusRegisterZeroBit > 0,
+		Negative:         dp.registers[PS]&StatusRegisterNegativeBit > 0,
+		Carry:            dp.registers[PS]&StatusRegisterCarryBit > 0,
+		EnableInterrupts: dp.registers[PS]&StatusRegisterEnableInterruptBit > 0,
 	}
 }
 
 func (dp *DataPath) IsInterruptEnabled() bool {
-	return dp.registers[PS].Value&StatusRegisterEnableInterruptBit > 0
+	return dp.registers[PS]&StatusRegisterEnableInterruptBit > 0
 }
 
-func (dp *DataPath) SigLatchRegister(register Register, value isa.MachineWord) {
+// SigLatchRegister latches a word into the register. IP and AR are only as wide as an address,
+// so they keep the address part of the word.
+func (dp *DataPath) SigLatchRegister(register Register, value uint32) {
+	if register == IP || register == AR {
+		value &= dp.addressMask
+	}
 	dp.registers[register] = value
 }
 
-func (dp *DataPath) SigLatchAC(aluData isa.MachineWord, sel AccumulatorSel) {
+func (dp *DataPath) SigLatchAC(aluData uint32, sel AccumulatorSel) {
 	if sel == AccumulatorSelInput {
-		dp.registers[AC] = isa.NewMemoryWordFromIO(dp.inputBuffer[0])
+		dp.registers[AC] = uint32(dp.inputBuffer[0].Char[0])
 		dp.inputBuffer = dp.inputBuffer[1:]
 	} else {
 		dp.registers[AC] = aluData
@@ -113,54 +139,109 @@ func (dp *DataPath) isInputReady() bool {
 	return len(dp.inputBuffer) > 0 && dp.inputBuffer[0].ArrivesAt <= dp.clock.GetCurrentTick()
 }
 
-func (dp *DataPath) SigWritePortOut() {
+// hasPendingEvents reports whether an external event may still interrupt the program
+func (dp *DataPath) hasPendingEvents() bool {
+	return len(dp.inputBuffer) > 0 && dp.IsInterruptEnabled()
+}
+
+// nextEventTick returns the tick at which the next external event arrives
+func (dp *DataPath) nextEventTick() (int, bool) {
+	if len(dp.inputBuffer) == 0 {
+		return 0, false
+	}
+	return dp.inputBuffer[0].ArrivesAt, true
+}
+
+func (dp *DataPath) isInputPort(port uint32) bool {
+	return port == PortInput
+}
+
+func (dp *DataPath) isOutputPort(port uint32) bool {
+	return port == PortCharOutput || port == PortNumberOutput
+}
+
+func (dp *DataPath) SigWritePortOut(port uint32) {
 	ac := dp.registers[AC]
-	if ac.ValueType == isa.ValueTypeChar || ac.Value == 10 {
-		if _, err := dp.outputBuffer.Write([]byte{byte(ac.Value)}); err != nil {
-			panic(err)
-		}
+	var output []byte
+	if port == PortCharOutput {
+		output = []byte{byte(ac)}
 	} else {
-		if _, err := dp.outputBuffer.Write([]byte(fmt.Sprintf("%d", ac.Value))); err != nil {
-			panic(err)
-		}
+		output = []byte(fmt.Sprintf("%d", int32(ac)))
 	}
+	if _, err := dp.outputBuffer.Write(output); err != nil {
+		panic(err)
+	}
+	dp.outputWrites++
 }
 
-func (dp *DataPath) GetRegister(register Register) isa.MachineWord {
+func (dp *DataPath) GetRegister(register Register) uint32 {
 	return dp.registers[register]
 }
 
-func (dp *DataPath) ReadMemory(address int) isa.MachineWord {
-	return dp.memory[address]
+type MemoryAccessError struct {
+	Address int
+	Size    int
+}
+
+func (e *MemoryAccessError) Error() string {
+	return fmt.Sprintf("address %d is outside of memory of size %d", e.Address, e.Size)
+}
+
+func (dp *DataPath) memoryIndex(address uint32) (int, error) {
+	index := int(address & dp.addressMask)
+	if index >= len(dp.memory) {
+		return 0, &MemoryAccessError{Address: index, Size: len(dp.memory)}
+	}
+	return index, nil
+}
+
+// ReadMemory reads 0 beyond the memory and keeps the error for the control unit
+func (dp *DataPath) ReadMemory(address uint32) uint32 {
+	index, err := dp.memoryIndex(address)
+	if err != nil {
+		dp.failAccess(err)
+		return 0
+	}
+	return dp.memory[index]
 }
 
 func (dp *DataPath) WriteMemory() {
-	dp.memory[dp.GetRegister(AR).Value] = dp.GetRegister(DR)
+	index, err := dp.memoryIndex(dp.GetRegister(AR))
+	if err != nil {
+		dp.failAccess(err)
+		return
+	}
+	dp.memory[index] = dp.GetRegister(DR)
+	dp.memoryWrites++
+}
+
+func (dp *DataPath) failAccess(err error) {
+	if dp.accessError == nil {
+		dp.accessError = err
+	}
 }
 
-func (dp *DataPath) SigExecuteAluOp(aluParams ExecutionParams) isa.MachineWord {
+func (dp *DataPath) SigExecuteAluOp(aluParams ExecutionParams) uint32 {
 	result, bitFlags := dp.Alu.Execute(aluParams)
-	oldPs := dp.registers[PS]
-	oldPs.Value = updatePsWithBitFlags(oldPs.Value, bitFlags)
-	dp.registers[PS] = oldPs
+	dp.registers[PS] = updatePsWithBitFlags(dp.registers[PS], bitFlags)
 	return result
 }
 
-func updatePsWithBitFlags(oldPs int, bitFlags BitFlags) int {
+func updatePsWithBitFlags(oldPs uint32, bitFlags BitFlags) uint32 {
 	if bitFlags.Carry {
 		oldPs |= StatusRegisterCarryBit
 	} else {
-		oldPs &= ^StatusRegisterCarryBit
+		oldPs &= ^uint32(StatusRegisterCarryBit)
 	}
 	if bitFlags.Zero {
 		oldPs |= StatusRegisterZeroBit
 	} else {
-		oldPs &= ^StatusRegisterZeroBit
+		oldPs &= ^uint32(StatusRegisterZeroBit)
 	}
 	if bitFlags.Negative {
 		oldPs |= StatusRegisterNegativeBit
 	} else {
-		oldPs &= ^StatusRegisterNegativeBit
+		oldPs &= ^uint32(StatusRegisterNegativeBit)
 	}
 	return oldPs
 }
@@ -0,0 +1,141 @@
+package machine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// IdleError is returned when the program spins in a loop that can't be left:
+// machine state doesn't change between iterations, the loop doesn't output and no external event can arrive.
+type IdleError struct {
+	From  int
+	To    int
+	Lines []isa.TermMetaInfo
+}
+
+func (e *IdleError) Error() string {
+	message := fmt.Sprintf("idle forever: loop at [%d, %d] doesn't change state and no external events are expected", e.From, e.To)
+	for _, line := range e.Lines {
+		message += fmt.Sprintf("\n  %4s: %s", line.Position(), line.OriginalContent)
+	}
+	return message
+}
+
+type loopSnapshot struct {
+	head         int
+	from         int
+	to           int
+	ac           uint32
+	ps           uint32
+	sp           uint32
+	memoryWrites int
+	outputWrites int
+	inputLength  int
+	tick         int
+	instructions int
+}
+
+func (cu *ControlUnit) takeLoopSnapshot(head int) *loopSnapshot {
+	return &loopSnapshot{
+		head:         head,
+		from:         -1,
+		to:           -1,
+		ac:           cu.GetReg(AC),
+		ps:           cu.GetReg(PS),
+		sp:           cu.GetReg(SP),
+		memoryWrites: cu.dataPath.memoryWrites,
+		outputWrites: cu.dataPath.outputWrites,
+		inputLength:  len(cu.dataPath.inputBuffer),
+		tick:         cu.clock.GetCurrentTick(),
+		instructions: cu.ExecutedInstructions,
+	}
+}
+
+func (s *loopSnapshot) sameState(other *loopSnapshot) bool {
+	return s.head == other.head && s.ac == other.ac && s.ps == other.ps && s.sp == other.sp &&
+		s.memoryWrites == other.memoryWrites && s.outputWrites == other.outputWrites && s.inputLength == other.inputLength
+}
+
+func (s *loopSnapshot) visit(address int) {
+	if s.from == -1 || address < s.from {
+		s.from = address
+	}
+	if address > s.to {
+		s.to = address
+	}
+}
+
+// checkIdleLoop is called after each instruction. On every taken backward branch it compares machine state
+// with the state at the previous iteration of the same loop. Idle loops are either reported or fast-forwarded
+// to the next external event.
+func (cu *ControlUnit) checkIdleLoop(address int, opcode isa.Opcode) error {
+	if cu.loop != nil {
+		cu.loop.visit(address)
+	}
+	head := int(cu.GetReg(IP))
+	if opcode.Type() != isa.OpcodeTypeBranch || head > address {
+		return nil
+	}
+
+	snapshot := cu.takeLoopSnapshot(head)
+	if cu.loop == nil || !cu.loop.sameState(snapshot) {
+		cu.loop = snapshot
+		return nil
+	}
+	if !cu.dataPath.hasPendingEvents() {
+		return &IdleError{From: cu.loop.from, To: cu.loop.to, Lines: cu.sourceLines(cu.loop.from, cu.loop.to)}
+	}
+	if !cu.config.DisableFastForward {
+		cu.fastForwardLoop(snapshot)
+	}
+	return nil
+}
+
+// fastForwardLoop skips whole iterations of an idle loop which end before the next external event arrives.
+// Loops which output aren't idle, so no output is skipped.
+// Every skipped iteration would take the same number of ticks and instructions, so counters stay exact.
+func (cu *ControlUnit) fastForwardLoop(snapshot *loopSnapshot) {
+	iterationTicks := snapshot.tick - cu.loop.tick
+	iterationInstructions := snapshot.instructions - cu.loop.instructions
+	nextEvent, _ := cu.dataPath.nextEventTick()
+
+	iterations := (nextEvent - 1 - snapshot.tick) / iterationTicks
+	iterations = min(iterations, (cu.config.MaxInstructions-snapshot.instructions)/iterationInstructions)
+	if cu.config.MaxTicks > 0 {
+		iterations = min(iterations, (cu.config.MaxTicks-snapshot.tick)/iterationTicks)
+	}
+	if iterations <= 0 {
+		cu.loop = snapshot
+		return
+	}
+
+	skippedTicks := iterations * iterationTicks
+	cu.clock.currentTick += skippedTicks - 1
+	cu.ExecutedInstructions += iterations * iterationInstructions
+	description := fmt.Sprintf("idle loop [%d, %d]: skipped %d ticks, %d iterations", cu.loop.from, cu.loop.to, skippedTicks, iterations)
+	if err := cu.dumpState(description); err != nil {
+		fmt.Println(err)
+	}
+	cu.tick()
+	if err := cu.dumpInstructionEnd(); err != nil {
+		fmt.Println(err)
+	}
+
+	cu.loop = cu.takeLoopSnapshot(snapshot.head)
+}
+
+func (cu *ControlUnit) resetLoopDetection() {
+	cu.loop = nil
+}
+
+func (cu *ControlUnit) sourceLines(from int, to int) []isa.TermMetaInfo {
+	lines := make([]isa.TermMetaInfo, 0)
+	for _, instruction := range cu.program.Instructions {
+		if instruction.Index >= from && instruction.Index <= to && strings.TrimSpace(instruction.TermInfo.OriginalContent) != "" {
+			lines = append(lines, instruction.TermInfo)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,166 @@
+package machine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"github.com/Moleus/comp-arch-lab3/pkg/translator"
+	"gotest.tools/v3/assert"
+)
+
+// catProgram sets flags from `flag` right before `iret`, so the spin loop sees them after return
+const catProgram = `vector: word: interrupt
+in_port: word: 0
+out_port: word: 1
+flag: word: 0
+line_feed: word: 10
+
+start: ei
+spin_loop: ld flag
+  jz spin_loop
+  hlt
+
+interrupt: in in_port
+  out out_port
+  cmp line_feed
+  jnz returning
+  ld flag
+  inc
+  st flag
+  returning: ld flag
+  iret`
+
+func runProgram(t *testing.T, config Config, source string, input []isa.IoData) (string, error) {
+	t.Helper()
+	program, err := translator.NewTranslator().Translate(source)
+	assert.NilError(t, err)
+	output := bytes.NewBuffer([]byte{})
+	err = RunSimulation(config, input, program, output, io.Discard)
+	return output.String(), err
+}
+
+func TestIdleLoopWithoutInput(t *testing.T) {
+	input := []isa.IoData{{ArrivesAt: 10, Char: "a"}, {ArrivesAt: 20, Char: "b"}}
+	output, err := runProgram(t, DefaultConfig(), catProgram, input)
+
+	var idleError *IdleError
+	assert.Assert(t, errors.As(err, &idleError), "expected idle error, got: %v", err)
+	assert.Equal(t, output, "ab")
+	assert.Equal(t, idleError.From, 6)
+	assert.Equal(t, idleError.To, 7)
+	assert.Equal(t, len(idleError.Lines), 2)
+	assert.Equal(t, idleError.Lines[0].OriginalContent, "spin_loop: ld flag")
+}
+
+func TestIdleLoopWithDisabledInterrupts(t *testing.T) {
+	source := `counter: word: 3
+start: ld counter
+loop: dec
+  jnz loop
+wait: jmp wait
+  hlt`
+	_, err := runProgram(t, DefaultConfig(), source, []isa.IoData{{ArrivesAt: 10, Char: "a"}})
+
+	var idleError *IdleError
+	assert.Assert(t, errors.As(err, &idleError), "expected idle error, got: %v", err)
+	assert.Equal(t, idleError.From, 4)
+	assert.Equal(t, idleError.To, 4)
+}
+
+func TestBusyLoopWithPendingInputIsNotIdle(t *testing.T) {
+	input := []isa.IoData{{ArrivesAt: 500, Char: "a"}, {ArrivesAt: 1000, Char: "\n"}}
+	output, err := runProgram(t, DefaultConfig(), catProgram, input)
+
+	assert.NilError(t, err)
+	assert.Equal(t, output, "a\n")
+}
+
+func TestWaitWithDisabledInterruptsIsIdle(t *testing.T) {
+	source := `start: nop
+  wait
+  hlt`
+	_, err := runProgram(t, DefaultConfig(), source, []isa.IoData{{ArrivesAt: 10, Char: "a"}})
+
+	var idleError *IdleError
+	assert.Assert(t, errors.As(err, &idleError), "expected idle error, got: %v", err)
+	assert.Equal(t, idleError.From, 1)
+	assert.Equal(t, idleError.Lines[0].OriginalContent, "wait")
+}
+
+func lastLogLine(log string) string {
+	lines := strings.Split(strings.TrimSpace(log), "\n")
+	return lines[len(lines)-1]
+}
+
+func TestFastForwardKeepsTicksExact(t *testing.T) {
+	program, err := translator.NewTranslator().Translate(catProgram)
+	assert.NilError(t, err)
+	input := []isa.IoData{{ArrivesAt: 1000, Char: "a"}, {ArrivesAt: 25_003, Char: "b"}, {ArrivesAt: 100_000, Char: "\n"}}
+
+	run := func(config Config) (string, string) {
+		output := bytes.NewBuffer([]byte{})
+		log := bytes.NewBuffer([]byte{})
+		err := RunSimulation(config, append([]isa.IoData{}, input...), program, output, log)
+		assert.NilError(t, err)
+		return output.String(), log.String()
+	}
+
+	fastConfig := DefaultConfig()
+	fastOutput, fastLog := run(fastConfig)
+	slowConfig := DefaultConfig()
+	slowConfig.DisableFastForward = true
+	slowOutput, slowLog := run(slowConfig)
+
+	assert.Equal(t, fastOutput, "ab\n")
+	assert.Equal(t, fastOutput, slowOutput)
+	assert.Equal(t, lastLogLine(fastLog), lastLogLine(slowLog))
+	assert.Assert(t, strings.Contains(fastLog, "idle loop [6, 7]: skipped"))
+	assert.Assert(t, len(fastLog)*100 < len(slowLog))
+}
+
+// output is progress, a printing loop runs until the instructions limit
+func TestPrintingLoopIsNotIdle(t *testing.T) {
+	source := `out_port: word: 1
+letter: word: 'A'
+start: ld letter
+loop: out out_port
+  jmp loop`
+	config := DefaultConfig()
+	config.MaxInstructions = 201
+	output, err := runProgram(t, config, source, nil)
+
+	assert.Error(t, err, "instructions limit exceeded")
+	assert.Equal(t, output, strings.Repeat("A", 100))
+}
+
+// iterations which output are never skipped, the output is the same as without fast-forward
+func TestFastForwardKeepsOutput(t *testing.T) {
+	source := `vector: word: interrupt
+in_port: word: 0
+out_port: word: 1
+letter: word: 'A'
+flag: word: 0
+start: ei
+loop: ld letter
+  out out_port
+  ld flag
+  jz loop
+  hlt
+interrupt: in in_port
+  st flag
+  iret`
+	input := []isa.IoData{{ArrivesAt: 1000, Char: "a"}}
+	fastOutput, err := runProgram(t, DefaultConfig(), source, append([]isa.IoData{}, input...))
+	assert.NilError(t, err)
+	slowConfig := DefaultConfig()
+	slowConfig.DisableFastForward = true
+	slowOutput, err := runProgram(t, slowConfig, source, append([]isa.IoData{}, input...))
+	assert.NilError(t, err)
+
+	assert.Assert(t, len(slowOutput) > 40, slowOutput)
+	assert.Equal(t, fastOutput, slowOutput)
+}
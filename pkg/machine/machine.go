@@ -2,6 +2,7 @@ package machine
 
 import (
 	"errors"
+	"fmt"
 	"github.com/Moleus/comp-arch-lab3/pkg/isa"
 	"io"
 	"log"
@@ -13,18 +14,33 @@ type Machine struct {
 type SimulationStatistics struct {
 }
 
-func RunSimulation(dataInput []isa.IoData, program isa.Program, dataPathOutput io.Writer, controlUnitStateOutput io.Writer) error {
+func RunSimulation(config Config, dataInput []isa.IoData, program isa.Program, dataPathOutput io.Writer, controlUnitStateOutput io.Writer) error {
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid machine config: %w", err)
+	}
+
 	clock := &Clock{currentTick: 0}
-	dataPath := NewDataPath(dataInput, dataPathOutput, clock)
-	controlUnit := NewControlUnit(program, dataPath, controlUnitStateOutput, clock)
+	dataPath := NewDataPath(config, dataInput, dataPathOutput, clock)
+	controlUnit, err := NewControlUnit(config, program, dataPath, controlUnitStateOutput, clock)
+	if err != nil {
+		return err
+	}
 
 	log.Println("starting simulation")
 
-	controlUnit.PresetInstructionCounter(controlUnit.program.StartAddress)
-	err := controlUnit.RunInstructionCycle()
+	startAddress := controlUnit.program.StartAddress
+	if config.ResetVector != nil {
+		startAddress = *config.ResetVector
+	}
+	controlUnit.PresetInstructionCounter(startAddress)
+	err = controlUnit.RunInstructionCycle()
 	var controlUnitError *ControlUnitError
+	var idleError *IdleError
 	if err == nil {
 		return errors.New("simulation should finish with HLT")
+	} else if errors.As(err, &idleError) {
+		log.Printf("simulation stopped in idle loop. Instructions executed: %d, ticks: %d", controlUnit.ExecutedInstructions, clock.GetCurrentTick())
+		return err
 	} else if !errors.As(err, &controlUnitError) {
 		return err
 	}
@@ -1,9 +1,29 @@
 package translator
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// splitParts splits a line into the first two words and the rest, words may be separated by any whitespace
+func splitParts(line string) []string {
+	parts := make([]string, 0, 3)
+	for len(parts) < 2 {
+		line = strings.TrimLeft(line, " \t")
+		end := strings.IndexAny(line, " \t")
+		if end == -1 {
+			break
+		}
+		parts = append(parts, line[:end])
+		line = line[end:]
+	}
+	return append(parts, strings.TrimSpace(line))
+}
 
 func isConstantDeclaration(parts []string) bool {
-	return hasLabel(parts) && parts[1] == "word:"
+	return len(parts) > 1 && hasLabel(parts) && parts[1] == "word:"
 }
 
 func hasLabel(parts []string) bool {
@@ -17,21 +37,40 @@ func addIndices(instructions []ParsedInstruction) []ParsedInstruction {
 	return instructions
 }
 
-func isNumber(value string) bool {
-	for _, char := range value {
-		if char < '0' || char > '9' {
-			return false
+func wrapInSlice(instruction ParsedInstruction, err error) ([]ParsedInstruction, error) {
+	instructions := make([]ParsedInstruction, 0)
+	instructions = append(instructions, instruction)
+	return instructions, err
+}
+
+// isIndirectAddressing checks that the whole operand is wrapped in parentheses, unlike `(a + b) * 2`
+func isIndirectAddressing(operand string) bool {
+	if !strings.HasPrefix(operand, "(") || !strings.HasSuffix(operand, ")") {
+		return false
+	}
+	depth := 0
+	for i, char := range operand {
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i != len(operand)-1 {
+				return false
+			}
 		}
 	}
 	return true
 }
 
-func wrapInSlice(instruction ParsedInstruction, err error) ([]ParsedInstruction, error) {
-	instructions := make([]ParsedInstruction, 0)
-	instructions = append(instructions, instruction)
-	return instructions, err
+func isStringLiteral(argument string) bool {
+	return len(argument) >= 2 && strings.HasPrefix(argument, "'") && strings.HasSuffix(argument, "'") && strings.Count(argument, "'") == 2
 }
 
-func isIndirectAddressing(label string) bool {
-	return strings.HasPrefix(label, "(") && strings.HasSuffix(label, ")")
+// checkOperandRange checks that operands of instructions are addresses, constants may be any word
+func checkOperandRange(instruction ParsedInstruction, operand int) error {
+	if instruction.Section == isa.SectionCode && (operand < 0 || operand > isa.AddrMaxValue) {
+		return fmt.Errorf("operand %d is out of address range [0, %d]", operand, isa.AddrMaxValue)
+	}
+	return nil
 }
@@ -0,0 +1,158 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// constantDefinition binds a name to an expression without emitting a term: `name equ expr`.
+// Constants defined with `set` may be redefined, every use sees the last definition above it.
+type constantDefinition struct {
+	expression expression
+	// position is the number of instructions parsed before the definition
+	position int
+	// address is the value of `*` in the expression in a program
+	address int
+	// sequence orders definitions, so that `set` can refer to the previous value of its name
+	sequence    int
+	redefinable bool
+	metaInfo    isa.TermMetaInfo
+}
+
+// unitScope tells how labels are resolved: to addresses in a program or to symbols in an object
+type unitScope struct {
+	resolveLabel func(name string) (value, error)
+	offsetOf     func(v value) (isa.SectionKind, int, bool)
+	// constantAddresses is false in objects, where `*` in constants belongs to no section
+	constantAddresses bool
+}
+
+// splitConstantDefinition splits `name equ expr` and `name set expr`
+func splitConstantDefinition(line string) (name string, keyword string, argument string, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return "", "", "", false
+	}
+	keyword = strings.ToLower(fields[1])
+	if keyword != "equ" && keyword != "set" {
+		return "", "", "", false
+	}
+	argument = strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+	argument = strings.TrimSpace(strings.TrimPrefix(argument, fields[1]))
+	return fields[0], keyword, argument, true
+}
+
+func (t *AsmTranslator) defineConstant(name string, keyword string, argument string, metaInfo isa.TermMetaInfo) error {
+	if !isSymbolName(name) {
+		return fmt.Errorf("invalid constant name '%s'", name)
+	}
+	name, err := t.qualifyName(name)
+	if err != nil {
+		return err
+	}
+	redefinable := keyword == "set"
+	if definitions, ok := t.constants[name]; ok && !(redefinable && definitions[0].redefinable) {
+		return fmt.Errorf("constant '%s' is already defined at line %s", name, definitions[0].metaInfo.Position())
+	}
+	parsed, err := t.parseScopedExpression(argument)
+	if err != nil {
+		return err
+	}
+	if t.constants == nil {
+		t.constants = make(map[string][]constantDefinition)
+	}
+	t.constants[name] = append(t.constants[name], constantDefinition{
+		expression:  parsed,
+		position:    len(t.instructions),
+		address:     t.currentIndex,
+		sequence:    t.constantCount,
+		redefinable: redefinable,
+		metaInfo:    metaInfo,
+	})
+	t.constantCount++
+	return nil
+}
+
+// findConstant returns the last definition above the position and before the sequence,
+// or the first one for forward references
+func (t *AsmTranslator) findConstant(name string, position int, sequence int) (constantDefinition, bool) {
+	definitions, ok := t.constants[name]
+	if !ok {
+		return constantDefinition{}, false
+	}
+	found := definitions[0]
+	for _, definition := range definitions {
+		if definition.position <= position && definition.sequence < sequence {
+			found = definition
+		}
+	}
+	return found, true
+}
+
+func (t *AsmTranslator) evaluate(operand expression, position int, address *value, scope unitScope) (value, error) {
+	return operand.evaluate(t.evaluationContext(position, t.constantCount, address, scope))
+}
+
+func (t *AsmTranslator) evaluationContext(position int, sequence int, address *value, scope unitScope) evaluationContext {
+	return evaluationContext{
+		address: address,
+		resolve: func(name string) (value, error) {
+			definition, ok := t.findConstant(name, position, sequence)
+			if !ok {
+				return scope.resolveLabel(name)
+			}
+			return t.evaluateConstant(name, definition, scope)
+		},
+		offsetOf: scope.offsetOf,
+	}
+}
+
+func (t *AsmTranslator) evaluateConstant(name string, definition constantDefinition, scope unitScope) (value, error) {
+	if t.evaluating[definition.sequence] {
+		return value{}, fmt.Errorf("constant '%s' is defined through itself", name)
+	}
+	if t.evaluating == nil {
+		t.evaluating = make(map[int]bool)
+	}
+	t.evaluating[definition.sequence] = true
+	defer delete(t.evaluating, definition.sequence)
+
+	var address *value
+	if scope.constantAddresses {
+		address = &value{number: definition.address}
+	}
+	return definition.expression.evaluate(t.evaluationContext(definition.position, definition.sequence, address, scope))
+}
+
+// checkConstantNames forbids labels which shadow constants
+func (t *AsmTranslator) checkConstantNames() {
+	for _, instruction := range t.instructions {
+		if _, ok := t.constants[instruction.Label]; ok && instruction.Label != "" {
+			t.report(newTermError(CodeConstant, fmt.Sprintf("'%s' is defined both as a label and a constant", instruction.Label), instruction.MetaInfo))
+		}
+	}
+}
+
+func (t *AsmTranslator) programScope() unitScope {
+	return unitScope{
+		resolveLabel: func(name string) (value, error) {
+			address, err := t.labelToAddress(name)
+			return value{number: address}, err
+		},
+		constantAddresses: true,
+	}
+}
+
+func isSymbolName(name string) bool {
+	if name == "" || !isLabelStart(name[0]) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isLabelChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package translator
+
+import (
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"gotest.tools/v3/assert"
+)
+
+func TestConstantDefinitions(t *testing.T) {
+	translator := NewTranslator()
+	program, err := translator.Translate(`PORT equ 2
+SIZE equ END - TABLE
+TWICE equ SIZE * 2
+step set 1
+table: word: TWICE
+start: ld table
+  out PORT + step
+step set 5
+  ld step
+  hlt
+HERE equ *
+END equ 10
+TABLE equ 4`)
+	assert.NilError(t, err)
+	assert.Equal(t, len(program.Instructions), 5)
+	assert.Equal(t, *program.Instructions[0].Operand, 12)
+	assert.Equal(t, *program.Instructions[2].Operand, 3)
+	assert.Equal(t, *program.Instructions[3].Operand, 5)
+
+	assert.DeepEqual(t, translator.GetSymbols(), []SymbolInfo{
+		{Name: "END", Kind: SymbolEqu, Value: 10, MetaInfo: isa.TermMetaInfo{LineNum: 12, OriginalContent: "END equ 10"}, References: 1},
+		{Name: "HERE", Kind: SymbolEqu, Value: 5, MetaInfo: isa.TermMetaInfo{LineNum: 11, OriginalContent: "HERE equ *"}},
+		{Name: "PORT", Kind: SymbolEqu, Value: 2, MetaInfo: isa.TermMetaInfo{LineNum: 1, OriginalContent: "PORT equ 2"}, References: 1},
+		{Name: "SIZE", Kind: SymbolEqu, Value: 6, MetaInfo: isa.TermMetaInfo{LineNum: 2, OriginalContent: "SIZE equ END - TABLE"}, References: 1},
+		{Name: "TABLE", Kind: SymbolEqu, Value: 4, MetaInfo: isa.TermMetaInfo{LineNum: 13, OriginalContent: "TABLE equ 4"}, References: 1},
+		{Name: "TWICE", Kind: SymbolEqu, Value: 12, MetaInfo: isa.TermMetaInfo{LineNum: 3, OriginalContent: "TWICE equ SIZE * 2"}, References: 1},
+		{Name: "start", Kind: SymbolLabel, Value: 1, MetaInfo: isa.TermMetaInfo{LineNum: 6, OriginalContent: "start: ld table"}},
+		{Name: "step", Kind: SymbolSet, Value: 5, MetaInfo: isa.TermMetaInfo{LineNum: 8, OriginalContent: "step set 5"}, References: 2},
+		{Name: "table", Kind: SymbolLabel, Value: 0, MetaInfo: isa.TermMetaInfo{LineNum: 5, OriginalContent: "table: word: TWICE"}, References: 1},
+	})
+}
+
+func TestRedefinedConstantRefersToPreviousValue(t *testing.T) {
+	program, err := NewTranslator().Translate(`n set 1
+n set n + 1
+first: word: n
+n set n * 10
+start: ld n
+  hlt`)
+	assert.NilError(t, err)
+	assert.Equal(t, *program.Instructions[0].Operand, 2)
+	assert.Equal(t, *program.Instructions[1].Operand, 20)
+}
+
+func TestConstantErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "A equ 1\nA equ 2\nstart: hlt", expected: "constant 'A' is already defined at line 1"},
+		{input: "A set 1\nA equ 2\nstart: hlt", expected: "constant 'A' is already defined at line 1"},
+		{input: "A equ B\nB equ A + 1\nstart: ld A", expected: "is defined through itself"},
+		{input: "start equ 1\nstart: hlt", expected: "'start' is defined both as a label and a constant"},
+		{input: "1x equ 1\nstart: hlt", expected: "invalid constant name '1x'"},
+		{input: "FAR equ 3000\nstart: ld FAR", expected: "operand 3000 is out of address range"},
+	}
+	for _, test := range tests {
+		_, err := NewTranslator().Translate(test.input)
+		assert.ErrorContains(t, err, test.expected, test.input)
+	}
+}
+
+func TestConstantsInObject(t *testing.T) {
+	object, err := NewTranslator().TranslateObject(`extern buffer
+OFFSET equ 3
+TARGET equ buffer + OFFSET
+start: ld TARGET
+  out OFFSET - 1
+HERE equ *
+  jmp HERE`)
+	assert.ErrorContains(t, err, "current address '*' is unknown here")
+
+	object, err = NewTranslator().TranslateObject(`extern buffer
+OFFSET equ 3
+TARGET equ buffer + OFFSET
+start: ld TARGET
+  out OFFSET - 1`)
+	assert.NilError(t, err)
+	assert.Equal(t, *object.Sections[0].Terms[1].Operand, 2)
+	assert.DeepEqual(t, object.Relocations, []isa.Relocation{
+		{Section: isa.SectionCode, Offset: 0, Symbol: "buffer", Addend: 3},
+	})
+	assert.Equal(t, len(object.Symbols), 1)
+}
@@ -0,0 +1,242 @@
+package translator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Codes of diagnostics, an error code starts with E and a warning code with W
+const (
+	CodeSyntax             = "E001"
+	CodeUnknownInstruction = "E002"
+	CodeDirective          = "E003"
+	CodeMacro              = "E004"
+	CodeLabel              = "E005"
+	CodeConstant           = "E006"
+	CodeOperand            = "E007"
+	CodeLayout             = "E008"
+	CodeUnusedLabel        = "W001"
+	CodeJumpIntoData       = "W002"
+	CodeLoadFromCode       = "W003"
+)
+
+var errUnknownInstruction = errors.New("unknown instruction or macro")
+
+// Diagnostic is an error or a warning found by the translator. Column is counted from 1 in the source line,
+// Length is the number of characters to underline
+type Diagnostic struct {
+	Severity  Severity `json:"severity"`
+	Code      string   `json:"code"`
+	Message   string   `json:"message"`
+	FileName  string   `json:"file,omitempty"`
+	Line      int      `json:"line,omitempty"`
+	Column    int      `json:"column,omitempty"`
+	Length    int      `json:"length,omitempty"`
+	Source    string   `json:"source,omitempty"`
+	Expansion string   `json:"expansion,omitempty"`
+}
+
+// ErrorList is returned when translation fails, it holds every error found
+type ErrorList []ParseError
+
+func (l ErrorList) Error() string {
+	messages := make([]string, 0, len(l))
+	for _, err := range l {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// GetDiagnostics returns errors and warnings ordered by their position in source files
+func (t *AsmTranslator) GetDiagnostics() []Diagnostic {
+	diagnostics := slices.Clone(t.diagnostics)
+	slices.SortStableFunc(diagnostics, func(a, b Diagnostic) int {
+		if a.FileName != b.FileName {
+			return strings.Compare(a.FileName, b.FileName)
+		}
+		return a.Line - b.Line
+	})
+	return diagnostics
+}
+
+// report saves the error and continues, so that all errors are shown at once
+func (t *AsmTranslator) report(err error) {
+	var parseError ParseError
+	if !errors.As(err, &parseError) {
+		parseError = ParseError{message: err.Error(), code: CodeSyntax}
+	}
+	if parseError.fileName == "" && parseError.line > 0 {
+		parseError.fileName = t.currentFile()
+	}
+	t.errors = append(t.errors, parseError)
+	t.diagnostics = append(t.diagnostics, t.newDiagnostic(SeverityError, parseError))
+}
+
+func (t *AsmTranslator) warn(code string, message string, metaInfo isa.TermMetaInfo) {
+	t.diagnostics = append(t.diagnostics, t.newDiagnostic(SeverityWarning, newTermError(code, message, metaInfo).(ParseError)))
+}
+
+// errorsFound ends a stage of translation, the next stages would report consequences of these errors
+func (t *AsmTranslator) errorsFound() error {
+	if len(t.errors) == 0 {
+		return nil
+	}
+	return ErrorList(t.errors)
+}
+
+func (t *AsmTranslator) newDiagnostic(severity Severity, err ParseError) Diagnostic {
+	diagnostic := Diagnostic{
+		Severity:  severity,
+		Code:      err.code,
+		Message:   err.message,
+		FileName:  err.fileName,
+		Line:      err.line,
+		Expansion: err.expansion,
+	}
+	lines := t.sources[err.fileName]
+	if err.line > 0 && err.line <= len(lines) {
+		diagnostic.Source = strings.TrimRight(lines[err.line-1], "\r")
+		diagnostic.Column, diagnostic.Length = locateColumn(diagnostic.Source, err.message)
+	}
+	return diagnostic
+}
+
+var quotedFragment = regexp.MustCompile(`'([^']+)'`)
+
+// locateColumn finds the first token quoted in the message in the source line, e.g. 'foo' of "label 'foo' not found".
+// Without such a token the whole statement is underlined.
+func locateColumn(source string, message string) (column int, length int) {
+	code := strings.Split(source, ";")[0]
+	for _, match := range quotedFragment.FindAllStringSubmatch(message, -1) {
+		fragment := match[1]
+		if index := strings.Index(code, fragment); index != -1 {
+			return index + 1, len(fragment)
+		}
+		// local labels are reported with the name of their scope
+		if dot := strings.LastIndex(fragment, "."); dot > 0 {
+			if index := strings.Index(code, fragment[dot:]); index != -1 {
+				return index + 1, len(fragment) - dot
+			}
+		}
+	}
+	statement := strings.TrimSpace(code)
+	if statement == "" {
+		return 0, 0
+	}
+	return strings.Index(code, statement) + 1, len(statement)
+}
+
+func directiveCode(directive string) string {
+	switch strings.ToLower(directive) {
+	case "macro", "endm":
+		return CodeMacro
+	default:
+		return CodeDirective
+	}
+}
+
+// reportOperandError tells undefined labels from other errors of operand evaluation
+func (t *AsmTranslator) reportOperandError(err error, instruction ParsedInstruction) {
+	var undefined undefinedLabelError
+	if !errors.As(err, &undefined) {
+		t.report(newTermError(CodeOperand, err.Error(), instruction.MetaInfo))
+		return
+	}
+	if !t.skippedLabels[undefined.name] {
+		t.report(newTermError(CodeLabel, err.Error(), instruction.MetaInfo))
+	}
+}
+
+// skipLabel remembers the label of a line with an error, so that its uses aren't reported as undefined
+func (t *AsmTranslator) skipLabel(line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || !strings.HasSuffix(fields[0], ":") {
+		return
+	}
+	label, err := t.defineLabel(strings.TrimSuffix(fields[0], ":"))
+	if err != nil {
+		return
+	}
+	if t.skippedLabels == nil {
+		t.skippedLabels = make(map[string]bool)
+	}
+	t.skippedLabels[label] = true
+}
+
+// FormatDiagnostics prints diagnostics like compilers do: position, severity, code and message,
+// then the source line with the problem underlined
+func FormatDiagnostics(diagnostics []Diagnostic) string {
+	builder := strings.Builder{}
+	errorCount, warningCount := 0, 0
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == SeverityError {
+			errorCount++
+		} else {
+			warningCount++
+		}
+		builder.WriteString(fmt.Sprintf("%s: %s[%s]: %s\n", diagnosticPosition(diagnostic), diagnostic.Severity, diagnostic.Code, diagnostic.Message))
+		if diagnostic.Source == "" {
+			continue
+		}
+		gutter := strings.Repeat(" ", len(fmt.Sprint(diagnostic.Line)))
+		builder.WriteString(fmt.Sprintf(" %s |\n", gutter))
+		builder.WriteString(fmt.Sprintf(" %d | %s\n", diagnostic.Line, diagnostic.Source))
+		if diagnostic.Column > 0 {
+			builder.WriteString(fmt.Sprintf(" %s | %s%s\n", gutter, caretIndent(diagnostic.Source, diagnostic.Column), strings.Repeat("^", max(diagnostic.Length, 1))))
+		}
+		if diagnostic.Expansion != "" {
+			builder.WriteString(fmt.Sprintf(" %s = note: in macro expansion '%s'\n", gutter, diagnostic.Expansion))
+		}
+	}
+	if errorCount+warningCount > 0 {
+		builder.WriteString(fmt.Sprintf("%d error(s), %d warning(s)\n", errorCount, warningCount))
+	}
+	return builder.String()
+}
+
+func diagnosticPosition(diagnostic Diagnostic) string {
+	fileName := diagnostic.FileName
+	if fileName == "" {
+		fileName = "<input>"
+	}
+	switch {
+	case diagnostic.Line == 0:
+		return fileName
+	case diagnostic.Column == 0:
+		return fmt.Sprintf("%s:%d", fileName, diagnostic.Line)
+	default:
+		return fmt.Sprintf("%s:%d:%d", fileName, diagnostic.Line, diagnostic.Column)
+	}
+}
+
+// caretIndent keeps tabs of the source, so that the caret stays under the token
+func caretIndent(source string, column int) string {
+	indent := []byte(source[:column-1])
+	for i := range indent {
+		if indent[i] != '\t' {
+			indent[i] = ' '
+		}
+	}
+	return string(indent)
+}
+
+// SerializeDiagnostics formats diagnostics as a JSON array for editors
+func SerializeDiagnostics(diagnostics []Diagnostic) ([]byte, error) {
+	if diagnostics == nil {
+		diagnostics = make([]Diagnostic, 0)
+	}
+	return json.MarshalIndent(diagnostics, "", "  ")
+}
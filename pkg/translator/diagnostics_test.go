@@ -0,0 +1,123 @@
+package translator
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+type position struct {
+	Code   string
+	Line   int
+	Column int
+	Length int
+}
+
+func positions(diagnostics []Diagnostic) []position {
+	result := make([]position, 0, len(diagnostics))
+	for _, diagnostic := range diagnostics {
+		result = append(result, position{diagnostic.Code, diagnostic.Line, diagnostic.Column, diagnostic.Length})
+	}
+	return result
+}
+
+func TestAllErrorsAreReported(t *testing.T) {
+	translator := NewTranslator()
+	_, err := translator.Translate(`value: word: 1 +
+start: ld missing
+  frob 3
+broken: frob
+  jmp broken
+  ld 5000 ; far away
+value: word: 2
+  endwritable`)
+	var errorList ErrorList
+	assert.Assert(t, errors.As(err, &errorList))
+	assert.Equal(t, len(errorList), 6)
+	assert.DeepEqual(t, positions(translator.GetDiagnostics()), []position{
+		{CodeSyntax, 1, 1, 16},
+		{CodeLabel, 2, 11, 7},
+		{CodeUnknownInstruction, 3, 3, 4},
+		{CodeUnknownInstruction, 4, 9, 4},
+		{CodeOperand, 6, 3, 7},
+		{CodeDirective, 8, 3, 11},
+	})
+}
+
+// incomplete lines are reported instead of crashing the translator
+func TestIncompleteLinesAreReported(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected position
+		message  string
+	}{
+		{input: "start:\n hlt", expected: position{CodeSyntax, 1, 1, 5}, message: "label 'start' must be on the same line with an instruction"},
+		{input: "x: word:\nstart: hlt", expected: position{CodeSyntax, 1, 4, 5}, message: "failed to parse constant: no value after 'word:'"},
+		{input: "x: word: ''\nstart: hlt", expected: position{CodeSyntax, 1, 1, 11}, message: "failed to parse constant: string literal is empty"},
+	}
+	for _, test := range tests {
+		translator := NewTranslator()
+		_, err := translator.Translate(test.input)
+		assert.Assert(t, err != nil, test.input)
+		diagnostics := translator.GetDiagnostics()
+		assert.DeepEqual(t, positions(diagnostics[:1]), []position{test.expected})
+		assert.Equal(t, diagnostics[0].Message, test.message)
+	}
+}
+
+func TestUnusedLabelWarning(t *testing.T) {
+	translator := NewTranslator()
+	_, err := translator.Translate(`start: nop
+.spare: nop
+1: hlt`)
+	assert.NilError(t, err)
+	diagnostics := translator.GetDiagnostics()
+	assert.DeepEqual(t, positions(diagnostics), []position{{CodeUnusedLabel, 2, 1, 6}, {CodeUnusedLabel, 3, 1, 1}})
+	assert.Equal(t, diagnostics[0].Severity, SeverityWarning)
+	assert.Equal(t, diagnostics[0].Message, "local label '.spare' is never used")
+}
+
+func TestFormatDiagnostics(t *testing.T) {
+	translator := NewTranslatorWithOptions(Options{FileName: "main.asm"})
+	_, err := translator.Translate("macro load value\n  ld value\nendm\nstart: load nowhere\n\thlt")
+	assert.ErrorContains(t, err, "label 'nowhere' not found")
+
+	assert.Equal(t, FormatDiagnostics(translator.GetDiagnostics()), `main.asm:4:13: error[E005]: label 'nowhere' not found
+   |
+ 4 | start: load nowhere
+   |             ^^^^^^^
+   = note: in macro expansion 'start: ld nowhere'
+1 error(s), 0 warning(s)
+`)
+
+	output, err := SerializeDiagnostics(translator.GetDiagnostics())
+	assert.NilError(t, err)
+	var decoded []map[string]any
+	assert.NilError(t, json.Unmarshal(output, &decoded))
+	assert.DeepEqual(t, decoded[0], map[string]any{
+		"severity":  "error",
+		"code":      "E005",
+		"message":   "label 'nowhere' not found",
+		"file":      "main.asm",
+		"line":      4.0,
+		"column":    13.0,
+		"length":    7.0,
+		"source":    "start: load nowhere",
+		"expansion": "start: ld nowhere",
+	})
+}
+
+func TestLocalLabelWithoutName(t *testing.T) {
+	translator := NewTranslator()
+	_, err := translator.Translate(`start: jmp .
+.: hlt
+  ld . + 1`)
+	assert.ErrorContains(t, err, "local label '.' has no name")
+	assert.DeepEqual(t, positions(translator.GetDiagnostics()), []position{
+		{CodeSyntax, 1, 12, 1},
+		{CodeSyntax, 2, 1, 1},
+		{CodeSyntax, 3, 6, 1},
+	})
+}
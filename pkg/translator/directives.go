@@ -0,0 +1,97 @@
+package translator
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// directiveFunc gets the rest of the line after the name of the directive
+type directiveFunc func(t *AsmTranslator, argument string) error
+
+// directives is filled in init, because include parses lines which refer to the table
+var directives map[string]directiveFunc
+
+func init() {
+	directives = map[string]directiveFunc{
+		"writable":    (*AsmTranslator).beginWritable,
+		"endwritable": (*AsmTranslator).endWritable,
+		"global":      (*AsmTranslator).addExports,
+		"extern":      (*AsmTranslator).addImports,
+		"include":     (*AsmTranslator).include,
+		"macro":       (*AsmTranslator).beginMacro,
+		"endm":        (*AsmTranslator).endMacro,
+		"org":         (*AsmTranslator).setOrigin,
+		"align":       (*AsmTranslator).align,
+	}
+}
+
+func findDirective(name string) (directiveFunc, bool) {
+	directive, ok := directives[strings.ToLower(name)]
+	return directive, ok
+}
+
+// beginWritable marks the following instructions as code which the program is allowed to modify
+func (t *AsmTranslator) beginWritable(argument string) error {
+	if argument != "" {
+		return errors.New("writable doesn't take arguments")
+	}
+	if t.writable {
+		return errors.New("writable region is already open")
+	}
+	t.writable = true
+	return nil
+}
+
+func (t *AsmTranslator) endWritable(argument string) error {
+	if argument != "" {
+		return errors.New("endwritable doesn't take arguments")
+	}
+	if !t.writable {
+		return errors.New("endwritable without writable")
+	}
+	t.writable = false
+	return nil
+}
+
+// addExports makes labels visible to other objects, e.g. `global start, print`
+func (t *AsmTranslator) addExports(argument string) error {
+	names, err := parseSymbolNames("global", argument)
+	if err != nil {
+		return err
+	}
+	t.exports = appendNew(t.exports, names)
+	return nil
+}
+
+// addImports declares labels defined in other objects
+func (t *AsmTranslator) addImports(argument string) error {
+	names, err := parseSymbolNames("extern", argument)
+	if err != nil {
+		return err
+	}
+	t.imports = appendNew(t.imports, names)
+	return nil
+}
+
+func parseSymbolNames(directive string, argument string) ([]string, error) {
+	names := make([]string, 0)
+	for _, name := range strings.Split(argument, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, " ():'") {
+			return nil, fmt.Errorf("%s expects a list of labels separated by commas", directive)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func appendNew(names []string, newNames []string) []string {
+	for _, name := range newNames {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,350 @@
+package translator
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// value is a result of evaluation. Relocatable values are an offset from a symbol
+// or from the start of a section, they are known only after linking.
+type value struct {
+	symbol  string
+	section isa.SectionKind
+	number  int
+}
+
+func (v value) isAbsolute() bool {
+	return v.symbol == "" && v.section == ""
+}
+
+type evaluationContext struct {
+	// address of the term which contains the expression, it's the value of `*`. It's nil where `*` is unknown
+	address *value
+	resolve func(name string) (value, error)
+	// offsetOf returns the section and the offset of a relocatable value if it's defined in this unit
+	offsetOf func(v value) (isa.SectionKind, int, bool)
+}
+
+type expression interface {
+	evaluate(context evaluationContext) (value, error)
+	String() string
+}
+
+type numberLiteral int
+
+type symbolReference string
+
+type currentAddress struct{}
+
+type negation struct {
+	operand expression
+}
+
+type binaryOperation struct {
+	operator    string
+	left, right expression
+}
+
+func (n numberLiteral) evaluate(_ evaluationContext) (value, error) {
+	return checkWordRange(value{number: int(n)}, n)
+}
+
+func (n numberLiteral) String() string {
+	return strconv.Itoa(int(n))
+}
+
+func (s symbolReference) evaluate(context evaluationContext) (value, error) {
+	return context.resolve(string(s))
+}
+
+func (s symbolReference) String() string {
+	return string(s)
+}
+
+func (c currentAddress) evaluate(context evaluationContext) (value, error) {
+	if context.address == nil {
+		return value{}, errors.New("current address '*' is unknown here")
+	}
+	return *context.address, nil
+}
+
+func (c currentAddress) String() string {
+	return "*"
+}
+
+func (n negation) evaluate(context evaluationContext) (value, error) {
+	operand, err := n.operand.evaluate(context)
+	if err != nil {
+		return value{}, err
+	}
+	if !operand.isAbsolute() {
+		return value{}, fmt.Errorf("can't negate relocatable value '%s'", n.operand)
+	}
+	return checkWordRange(value{number: -operand.number}, n)
+}
+
+func (n negation) String() string {
+	return "-" + n.operand.String()
+}
+
+func (b binaryOperation) evaluate(context evaluationContext) (value, error) {
+	left, err := b.left.evaluate(context)
+	if err != nil {
+		return value{}, err
+	}
+	right, err := b.right.evaluate(context)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch {
+	case b.operator == "+" && left.isAbsolute():
+		right.number += left.number
+		return checkWordRange(right, b)
+	case (b.operator == "+" || b.operator == "-") && right.isAbsolute():
+		left.number = applyOperator(b.operator, left.number, right.number)
+		return checkWordRange(left, b)
+	case b.operator == "-" && !left.isAbsolute():
+		return b.difference(context, left, right)
+	case !left.isAbsolute() || !right.isAbsolute():
+		return value{}, fmt.Errorf("operator '%s' can't be applied to relocatable values in '%s'", b.operator, b)
+	}
+
+	if (b.operator == "/" || b.operator == "%") && right.number == 0 {
+		return value{}, fmt.Errorf("division by zero in '%s'", b)
+	}
+	if (b.operator == "<<" || b.operator == ">>") && (right.number < 0 || right.number >= isa.WordWidth) {
+		return value{}, fmt.Errorf("shift by %d is out of range in '%s'", right.number, b)
+	}
+	return checkWordRange(value{number: applyOperator(b.operator, left.number, right.number)}, b)
+}
+
+// difference of two relocatable values is absolute if both point into the same section of this unit
+func (b binaryOperation) difference(context evaluationContext, left value, right value) (value, error) {
+	if left.symbol == right.symbol && left.section == right.section {
+		return value{number: left.number - right.number}, nil
+	}
+	leftSection, leftOffset, leftOk := context.offsetOf(left)
+	rightSection, rightOffset, rightOk := context.offsetOf(right)
+	if !leftOk || !rightOk || leftSection != rightSection {
+		return value{}, fmt.Errorf("difference of symbols from different sections or units in '%s'", b)
+	}
+	return value{number: leftOffset - rightOffset}, nil
+}
+
+func (b binaryOperation) String() string {
+	return fmt.Sprintf("(%s %s %s)", b.left, b.operator, b.right)
+}
+
+func applyOperator(operator string, left int, right int) int {
+	switch operator {
+	case "+":
+		return left + right
+	case "-":
+		return left - right
+	case "*":
+		return left * right
+	case "/":
+		return left / right
+	case "%":
+		return left % right
+	case "<<":
+		return left << right
+	case ">>":
+		return left >> right
+	case "&":
+		return left & right
+	case "|":
+		return left | right
+	default:
+		panic(fmt.Sprintf("unknown operator: %s", operator))
+	}
+}
+
+func checkWordRange(result value, source expression) (value, error) {
+	if result.number < isa.WordMinValue || result.number > isa.WordMaxValue {
+		return value{}, fmt.Errorf("value of '%s' doesn't fit in %d bits", source, isa.WordWidth)
+	}
+	return result, nil
+}
+
+// binaryPrecedence lists operators from the lowest priority to the highest
+var binaryPrecedence = [][]string{
+	{"|"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+type expressionParser struct {
+	tokens   []string
+	position int
+}
+
+// parseExpression parses literals (`12`, `-3`, `0x1F`, `0b101`, `'A'`), labels, `*` for the current address,
+// operators `+ - * / % << >> & |` and parentheses
+func parseExpression(input string) (expression, error) {
+	tokens, err := tokenizeExpression(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty expression")
+	}
+	parser := &expressionParser{tokens: tokens}
+	result, err := parser.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if parser.position != len(tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in expression '%s'", tokens[parser.position], input)
+	}
+	return result, nil
+}
+
+func (p *expressionParser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position]
+	}
+	return ""
+}
+
+func (p *expressionParser) parseBinary(level int) (expression, error) {
+	if level == len(binaryPrecedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for slices.Contains(binaryPrecedence[level], p.peek()) {
+		operator := p.peek()
+		p.position++
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryOperation{operator: operator, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseUnary() (expression, error) {
+	token := p.peek()
+	p.position++
+	switch {
+	case token == "":
+		return nil, errors.New("unexpected end of expression")
+	case token == "-":
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if literal, ok := operand.(numberLiteral); ok {
+			return numberLiteral(-literal), nil
+		}
+		return negation{operand: operand}, nil
+	case token == "+":
+		return p.parseUnary()
+	case token == "*":
+		return currentAddress{}, nil
+	case token == "(":
+		inner, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("missing ')' in expression")
+		}
+		p.position++
+		return inner, nil
+	case strings.HasPrefix(token, "'"):
+		runes := []rune(strings.Trim(token, "'"))
+		if len(runes) != 1 {
+			return nil, fmt.Errorf("character literal %s must have exactly one character", token)
+		}
+		return numberLiteral(runes[0]), nil
+	case isAnonymousReference(token):
+		return symbolReference(token), nil
+	case token[0] >= '0' && token[0] <= '9':
+		return parseNumberLiteral(token)
+	case token == ".":
+		return nil, errors.New("local label '.' has no name")
+	case isLabelStart(token[0]):
+		return symbolReference(token), nil
+	default:
+		return nil, fmt.Errorf("unexpected '%s' in expression", token)
+	}
+}
+
+func parseNumberLiteral(token string) (expression, error) {
+	base := 10
+	digits := token
+	switch {
+	case strings.HasPrefix(strings.ToLower(token), "0x"):
+		base, digits = 16, token[2:]
+	case strings.HasPrefix(strings.ToLower(token), "0b"):
+		base, digits = 2, token[2:]
+	}
+	// -WordMinValue is allowed here, so that the negated literal fits
+	number, err := strconv.ParseInt(digits, base, 64)
+	if err != nil || number > -isa.WordMinValue {
+		return nil, fmt.Errorf("invalid number literal '%s', must fit in %d bits", token, isa.WordWidth)
+	}
+	return numberLiteral(number), nil
+}
+
+var expressionOperators = []string{"<<", ">>", "+", "-", "*", "/", "%", "&", "|", "(", ")"}
+
+func tokenizeExpression(input string) ([]string, error) {
+	tokens := make([]string, 0)
+	for i := 0; i < len(input); {
+		char := input[i]
+		switch {
+		case char == ' ' || char == '\t':
+			i++
+		case char == '\'':
+			end := strings.IndexByte(input[i+1:], '\'')
+			if end == -1 {
+				return nil, errors.New("character literal is not closed")
+			}
+			tokens = append(tokens, input[i:i+end+2])
+			i += end + 2
+		case isLabelStart(char) || char >= '0' && char <= '9':
+			end := i
+			for end < len(input) && isLabelChar(input[end]) {
+				end++
+			}
+			tokens = append(tokens, input[i:end])
+			i = end
+		default:
+			operator := ""
+			for _, candidate := range expressionOperators {
+				if strings.HasPrefix(input[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected character '%c' in expression", char)
+			}
+			tokens = append(tokens, operator)
+			i += len(operator)
+		}
+	}
+	return tokens, nil
+}
+
+func isLabelStart(char byte) bool {
+	return isIdentifierStart(char) || char == '.'
+}
+
+func isLabelChar(char byte) bool {
+	return isLabelStart(char) || char >= '0' && char <= '9'
+}
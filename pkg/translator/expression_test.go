@@ -0,0 +1,121 @@
+package translator
+
+import (
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"gotest.tools/v3/assert"
+)
+
+func evaluateConstant(t *testing.T, input string) (int, error) {
+	t.Helper()
+	parsed, err := parseExpression(input)
+	if err != nil {
+		return 0, err
+	}
+	labels := map[string]int{"start": 10, "end": 25}
+	result, err := parsed.evaluate(evaluationContext{
+		address: &value{number: 7},
+		resolve: func(name string) (value, error) {
+			return value{number: labels[name]}, nil
+		},
+	})
+	return result.number, err
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{input: "42", expected: 42},
+		{input: "-42", expected: -42},
+		{input: "0x1F", expected: 31},
+		{input: "0b101", expected: 5},
+		{input: "'A'", expected: 65},
+		{input: "' ' + 1", expected: 33},
+		{input: "start + 2", expected: 12},
+		{input: "end - start", expected: 15},
+		{input: "*", expected: 7},
+		{input: "* + 1", expected: 8},
+		{input: "2 + 3 * 4", expected: 14},
+		{input: "(2 + 3) * 4", expected: 20},
+		{input: "17 / 5 + 17 % 5", expected: 5},
+		{input: "1 << 4 | 1", expected: 17},
+		{input: "0xFF & 0x0F", expected: 15},
+		{input: "256 >> 2", expected: 64},
+		{input: "-(start - end)", expected: 15},
+		{input: "-2147483648", expected: isa.WordMinValue},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			result, err := evaluateConstant(t, test.input)
+			assert.NilError(t, err)
+			assert.Equal(t, result, test.expected)
+		})
+	}
+}
+
+func TestEvaluateExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{input: "2147483648", err: "value of '2147483648' doesn't fit in 32 bits"},
+		{input: "0x7FFFFFFF + 1", err: "value of '(2147483647 + 1)' doesn't fit in 32 bits"},
+		{input: "65536 * 65536", err: "doesn't fit in 32 bits"},
+		{input: "1 / 0", err: "division by zero in '(1 / 0)'"},
+		{input: "1 << 32", err: "shift by 32 is out of range"},
+		{input: "(1 + 2", err: "missing ')' in expression"},
+		{input: "1 +", err: "unexpected end of expression"},
+		{input: "1 2", err: "unexpected '2' in expression '1 2'"},
+		{input: "'AB'", err: "character literal 'AB' must have exactly one character"},
+		{input: "0xZZ", err: "invalid number literal '0xZZ'"},
+		{input: "1 # 2", err: "unexpected character '#' in expression"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := evaluateConstant(t, test.input)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+func TestExpressionOperands(t *testing.T) {
+	program, err := NewTranslator().Translate(`table: word: 1
+minus_one: word: -1
+size: word: * - table
+start: ld (table + 1)
+  ld (1 + 1) * 2
+  hlt`)
+	assert.NilError(t, err)
+	assert.Equal(t, *program.Instructions[1].Operand, -1)
+	assert.Equal(t, *program.Instructions[2].Operand, 2)
+	assert.Equal(t, program.Instructions[3].OperandType, isa.ValueTypeAddressIndirect)
+	assert.Equal(t, *program.Instructions[3].Operand, 1)
+	assert.Equal(t, program.Instructions[4].OperandType, isa.ValueTypeAddressDirect)
+	assert.Equal(t, *program.Instructions[4].Operand, 4)
+
+	_, err = NewTranslator().Translate("start: ld 2048")
+	assert.ErrorContains(t, err, "operand 2048 is out of address range [0, 2047]")
+}
+
+func TestExpressionRelocations(t *testing.T) {
+	object, err := NewTranslator().TranslateObject(`extern buffer
+table: word: 1
+second: word: 2
+table_size: word: table_size - table
+start: ld buffer + 3
+  jmp * + 2`)
+	assert.NilError(t, err)
+	assert.Equal(t, *object.Sections[0].Terms[2].Operand, 2)
+	assert.DeepEqual(t, object.Relocations, []isa.Relocation{
+		{Section: isa.SectionCode, Offset: 0, Symbol: "buffer", Addend: 3},
+		{Section: isa.SectionCode, Offset: 1, Target: isa.SectionCode, Addend: 3},
+	})
+
+	_, err = NewTranslator().TranslateObject("extern buffer\nstart: ld buffer * 2")
+	assert.ErrorContains(t, err, "operator '*' can't be applied to relocatable values")
+	_, err = NewTranslator().TranslateObject("extern buffer\nsize: word: buffer - size")
+	assert.ErrorContains(t, err, "difference of symbols from different sections or units")
+}
@@ -0,0 +1,165 @@
+package translator
+
+import (
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// sourceLine is a line split for formatting. Label is the label with a colon or the name of an `equ`/`set` constant.
+type sourceLine struct {
+	label   string
+	keyword string
+	operand string
+	comment string
+	// invocation is set for macro invocations, their names don't widen the column of keywords
+	invocation bool
+}
+
+func (l sourceLine) isCode() bool {
+	return l.keyword != ""
+}
+
+// Format rewrites the source into the canonical layout: labels in the first column, keywords and operands
+// aligned in columns, lowercase mnemonics and directives, trailing comments aligned within blocks of lines.
+// The source is parsed first, so that only correct sources are formatted.
+func (t *AsmTranslator) Format(input string) ([]byte, error) {
+	t.parse(input)
+	if err := t.errorsFound(); err != nil {
+		return nil, err
+	}
+
+	lines := make([]sourceLine, 0)
+	for _, line := range strings.Split(strings.ReplaceAll(input, "\r\n", "\n"), "\n") {
+		lines = append(lines, splitSourceLine(line))
+	}
+
+	labelWidth, keywordWidth := 0, 0
+	for _, line := range lines {
+		labelWidth = max(labelWidth, len(line.label))
+		if line.operand != "" && !line.invocation {
+			keywordWidth = max(keywordWidth, len(line.keyword))
+		}
+	}
+	// instructions without labels are indented like in the rest of the sources
+	keywordColumn := max(labelWidth+1, 2)
+
+	formatted := make([]string, 0, len(lines))
+	for i, line := range lines {
+		switch {
+		case line.isCode():
+			code := padRight(line.label, keywordColumn) + line.keyword
+			if line.invocation && line.operand != "" {
+				code += " " + line.operand
+			} else if line.operand != "" {
+				code = padRight(code, keywordColumn+keywordWidth+1) + line.operand
+			}
+			formatted = append(formatted, code)
+		case line.comment != "" && commentInsideCode(lines, i):
+			formatted = append(formatted, strings.Repeat(" ", keywordColumn)+line.comment)
+		default:
+			formatted = append(formatted, line.comment)
+		}
+	}
+	alignTrailingComments(lines, formatted)
+	return []byte(joinWithoutExtraBlankLines(formatted)), nil
+}
+
+func splitSourceLine(line string) sourceLine {
+	code, comment, _ := strings.Cut(line, ";")
+	result := sourceLine{}
+	if strings.Contains(line, ";") {
+		result.comment = strings.TrimRight(";"+comment, " \t")
+	}
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return result
+	}
+	if name, keyword, argument, ok := splitConstantDefinition(code); ok {
+		result.label, result.keyword, result.operand = name, keyword, argument
+		return result
+	}
+	if first := strings.Fields(code)[0]; strings.HasSuffix(first, ":") && first != "word:" {
+		result.label = first
+		code = strings.TrimSpace(strings.TrimPrefix(code, first))
+	}
+	keyword := strings.Fields(code)[0]
+	result.keyword, result.invocation = normalizeKeyword(keyword)
+	result.operand = strings.TrimSpace(strings.TrimPrefix(code, keyword))
+	return result
+}
+
+// normalizeKeyword lowercases mnemonics and directives, other keywords are names of macros and are kept
+func normalizeKeyword(keyword string) (string, bool) {
+	lower := strings.ToLower(keyword)
+	if _, ok := findDirective(lower); ok || lower == "word:" || lower == "res" {
+		return lower, false
+	}
+	if _, err := isa.GetOpcodeFromString(lower); err == nil {
+		return lower, false
+	}
+	return keyword, true
+}
+
+// commentInsideCode tells whether a comment line is between instructions of a block, then it's indented like them
+func commentInsideCode(lines []sourceLine, position int) bool {
+	previous := false
+	for i := position - 1; i >= 0 && (lines[i].isCode() || lines[i].comment != ""); i-- {
+		if lines[i].isCode() {
+			previous = true
+			break
+		}
+	}
+	for i := position + 1; i < len(lines) && (lines[i].isCode() || lines[i].comment != ""); i++ {
+		if lines[i].isCode() {
+			return previous && lines[i].label == ""
+		}
+	}
+	return false
+}
+
+// alignTrailingComments puts comments after code at the same column within a block of lines without blank lines
+func alignTrailingComments(lines []sourceLine, formatted []string) {
+	for start := 0; start < len(lines); {
+		end := start
+		for end < len(lines) && (lines[end].isCode() || lines[end].comment != "") {
+			end++
+		}
+		column := 0
+		for i := start; i < end; i++ {
+			if lines[i].isCode() && lines[i].comment != "" {
+				column = max(column, len(formatted[i])+1)
+			}
+		}
+		for i := start; i < end; i++ {
+			if lines[i].isCode() && lines[i].comment != "" {
+				formatted[i] = padRight(formatted[i], column) + lines[i].comment
+			}
+		}
+		start = end + 1
+	}
+}
+
+func joinWithoutExtraBlankLines(lines []string) string {
+	builder := strings.Builder{}
+	blank := false
+	for _, line := range lines {
+		if line == "" {
+			blank = builder.Len() > 0
+			continue
+		}
+		if blank {
+			builder.WriteString("\n")
+			blank = false
+		}
+		builder.WriteString(line + "\n")
+	}
+	return builder.String()
+}
+
+func padRight(text string, width int) string {
+	if len(text) >= width {
+		return text + " "
+	}
+	return text + strings.Repeat(" ", width-len(text))
+}
@@ -0,0 +1,68 @@
+package translator
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const unformatted = `; prints a digit
+out_port: word: 1 ; port
+digit: word: '1' + 0
+macro show value
+  LD value
+    out out_port
+endm
+
+
+START: nop
+    show digit
+      ; finished
+    JMP  finish ; done
+finish:  HLT
+`
+
+func TestFormat(t *testing.T) {
+	formatted, err := NewTranslator().Format(unformatted)
+	assert.NilError(t, err)
+	assert.Equal(t, string(formatted), `; prints a digit
+out_port: word: 1 ; port
+digit:    word: '1' + 0
+          macro show value
+          ld    value
+          out   out_port
+          endm
+
+START:    nop
+          show digit
+          ; finished
+          jmp   finish ; done
+finish:   hlt
+`)
+
+	again, err := NewTranslator().Format(string(formatted))
+	assert.NilError(t, err)
+	assert.Equal(t, string(again), string(formatted))
+}
+
+func TestFormattedSourceTranslatesTheSame(t *testing.T) {
+	source := strings.Replace(unformatted, "START:", "start:", 1)
+	formatted, err := NewTranslator().Format(source)
+	assert.NilError(t, err)
+
+	expected, err := NewTranslator().Translate(source)
+	assert.NilError(t, err)
+	actual, err := NewTranslator().Translate(string(formatted))
+	assert.NilError(t, err)
+	assert.Equal(t, len(actual.Instructions), len(expected.Instructions))
+	for i := range expected.Instructions {
+		assert.Equal(t, actual.Instructions[i].Opcode, expected.Instructions[i].Opcode)
+		assert.DeepEqual(t, actual.Instructions[i].Operand, expected.Instructions[i].Operand)
+	}
+}
+
+func TestFormatRejectsInvalidSource(t *testing.T) {
+	_, err := NewTranslator().Format("start: frob 1")
+	assert.ErrorContains(t, err, "unknown instruction or macro 'frob'")
+}
@@ -0,0 +1,66 @@
+package translator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func newSourceFile(name string) sourceFile {
+	absolute, err := filepath.Abs(name)
+	if err != nil {
+		absolute = filepath.Clean(name)
+	}
+	return sourceFile{name: name, absolute: absolute}
+}
+
+// include parses the file in place of the directive, e.g. `include "lib/print.asm"`
+func (t *AsmTranslator) include(path string) error {
+	if len(path) < 2 || !strings.HasPrefix(path, "\"") || !strings.HasSuffix(path, "\"") {
+		return errors.New("include expects a file path in double quotes")
+	}
+	file, err := t.resolveInclude(strings.Trim(path, "\""))
+	if err != nil {
+		return err
+	}
+	for i, including := range t.includeStack {
+		if including.absolute == file.absolute {
+			return fmt.Errorf("include cycle: %s", t.formatIncludeChain(i, file))
+		}
+	}
+	content, err := os.ReadFile(file.name)
+	if err != nil {
+		return fmt.Errorf("failed to read included file: %w", err)
+	}
+
+	t.includeStack = append(t.includeStack, file)
+	defer func() { t.includeStack = t.includeStack[:len(t.includeStack)-1] }()
+	t.parseSource(string(content))
+	return nil
+}
+
+// resolveInclude looks for the file near the including file, then in include paths
+func (t *AsmTranslator) resolveInclude(path string) (sourceFile, error) {
+	if filepath.IsAbs(path) {
+		return newSourceFile(path), nil
+	}
+	directories := []string{filepath.Dir(t.currentFile())}
+	directories = append(directories, t.options.IncludePaths...)
+	for _, directory := range directories {
+		candidate := filepath.Join(directory, path)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return newSourceFile(candidate), nil
+		}
+	}
+	return sourceFile{}, fmt.Errorf("included file '%s' not found", path)
+}
+
+func (t *AsmTranslator) formatIncludeChain(from int, file sourceFile) string {
+	names := make([]string, 0)
+	for _, including := range t.includeStack[from:] {
+		names = append(names, including.name)
+	}
+	return strings.Join(append(names, file.name), " -> ")
+}
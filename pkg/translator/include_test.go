@@ -0,0 +1,77 @@
+package translator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NilError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestIncludeFromIncludePath(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.asm":        "start: jmp routine\ninclude \"routine.asm\"",
+		"lib/routine.asm": "; routine\nroutine: hlt",
+	})
+	main := filepath.Join(dir, "main.asm")
+	source, err := os.ReadFile(main)
+	assert.NilError(t, err)
+
+	program, err := NewTranslatorWithOptions(Options{FileName: main, IncludePaths: []string{filepath.Join(dir, "lib")}}).Translate(string(source))
+	assert.NilError(t, err)
+	assert.Equal(t, *program.Instructions[0].Operand, 1)
+	assert.Equal(t, program.Instructions[0].TermInfo.FileName, main)
+	assert.Equal(t, program.Instructions[1].TermInfo.FileName, filepath.Join(dir, "lib", "routine.asm"))
+	assert.Equal(t, program.Instructions[1].TermInfo.LineNum, 2)
+}
+
+// the path is taken as written, spaces and tabs inside quotes are kept
+func TestIncludePathWithSpaces(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"my  lib/rou\ttine.asm": "routine: hlt",
+	})
+	main := filepath.Join(dir, "main.asm")
+	program, err := NewTranslatorWithOptions(Options{FileName: main}).Translate("start: jmp routine\ninclude \"my  lib/rou\ttine.asm\"")
+	assert.NilError(t, err)
+	assert.Equal(t, program.Instructions[1].TermInfo.FileName, filepath.Join(dir, "my  lib", "rou\ttine.asm"))
+}
+
+func TestIncludeErrorPointsAtIncludedFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.asm":   "start: hlt\ninclude \"broken.asm\"",
+		"broken.asm": "  endwritable",
+	})
+	main := filepath.Join(dir, "main.asm")
+
+	_, err := NewTranslatorWithOptions(Options{FileName: main}).Translate("start: hlt\ninclude \"broken.asm\"")
+	assert.ErrorContains(t, err, "Parse error at "+filepath.Join(dir, "broken.asm")+":1 ('endwritable'): endwritable without writable")
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.asm": "start: hlt\ninclude \"a.asm\"",
+		"a.asm":    "include \"b.asm\"",
+		"b.asm":    "include \"a.asm\"",
+	})
+	a := filepath.Join(dir, "a.asm")
+	b := filepath.Join(dir, "b.asm")
+
+	_, err := NewTranslatorWithOptions(Options{FileName: filepath.Join(dir, "main.asm")}).Translate("start: hlt\ninclude \"a.asm\"")
+	assert.ErrorContains(t, err, "include cycle: "+a+" -> "+b+" -> "+a)
+}
+
+func TestIncludeNotFound(t *testing.T) {
+	_, err := NewTranslator().Translate("start: hlt\ninclude \"missing.asm\"")
+	assert.Error(t, err, "Parse error at 2 ('include \"missing.asm\"'): included file 'missing.asm' not found")
+}
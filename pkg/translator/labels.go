@@ -0,0 +1,208 @@
+package translator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// expansionSuffix ends local labels of macro expansions, `%%again` becomes `again__3`. Labels written in the
+// source can't end with it, so they don't collide with expansions.
+var expansionSuffix = regexp.MustCompile(`__[0-9]+$`)
+
+// anonymousLabelSeparator joins the number of an anonymous label and its occurrence, `1:` becomes `1@3`
+const anonymousLabelSeparator = "@"
+
+// scopeLabels qualifies labels defined and referenced on a line: local labels `.loop` get the name
+// of the last global label as a prefix, anonymous labels `1:` get a unique occurrence number
+func (t *AsmTranslator) scopeLabels(instructions []ParsedInstruction) error {
+	for i := range instructions {
+		if instructions[i].Label == "" {
+			continue
+		}
+		label, err := t.defineLabel(instructions[i].Label)
+		if err != nil {
+			return err
+		}
+		instructions[i].Label = label
+	}
+	for i := range instructions {
+		if instructions[i].LabelOperand != "" {
+			name, err := t.qualifyReference(instructions[i].LabelOperand)
+			if err != nil {
+				return err
+			}
+			instructions[i].LabelOperand = name
+		}
+		if instructions[i].Expression != nil {
+			qualified, err := renameSymbols(instructions[i].Expression, t.qualifyReference)
+			if err != nil {
+				return err
+			}
+			instructions[i].Expression = qualified
+		}
+	}
+	return nil
+}
+
+func (t *AsmTranslator) defineLabel(label string) (string, error) {
+	switch {
+	case isAnonymousLabel(label):
+		if t.anonymousLabels == nil {
+			t.anonymousLabels = make(map[string]int)
+		}
+		t.anonymousLabels[label]++
+		return anonymousLabelName(label, t.anonymousLabels[label]), nil
+	case strings.HasPrefix(label, "."):
+		if t.scope == "" {
+			return "", fmt.Errorf("local label '%s' is defined before any global label", label)
+		}
+		return t.scope + label, nil
+	case !isLabelStart(label[0]) || strings.Contains(label, anonymousLabelSeparator):
+		return "", fmt.Errorf("invalid label '%s'", label)
+	case t.invocation == nil && expansionSuffix.MatchString(label):
+		return "", reservedLabel(label)
+	}
+	// labels of macro expansions like `again__1` don't start a scope, so local labels around the invocation stay visible
+	if !t.isExpansionLabel(label) {
+		t.scope = label
+	}
+	return label, nil
+}
+
+// qualifyReference turns `.loop` into `scope.loop` and `1b`/`1f` into the nearest anonymous label before or after
+func (t *AsmTranslator) qualifyReference(name string) (string, error) {
+	qualified, err := t.qualifyName(name)
+	if err != nil {
+		return "", err
+	}
+	if t.referenced == nil {
+		t.referenced = make(map[string]int)
+	}
+	t.referenced[qualified]++
+	t.references = append(t.references, SymbolReference{Name: qualified, Written: name, MetaInfo: t.lineInfo})
+	return qualified, nil
+}
+
+func (t *AsmTranslator) qualifyName(name string) (string, error) {
+	switch {
+	case isAnonymousReference(name):
+		number, direction := name[:len(name)-1], name[len(name)-1]
+		occurrence := t.anonymousLabels[number]
+		if direction == 'f' {
+			return anonymousLabelName(number, occurrence+1), nil
+		}
+		if occurrence == 0 {
+			return "", fmt.Errorf("no anonymous label '%s' before the reference '%s'", number, name)
+		}
+		return anonymousLabelName(number, occurrence), nil
+	case strings.HasPrefix(name, "."):
+		if t.scope == "" {
+			return "", fmt.Errorf("local label '%s' is used before any global label", name)
+		}
+		return t.scope + name, nil
+	}
+	return name, nil
+}
+
+func (t *AsmTranslator) isExpansionLabel(label string) bool {
+	return t.invocation != nil && expansionSuffix.MatchString(label)
+}
+
+func reservedLabel(label string) error {
+	return fmt.Errorf("label '%s' is reserved, names ending with '__' and a number are made by macro expansions", label)
+}
+
+// checkDuplicateLabels forbids several definitions of a label, references would be ambiguous
+func (t *AsmTranslator) checkDuplicateLabels() {
+	defined := make(map[string]ParsedInstruction)
+	for _, instruction := range t.instructions {
+		if instruction.Label == "" {
+			continue
+		}
+		if previous, ok := defined[instruction.Label]; ok {
+			t.report(newTermError(CodeLabel, fmt.Sprintf("label '%s' is already defined at line %s", instruction.Label, previous.MetaInfo.Position()), instruction.MetaInfo))
+			continue
+		}
+		defined[instruction.Label] = instruction
+	}
+}
+
+// warnUnusedLabels reports local and anonymous labels without references, global ones may be used by other units
+func (t *AsmTranslator) warnUnusedLabels() {
+	for _, instruction := range t.instructions {
+		label := instruction.Label
+		if label == "" || t.referenced[label] > 0 {
+			continue
+		}
+		switch labelKind(label) {
+		case SymbolLocal:
+			t.warn(CodeUnusedLabel, fmt.Sprintf("local label '%s' is never used", label[strings.LastIndex(label, "."):]), instruction.MetaInfo)
+		case SymbolAnonymous:
+			number, _, _ := strings.Cut(label, anonymousLabelSeparator)
+			t.warn(CodeUnusedLabel, fmt.Sprintf("anonymous label '%s' is never used", number), instruction.MetaInfo)
+		}
+	}
+}
+
+type undefinedLabelError struct {
+	name string
+}
+
+func (e undefinedLabelError) Error() string {
+	if number, _, ok := strings.Cut(e.name, anonymousLabelSeparator); ok {
+		return fmt.Sprintf("no anonymous label '%s' after the reference '%sf'", number, number)
+	}
+	return fmt.Sprintf("label '%s' not found", e.name)
+}
+
+func labelNotFound(name string) error {
+	return undefinedLabelError{name: name}
+}
+
+func anonymousLabelName(number string, occurrence int) string {
+	return number + anonymousLabelSeparator + strconv.Itoa(occurrence)
+}
+
+func isAnonymousLabel(label string) bool {
+	_, err := strconv.ParseUint(label, 10, 32)
+	return err == nil
+}
+
+func isAnonymousReference(name string) bool {
+	if len(name) < 2 {
+		return false
+	}
+	direction := name[len(name)-1]
+	return (direction == 'f' || direction == 'b') && isAnonymousLabel(name[:len(name)-1])
+}
+
+func (t *AsmTranslator) parseScopedExpression(input string) (expression, error) {
+	parsed, err := parseExpression(input)
+	if err != nil {
+		return nil, err
+	}
+	return renameSymbols(parsed, t.qualifyReference)
+}
+
+// renameSymbols rewrites every symbol reference of the expression
+func renameSymbols(e expression, rename func(name string) (string, error)) (expression, error) {
+	switch e := e.(type) {
+	case symbolReference:
+		name, err := rename(string(e))
+		return symbolReference(name), err
+	case negation:
+		operand, err := renameSymbols(e.operand, rename)
+		return negation{operand: operand}, err
+	case binaryOperation:
+		left, err := renameSymbols(e.left, rename)
+		if err != nil {
+			return nil, err
+		}
+		right, err := renameSymbols(e.right, rename)
+		return binaryOperation{operator: e.operator, left: left, right: right}, err
+	default:
+		return e, nil
+	}
+}
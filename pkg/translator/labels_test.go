@@ -0,0 +1,82 @@
+package translator
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLocalLabels(t *testing.T) {
+	translator := NewTranslator()
+	program, err := translator.Translate(`first: ld .value
+.loop: dec
+  jnz .loop
+.value: word: 3
+start: jmp .loop
+.loop: jmp first.loop
+  hlt`)
+	assert.NilError(t, err)
+	assert.Equal(t, *program.Instructions[0].Operand, 3)
+	assert.Equal(t, *program.Instructions[2].Operand, 1)
+	assert.Equal(t, *program.Instructions[4].Operand, 5)
+	assert.Equal(t, *program.Instructions[5].Operand, 1)
+
+	symbols := make(map[string]SymbolKind)
+	for _, symbol := range translator.GetSymbols() {
+		symbols[symbol.Name] = symbol.Kind
+	}
+	assert.DeepEqual(t, symbols, map[string]SymbolKind{
+		"first": SymbolLabel, "first.loop": SymbolLocal, "first.value": SymbolLocal,
+		"start": SymbolLabel, "start.loop": SymbolLocal,
+	})
+}
+
+func TestAnonymousLabels(t *testing.T) {
+	translator := NewTranslator()
+	program, err := translator.Translate(`start: jmp 1f
+1: dec
+  jnz 1b
+  jmp 1f + 1
+1: nop
+  hlt`)
+	assert.NilError(t, err)
+	assert.Equal(t, *program.Instructions[0].Operand, 1)
+	assert.Equal(t, *program.Instructions[2].Operand, 1)
+	assert.Equal(t, *program.Instructions[3].Operand, 5)
+
+	kinds := make(map[string]SymbolKind)
+	for _, symbol := range translator.GetSymbols() {
+		kinds[symbol.Name] = symbol.Kind
+	}
+	assert.DeepEqual(t, kinds, map[string]SymbolKind{"1@1": SymbolAnonymous, "1@2": SymbolAnonymous, "start": SymbolLabel})
+}
+
+func TestMacroLabelsKeepScope(t *testing.T) {
+	program, err := NewTranslator().Translate(`macro skip
+  jmp %%over
+%%over: nop
+endm
+start: skip
+  jmp .done
+.done: hlt`)
+	assert.NilError(t, err)
+	assert.Equal(t, *program.Instructions[2].Operand, 3)
+}
+
+func TestLabelErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "start: nop\nstart: hlt", expected: "label 'start' is already defined at line 1"},
+		{input: "start: nop\n.x: nop\n.x: hlt", expected: "label 'start.x' is already defined at line 2"},
+		{input: ".x: nop\nstart: hlt", expected: "local label '.x' is defined before any global label"},
+		{input: "start: jmp 1b\n1: hlt", expected: "no anonymous label '1' before the reference '1b'"},
+		{input: "start: jmp 2f\n  hlt", expected: "no anonymous label '2' after the reference '2f'"},
+		{input: "a@b: nop\nstart: hlt", expected: "invalid label 'a@b'"},
+	}
+	for _, test := range tests {
+		_, err := NewTranslator().Translate(test.input)
+		assert.ErrorContains(t, err, test.expected, test.input)
+	}
+}
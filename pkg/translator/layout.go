@@ -0,0 +1,216 @@
+package translator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// setOrigin places the following words starting from the address, e.g. `org 0x100`
+func (t *AsmTranslator) setOrigin(argument string) error {
+	if t.relocatable {
+		return errors.New("org can't be used in objects, sections are placed by the linker")
+	}
+	address, err := t.evaluateNow("org", argument)
+	if err != nil {
+		return err
+	}
+	if address < 0 || address > isa.AddrMaxValue {
+		return fmt.Errorf("org address %d is out of address range [0, %d]", address, isa.AddrMaxValue)
+	}
+	t.currentIndex = address
+	return nil
+}
+
+// align skips addresses up to the next multiple of the argument, e.g. `align 16`
+func (t *AsmTranslator) align(argument string) error {
+	if t.relocatable {
+		return errors.New("align can't be used in objects, sections are placed by the linker")
+	}
+	alignment, err := t.evaluateNow("align", argument)
+	if err != nil {
+		return err
+	}
+	if alignment <= 0 {
+		return fmt.Errorf("align expects a positive number, got %d", alignment)
+	}
+	t.currentIndex = (t.currentIndex + alignment - 1) / alignment * alignment
+	return nil
+}
+
+// evaluateNow evaluates an argument which must be known while parsing: constants and labels defined above
+func (t *AsmTranslator) evaluateNow(directive string, argument string) (int, error) {
+	if strings.TrimSpace(argument) == "" {
+		return 0, fmt.Errorf("%s expects an expression", directive)
+	}
+	parsed, err := t.parseScopedExpression(argument)
+	if err != nil {
+		return 0, err
+	}
+	result, err := t.evaluate(parsed, len(t.instructions), &value{number: t.currentIndex}, t.programScope())
+	if err != nil {
+		return 0, err
+	}
+	return result.number, nil
+}
+
+// splitReservation recognizes `res n` and `label: res n`
+func splitReservation(parts []string) (label string, count string, ok bool) {
+	if strings.ToLower(parts[0]) == "res" && len(parts) > 1 {
+		return "", strings.Join(parts[1:], " "), true
+	}
+	if hasLabel(parts) && len(parts) > 2 && strings.ToLower(parts[1]) == "res" {
+		return strings.TrimSuffix(parts[0], ":"), parts[2], true
+	}
+	return "", "", false
+}
+
+// parseReservation reserves zeroed words, it's the same as `word: n dup(0)`
+func (t *AsmTranslator) parseReservation(label string, count string) ([]ParsedInstruction, error) {
+	words, err := t.parseDuplication(count, "0")
+	if err != nil {
+		return nil, err
+	}
+	return labelFirstWord(label, words)
+}
+
+// parseDuplication repeats the values, e.g. `16 dup(0)` or `2 dup(1, 2)`
+func (t *AsmTranslator) parseDuplication(count string, element string) ([]ParsedInstruction, error) {
+	times, err := t.evaluateNow("dup", count)
+	if err != nil {
+		return nil, err
+	}
+	if times < 0 || times > isa.AddrMaxValue+1 {
+		return nil, fmt.Errorf("count %d doesn't fit in memory", times)
+	}
+	words, err := t.parseDataElements(element)
+	if err != nil {
+		return nil, err
+	}
+	// nested counts multiply, so the size is checked before the words are copied
+	if err := checkWordCount(times * len(words)); err != nil {
+		return nil, err
+	}
+	duplicated := make([]ParsedInstruction, 0, times*len(words))
+	for i := 0; i < times; i++ {
+		duplicated = append(duplicated, words...)
+	}
+	return duplicated, nil
+}
+
+// parseDataElements parses a list of elements separated by commas
+func (t *AsmTranslator) parseDataElements(argument string) ([]ParsedInstruction, error) {
+	elements, err := splitArrayElements(argument)
+	if err != nil {
+		return nil, err
+	}
+	words := make([]ParsedInstruction, 0, len(elements))
+	for _, element := range elements {
+		parsed, err := t.parseDataElement(element)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, parsed...)
+		if err := checkWordCount(len(words)); err != nil {
+			return nil, err
+		}
+	}
+	return words, nil
+}
+
+func checkWordCount(count int) error {
+	if count > isa.AddrMaxValue+1 {
+		return fmt.Errorf("%d words don't fit in memory", count)
+	}
+	return nil
+}
+
+// parseDataElement parses an element of `word:`: a string, `count dup(value)` or an expression
+func (t *AsmTranslator) parseDataElement(element string) ([]ParsedInstruction, error) {
+	if count, repeated, ok := splitDuplication(element); ok {
+		return t.parseDuplication(count, repeated)
+	}
+	if isStringLiteral(element) {
+		return parseConstString("", element)
+	}
+	parsed, err := parseExpression(element)
+	if err != nil {
+		return nil, err
+	}
+	switch parsed := parsed.(type) {
+	case numberLiteral:
+		if _, err := parsed.evaluate(evaluationContext{}); err != nil {
+			return nil, err
+		}
+		return wrapInSlice(NewConstant("", int(parsed), isa.ValueTypeNumber), nil)
+	case symbolReference:
+		return wrapInSlice(parseAddressConstantDeclaration("", string(parsed)))
+	default:
+		return wrapInSlice(ParsedInstruction{Opcode: isa.OpcodeNop.String(), ValueType: isa.ValueTypeNumber, Expression: parsed}, nil)
+	}
+}
+
+// splitDuplication recognizes `count dup(value)`
+func splitDuplication(element string) (count string, value string, ok bool) {
+	index := strings.Index(strings.ToLower(element), " dup(")
+	if index == -1 || !strings.HasSuffix(element, ")") {
+		return "", "", false
+	}
+	return element[:index], element[index+len(" dup(") : len(element)-1], true
+}
+
+// splitArrayElements splits `1, 'a,b', (2, 3)` by commas outside of quotes and parentheses
+func splitArrayElements(argument string) ([]string, error) {
+	elements := make([]string, 0)
+	depth := 0
+	quoted := false
+	start := 0
+	for i := 0; i < len(argument); i++ {
+		switch {
+		case argument[i] == '\'':
+			quoted = !quoted
+		case quoted:
+		case argument[i] == '(':
+			depth++
+		case argument[i] == ')':
+			depth--
+		case argument[i] == ',' && depth == 0:
+			elements = append(elements, strings.TrimSpace(argument[start:i]))
+			start = i + 1
+		}
+	}
+	elements = append(elements, strings.TrimSpace(argument[start:]))
+	for _, element := range elements {
+		if element == "" {
+			return nil, errors.New("empty element in array")
+		}
+	}
+	return elements, nil
+}
+
+func labelFirstWord(label string, words []ParsedInstruction) ([]ParsedInstruction, error) {
+	if len(words) == 0 {
+		return nil, fmt.Errorf("constant '%s' has no words", label)
+	}
+	words[0].Label = label
+	return words, nil
+}
+
+// checkLayout reports words placed outside of memory and regions which overlap after org
+func (t *AsmTranslator) checkLayout() {
+	placed := make(map[int]ParsedInstruction)
+	for _, instruction := range t.instructions {
+		if instruction.Index > isa.AddrMaxValue {
+			t.report(newTermError(CodeLayout, fmt.Sprintf("program doesn't fit in memory: word is placed at %d, the last address is %d", instruction.Index, isa.AddrMaxValue), instruction.MetaInfo))
+			// the rest of the words don't fit too
+			return
+		}
+		if previous, ok := placed[instruction.Index]; ok {
+			t.report(newTermError(CodeLayout, fmt.Sprintf("address %d is already taken by line %s", instruction.Index, previous.MetaInfo.Position()), instruction.MetaInfo))
+			continue
+		}
+		placed[instruction.Index] = instruction
+	}
+}
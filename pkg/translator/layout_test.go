@@ -0,0 +1,81 @@
+package translator
+
+import (
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"gotest.tools/v3/assert"
+)
+
+func operands(program isa.Program) map[int]int {
+	words := make(map[int]int)
+	for _, term := range program.Instructions {
+		if term.Operand != nil {
+			words[term.Index] = *term.Operand
+		}
+	}
+	return words
+}
+
+func TestArraysAndDuplication(t *testing.T) {
+	program, err := NewTranslator().Translate(`SIZE equ 3
+table: word: 1, 2 + 1, 'a,b', SIZE dup(7), 2 dup(4, 5)
+buffer: res SIZE - 1
+tail: word: buffer
+start: ld table
+  hlt`)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, operands(program), map[int]int{
+		0: 1, 1: 3, 2: 'a', 3: ',', 4: 'b', 5: 0,
+		6: 7, 7: 7, 8: 7,
+		9: 4, 10: 5, 11: 4, 12: 5,
+		13: 0, 14: 0,
+		15: 13,
+		16: 0,
+	})
+	assert.Equal(t, *program.Instructions[15].Label, "tail")
+	assert.Equal(t, program.StartAddress, 16)
+}
+
+func TestOrgAndAlign(t *testing.T) {
+	program, err := NewTranslator().Translate(`org 0
+vector: word: handler
+org 0x10
+start: ld value
+  hlt
+  align 8
+value: word: * + 1
+handler: iret`)
+	assert.NilError(t, err)
+	indices := make([]int, 0)
+	for _, term := range program.Instructions {
+		indices = append(indices, term.Index)
+	}
+	assert.DeepEqual(t, indices, []int{0, 16, 17, 24, 25})
+	assert.DeepEqual(t, operands(program), map[int]int{0: 25, 16: 24, 24: 25})
+	assert.Equal(t, program.StartAddress, 16)
+}
+
+func TestLayoutErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "start: hlt\norg 0\nvalue: word: 1", expected: "address 0 is already taken by line 1"},
+		{input: "org 2047\nstart: nop\n  hlt", expected: "program doesn't fit in memory: word is placed at 2048"},
+		{input: "org 2048\nstart: hlt", expected: "org address 2048 is out of address range [0, 2047]"},
+		{input: "org later\nstart: hlt\nlater: hlt", expected: "label 'later' not found"},
+		{input: "align 0\nstart: hlt", expected: "align expects a positive number"},
+		{input: "empty: word: 0 dup(1)\nstart: hlt", expected: "constant 'empty' has no words"},
+		{input: "list: word: 1,, 2\nstart: hlt", expected: "empty element in array"},
+		{input: "big: word: 2048 dup(2048 dup(2048 dup(0)))\nstart: hlt", expected: "4194304 words don't fit in memory"},
+		{input: "big: word: 2048 dup(0), 1\nstart: hlt", expected: "2049 words don't fit in memory"},
+	}
+	for _, test := range tests {
+		_, err := NewTranslator().Translate(test.input)
+		assert.ErrorContains(t, err, test.expected, test.input)
+	}
+
+	_, err := NewTranslator().TranslateObject("org 16\nstart: hlt")
+	assert.ErrorContains(t, err, "org can't be used in objects")
+}
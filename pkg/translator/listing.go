@@ -0,0 +1,96 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// listingEntry is a source line, instructions from first up to the first of the next entry are produced by it
+type listingEntry struct {
+	fileName string
+	line     int
+	source   string
+	first    int
+}
+
+// ListingLine is a source line with words which it produced, words of macro expansions belong to the invocation
+type ListingLine struct {
+	FileName string
+	Line     int
+	Source   string
+	Terms    []isa.MachineCodeTerm
+}
+
+func (t *AsmTranslator) GetListing() []ListingLine {
+	return t.listing
+}
+
+func (t *AsmTranslator) buildListing(machineCode []isa.MachineCodeTerm) []ListingLine {
+	lines := make([]ListingLine, 0, len(t.listingEntries))
+	for i, entry := range t.listingEntries {
+		last := len(machineCode)
+		if i+1 < len(t.listingEntries) {
+			last = t.listingEntries[i+1].first
+		}
+		lines = append(lines, ListingLine{FileName: entry.fileName, Line: entry.line, Source: entry.source, Terms: machineCode[entry.first:last]})
+	}
+	return lines
+}
+
+// SerializeListing formats the program as a classic listing: source lines with addresses and encoded words,
+// then the symbol table with reference counts
+func SerializeListing(lines []ListingLine, symbols []SymbolInfo) ([]byte, error) {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("; %4s  %-4s  %-8s  %s\n", "line", "addr", "word", "source"))
+	fileName := ""
+	for _, line := range lines {
+		if line.FileName != fileName {
+			fileName = line.FileName
+			builder.WriteString(fmt.Sprintf("; file %s\n", fileName))
+		}
+		terms := line.Terms
+		if len(terms) == 0 || terms[0].TermInfo.Expansion != "" {
+			builder.WriteString(strings.TrimRight(fmt.Sprintf("%6d  %4s  %8s  %s", line.Line, "", "", line.Source), " ") + "\n")
+		} else {
+			word, err := isa.EncodeTerm(terms[0])
+			if err != nil {
+				return nil, err
+			}
+			builder.WriteString(strings.TrimRight(fmt.Sprintf("%6d  %04X  %08X  %s", line.Line, terms[0].Index, word, line.Source), " ") + "\n")
+			terms = terms[1:]
+		}
+		expansion := ""
+		for _, term := range terms {
+			word, err := isa.EncodeTerm(term)
+			if err != nil {
+				return nil, err
+			}
+			builder.WriteString(strings.TrimRight(fmt.Sprintf("%6s  %04X  %08X  %s", "", term.Index, word, listingComment(term, &expansion)), " ") + "\n")
+		}
+	}
+
+	builder.WriteString(fmt.Sprintf("\n; %-22s %11s  %-5s  %4s  %s\n", "symbol", "value", "kind", "refs", "line"))
+	for _, symbol := range symbols {
+		value := fmt.Sprint(symbol.Value)
+		if symbol.Kind != SymbolEqu && symbol.Kind != SymbolSet {
+			value = fmt.Sprintf("%04X", symbol.Value)
+		}
+		builder.WriteString(fmt.Sprintf("%-24s %11s  %-5s  %4d  %s\n", symbol.Name, value, symbol.Kind, symbol.References, symbol.MetaInfo.Position()))
+	}
+	return []byte(builder.String()), nil
+}
+
+// listingComment shows the line of a macro expansion once for its words, and characters of strings
+func listingComment(term isa.MachineCodeTerm, expansion *string) string {
+	switch {
+	case term.TermInfo.Expansion != "" && term.TermInfo.Expansion != *expansion:
+		*expansion = term.TermInfo.Expansion
+		return "+ " + *expansion
+	case term.OperandType == isa.ValueTypeChar && term.Operand != nil:
+		return fmt.Sprintf("%q", rune(*term.Operand))
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,40 @@
+package translator
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSerializeListing(t *testing.T) {
+	translator := NewTranslator()
+	_, err := translator.Translate(`macro twice value
+  add value
+  add value
+endm
+message: word: 'Hi' ; greeting
+start: twice message
+  jmp start
+`)
+	assert.NilError(t, err)
+
+	listing, err := SerializeListing(translator.GetListing(), translator.GetSymbols())
+	assert.NilError(t, err)
+	assert.Equal(t, string(listing), `; line  addr  word      source
+     1                  macro twice value
+     2                    add value
+     3                    add value
+     4                  endm
+     5  0000  00000048  message: word: 'Hi' ; greeting
+        0001  00000069  'i'
+        0002  00000000  '\x00'
+     6                  start: twice message
+        0003  01600000  + start: add message
+        0004  01600000  + add message
+     7  0005  12600003    jmp start
+
+; symbol                       value  kind   refs  line
+message                         0000  label     2  5
+start                           0003  label     1  6
+`)
+}
@@ -0,0 +1,209 @@
+package translator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// maxMacroDepth limits nested expansion, so a recursive macro fails instead of hanging
+const maxMacroDepth = 32
+
+// localLabelPrefix marks labels which get a unique suffix in every expansion, e.g. `%%loop`
+const localLabelPrefix = "%%"
+
+type macro struct {
+	name       string
+	parameters []string
+	body       []string
+	metaInfo   isa.TermMetaInfo
+}
+
+// beginMacro starts recording of a macro definition: `macro name arg1, arg2`
+func (t *AsmTranslator) beginMacro(argument string) error {
+	fields := strings.Fields(argument)
+	if len(fields) == 0 {
+		return errors.New("macro expects a name")
+	}
+	name := strings.ToLower(fields[0])
+	if !isIdentifier(name) {
+		return fmt.Errorf("invalid macro name '%s'", fields[0])
+	}
+	if _, err := isa.GetOpcodeFromString(name); err == nil {
+		return fmt.Errorf("macro name '%s' is an instruction", name)
+	}
+	if _, ok := findDirective(name); ok {
+		return fmt.Errorf("macro name '%s' is a directive", name)
+	}
+	if _, ok := t.macros[name]; ok {
+		return fmt.Errorf("macro '%s' is already defined", name)
+	}
+	parameters := make([]string, 0)
+	if len(fields) > 1 {
+		var err error
+		parameters, err = parseSymbolNames("macro", strings.TrimSpace(argument[len(fields[0]):]))
+		if err != nil {
+			return err
+		}
+	}
+	for _, parameter := range parameters {
+		if !isIdentifier(parameter) {
+			return fmt.Errorf("invalid macro parameter '%s'", parameter)
+		}
+	}
+	t.recordedMacro = &macro{name: name, parameters: parameters, body: make([]string, 0)}
+	return nil
+}
+
+func (t *AsmTranslator) endMacro(_ string) error {
+	return errors.New("endm without macro")
+}
+
+// recordMacroLine adds the line to the body of the macro which is being defined
+func (t *AsmTranslator) recordMacroLine(line string, metaInfo isa.TermMetaInfo) error {
+	fields := strings.Fields(line)
+	switch strings.ToLower(fields[0]) {
+	case "endm":
+		if len(fields) > 1 {
+			return newTermError(CodeMacro, "endm doesn't take arguments", metaInfo)
+		}
+		if t.macros == nil {
+			t.macros = make(map[string]*macro)
+		}
+		t.recordedMacro.metaInfo = metaInfo
+		t.macros[t.recordedMacro.name] = t.recordedMacro
+		t.recordedMacro = nil
+	case "macro":
+		return newTermError(CodeMacro, "macro definitions can't be nested", metaInfo)
+	default:
+		if label := strings.TrimSuffix(fields[0], ":"); label != fields[0] && expansionSuffix.MatchString(label) {
+			return newTermError(CodeMacro, reservedLabel(label).Error(), metaInfo)
+		}
+		t.recordedMacro.body = append(t.recordedMacro.body, line)
+	}
+	return nil
+}
+
+// findMacroInvocation recognizes `name args` and `label: name args`
+func (t *AsmTranslator) findMacroInvocation(line string) (label string, invoked *macro, arguments []string, ok bool) {
+	fields := strings.Fields(line)
+	if strings.HasSuffix(fields[0], ":") {
+		label = strings.TrimSuffix(fields[0], ":")
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return "", nil, nil, false
+	}
+	invoked, ok = t.macros[strings.ToLower(fields[0])]
+	if !ok {
+		return "", nil, nil, false
+	}
+	arguments = make([]string, 0)
+	if len(fields) > 1 {
+		for _, argument := range strings.Split(strings.Join(fields[1:], " "), ",") {
+			arguments = append(arguments, strings.TrimSpace(argument))
+		}
+	}
+	return label, invoked, arguments, true
+}
+
+// expandMacro parses the body of the macro with substituted arguments. Expanded lines keep
+// the position of the outermost invocation, the expanded text is saved as Expansion.
+func (t *AsmTranslator) expandMacro(invoked *macro, label string, arguments []string, metaInfo isa.TermMetaInfo) error {
+	if len(arguments) != len(invoked.parameters) {
+		return fmt.Errorf("macro '%s' expects %d arguments, got %d", invoked.name, len(invoked.parameters), len(arguments))
+	}
+	if len(t.expansionStack) == maxMacroDepth {
+		return fmt.Errorf("macro expansion is deeper than %d, is '%s' recursive?", maxMacroDepth, invoked.name)
+	}
+	if t.invocation == nil {
+		t.invocation = &metaInfo
+		defer func() { t.invocation = nil }()
+	}
+	t.macroExpansions++
+	t.expansionStack = append(t.expansionStack, invoked.name)
+	defer func() { t.expansionStack = t.expansionStack[:len(t.expansionStack)-1] }()
+
+	suffix := "__" + strconv.Itoa(t.macroExpansions)
+	for _, line := range invoked.body {
+		expanded := substituteMacroArguments(line, invoked.parameters, arguments, suffix)
+		// the label of the invocation is put on the first line which may emit words
+		if label != "" && emitsWords(expanded) {
+			if strings.HasSuffix(strings.Fields(expanded)[0], ":") {
+				return fmt.Errorf("label '%s' conflicts with label of the first line of macro '%s'", label, invoked.name)
+			}
+			expanded = label + ": " + expanded
+			label = ""
+		}
+		if err := t.parseLine(expanded, metaInfo.LineNum); err != nil {
+			t.report(err)
+			t.skipLabel(expanded)
+		}
+	}
+	if label != "" {
+		return fmt.Errorf("label '%s' is attached to macro '%s' which emits no words", label, invoked.name)
+	}
+	return nil
+}
+
+// emitsWords checks whether the line of a macro body may emit words, directives and symbolic constants don't
+func emitsWords(line string) bool {
+	if _, _, _, ok := splitConstantDefinition(line); ok {
+		return false
+	}
+	_, ok := findDirective(strings.Fields(line)[0])
+	return !ok
+}
+
+// substituteMacroArguments replaces parameter names and local labels outside of string literals
+func substituteMacroArguments(line string, parameters []string, arguments []string, suffix string) string {
+	result := strings.Builder{}
+	inString := false
+	for i := 0; i < len(line); {
+		char := line[i]
+		switch {
+		case char == '\'':
+			inString = !inString
+			result.WriteByte(char)
+			i++
+		case !inString && strings.HasPrefix(line[i:], localLabelPrefix):
+			end := identifierEnd(line, i+len(localLabelPrefix))
+			result.WriteString(line[i+len(localLabelPrefix):end] + suffix)
+			i = end
+		case !inString && isIdentifierStart(char):
+			end := identifierEnd(line, i)
+			word := line[i:end]
+			for j, parameter := range parameters {
+				if word == parameter {
+					word = arguments[j]
+					break
+				}
+			}
+			result.WriteString(word)
+			i = end
+		default:
+			result.WriteByte(char)
+			i++
+		}
+	}
+	return result.String()
+}
+
+func identifierEnd(line string, start int) int {
+	end := start
+	for end < len(line) && (isIdentifierStart(line[end]) || line[end] >= '0' && line[end] <= '9') {
+		end++
+	}
+	return end
+}
+
+func isIdentifierStart(char byte) bool {
+	return char == '_' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z'
+}
+
+func isIdentifier(name string) bool {
+	return name != "" && isIdentifierStart(name[0]) && identifierEnd(name, 0) == len(name)
+}
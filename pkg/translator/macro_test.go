@@ -0,0 +1,79 @@
+package translator
+
+import (
+	"testing"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+	"gotest.tools/v3/assert"
+)
+
+func TestMacroExpansion(t *testing.T) {
+	program, err := NewTranslator().Translate(`macro twice target
+  inc
+  %%again: st target
+endm
+value: word: 0
+start: twice value
+  twice value
+  hlt`)
+	assert.NilError(t, err)
+
+	labels := make([]string, 0)
+	for _, term := range program.Instructions {
+		if term.Label != nil {
+			labels = append(labels, *term.Label)
+		}
+	}
+	assert.DeepEqual(t, labels, []string{"value", "start", "again__1", "again__2"})
+	assert.Equal(t, program.Instructions[1].TermInfo, isa.TermMetaInfo{LineNum: 6, OriginalContent: "start: twice value", Expansion: "start: inc"})
+	assert.Equal(t, *program.Instructions[2].Label, "again__1")
+	assert.Equal(t, *program.Instructions[2].Operand, 0)
+	assert.Equal(t, program.Instructions[3].TermInfo.LineNum, 7)
+}
+
+func TestSubstituteMacroArguments(t *testing.T) {
+	line := substituteMacroArguments("%%loop: ld (ptr) ; ptr", []string{"ptr"}, []string{"pointer"}, "__3")
+	assert.Equal(t, line, "loop__3: ld (pointer) ; pointer")
+	line = substituteMacroArguments("name: word: 'ptr'", []string{"ptr"}, []string{"pointer"}, "__1")
+	assert.Equal(t, line, "name: word: 'ptr'")
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		err    string
+	}{
+		{name: "wrong arity", source: "macro m a\n  ld a\nendm\nstart: m", err: "macro 'm' expects 1 arguments, got 0"},
+		{name: "recursion", source: "macro m\n  m\nendm\nstart: m", err: "macro expansion is deeper than 32, is 'm' recursive?"},
+		{name: "not closed", source: "macro m\n  hlt", err: "macro 'm' is not closed with endm"},
+		{name: "nested definition", source: "macro m\n  macro n\nendm", err: "macro definitions can't be nested"},
+		{name: "instruction name", source: "macro ld\nendm", err: "macro name 'ld' is an instruction"},
+		{name: "endm without macro", source: "start: hlt\nendm", err: "endm without macro"},
+		{name: "expansion label in source", source: "again__1: nop\nstart: hlt", err: "label 'again__1' is reserved, names ending with '__' and a number are made by macro expansions"},
+		{name: "expansion label in body", source: "macro m\n  again__1: nop\nendm\nstart: hlt", err: "label 'again__1' is reserved"},
+		{name: "label without words", source: "macro m\n  writable\nendm\nstart: nop\nhere: m\n  endwritable\n  hlt", err: "label 'here' is attached to macro 'm' which emits no words"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewTranslator().Translate(test.source)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+// the label of the invocation is put on the first word, directives of the body don't take it
+func TestMacroLabelSkipsDirectives(t *testing.T) {
+	program, err := NewTranslator().Translate(`macro patchable
+  writable
+  nop
+  endwritable
+endm
+start: jmp slot
+slot: patchable
+  hlt`)
+	assert.NilError(t, err)
+	assert.Equal(t, *program.Instructions[1].Label, "slot")
+	assert.Equal(t, program.Instructions[1].Writable, true)
+	assert.Equal(t, *program.Instructions[0].Operand, 1)
+}
@@ -0,0 +1,147 @@
+package translator
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+var sectionOrder = []isa.SectionKind{isa.SectionData, isa.SectionCode}
+
+// TranslateObject translates a single unit into a relocatable object: constants go to the data section,
+// instructions to the code section, and every label operand becomes a relocation. Labels declared
+// with `extern` may be defined in other objects, `start` is not required.
+func (t *AsmTranslator) TranslateObject(input string) (isa.Object, error) {
+	t.relocatable = true
+	t.parse(input)
+	if t.options.Optimize && t.errorsFound() == nil {
+		t.optimize()
+	}
+	symbols := t.placeInSections()
+	t.checkConstantNames()
+
+	object := isa.Object{Symbols: symbols, Imports: t.imports}
+	terms := make(map[isa.SectionKind][]isa.MachineCodeTerm)
+	for i, instruction := range t.instructions {
+		var operand *int
+		if expression := operandExpression(instruction); expression != nil {
+			result, err := t.evaluateInObject(expression, instruction, i, symbols)
+			if err != nil {
+				t.reportOperandError(err, instruction)
+				continue
+			}
+			if target, ok := t.objectTarget(result, symbols); ok {
+				t.checkOperandTarget(instruction, target)
+			}
+			operand = new(int)
+			if result.isAbsolute() {
+				*operand = result.number
+				if err := checkOperandRange(instruction, *operand); err != nil {
+					t.report(newTermError(CodeOperand, err.Error(), instruction.MetaInfo))
+				}
+			} else {
+				object.Relocations = append(object.Relocations, isa.Relocation{
+					Section: instruction.Section,
+					Offset:  instruction.Index,
+					Symbol:  result.symbol,
+					Target:  result.section,
+					Addend:  result.number,
+				})
+			}
+		} else if instruction.ValueType != isa.ValueTypeNone {
+			operand = new(int)
+			*operand = instruction.Operand
+		}
+		term, err := newMachineCodeTerm(instruction, operand)
+		if err != nil {
+			t.report(newTermError(CodeUnknownInstruction, err.Error(), instruction.MetaInfo))
+			continue
+		}
+		terms[instruction.Section] = append(terms[instruction.Section], term)
+	}
+	if err := t.errorsFound(); err != nil {
+		return isa.Object{}, err
+	}
+
+	for _, kind := range sectionOrder {
+		if len(terms[kind]) > 0 {
+			object.Sections = append(object.Sections, isa.Section{Kind: kind, Terms: terms[kind]})
+		}
+	}
+	return object, nil
+}
+
+// evaluateInObject keeps labels symbolic, so the result is relocatable unless it's a constant or a difference of labels
+func (t *AsmTranslator) evaluateInObject(operand expression, instruction ParsedInstruction, position int, symbols []isa.Symbol) (value, error) {
+	findSymbol := func(name string) (isa.Symbol, bool) {
+		index := slices.IndexFunc(symbols, func(symbol isa.Symbol) bool { return symbol.Name == name })
+		if index == -1 {
+			return isa.Symbol{}, false
+		}
+		return symbols[index], true
+	}
+	return t.evaluate(operand, position, &value{section: instruction.Section, number: instruction.Index}, unitScope{
+		resolveLabel: func(name string) (value, error) {
+			if _, ok := findSymbol(name); !ok && !slices.Contains(t.imports, name) {
+				return value{}, labelNotFound(name)
+			}
+			return value{symbol: name}, nil
+		},
+		offsetOf: func(v value) (isa.SectionKind, int, bool) {
+			if v.section != "" {
+				return v.section, v.number, true
+			}
+			symbol, ok := findSymbol(v.symbol)
+			return symbol.Section, symbol.Offset + v.number, ok
+		},
+	})
+}
+
+// objectTarget finds the word of the unit which a relocatable operand points to
+func (t *AsmTranslator) objectTarget(result value, symbols []isa.Symbol) (ParsedInstruction, bool) {
+	section, offset := result.section, result.number
+	if section == "" {
+		index := slices.IndexFunc(symbols, func(symbol isa.Symbol) bool { return symbol.Name == result.symbol })
+		if result.symbol == "" || index == -1 {
+			return ParsedInstruction{}, false
+		}
+		section, offset = symbols[index].Section, symbols[index].Offset+result.number
+	}
+	index := slices.IndexFunc(t.instructions, func(instruction ParsedInstruction) bool {
+		return instruction.Section == section && instruction.Index == offset
+	})
+	if index == -1 {
+		return ParsedInstruction{}, false
+	}
+	return t.instructions[index], true
+}
+
+// placeInSections numbers instructions inside of their sections and collects defined symbols
+func (t *AsmTranslator) placeInSections() []isa.Symbol {
+	offsets := make(map[isa.SectionKind]int)
+	symbols := make([]isa.Symbol, 0)
+	for i, instruction := range t.instructions {
+		instruction.Index = offsets[instruction.Section]
+		offsets[instruction.Section]++
+		t.instructions[i] = instruction
+		if instruction.Label == "" {
+			continue
+		}
+		if slices.Contains(t.imports, instruction.Label) {
+			t.report(newTermError(CodeLabel, fmt.Sprintf("label '%s' is declared as extern", instruction.Label), instruction.MetaInfo))
+		}
+		symbols = append(symbols, isa.Symbol{
+			Name:     instruction.Label,
+			Section:  instruction.Section,
+			Offset:   instruction.Index,
+			Exported: slices.Contains(t.exports, instruction.Label),
+		})
+	}
+	for _, name := range t.exports {
+		if !slices.ContainsFunc(symbols, func(symbol isa.Symbol) bool { return symbol.Name == name }) {
+			t.report(ParseError{message: fmt.Sprintf("global label '%s' is not defined", name), fileName: t.options.FileName, code: CodeLabel})
+		}
+	}
+	return symbols
+}
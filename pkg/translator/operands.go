@@ -0,0 +1,75 @@
+package translator
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// operandModes lists addressing modes of each type of instructions, ValueTypeNone stands for an instruction without operand.
+// The control unit ignores the mode of branches, and IO instructions read the port number from a word directly.
+var operandModes = map[isa.OpcodeType][]isa.ValueType{
+	isa.OpcodeTypeAddress:     {isa.ValueTypeAddressDirect, isa.ValueTypeAddressIndirect},
+	isa.OpcodeTypeAddressless: {isa.ValueTypeNone},
+	isa.OpcodeTypeBranch:      {isa.ValueTypeAddressDirect},
+	isa.OpcodeTypeIO:          {isa.ValueTypeAddressDirect},
+}
+
+// validateOperands checks operands of instructions against their opcodes, constants are not checked
+func (t *AsmTranslator) validateOperands() {
+	for _, instruction := range t.instructions {
+		if instruction.Section != isa.SectionCode {
+			continue
+		}
+		if err := checkOperandMode(instruction); err != nil {
+			t.report(newTermError(CodeOperand, err.Error(), instruction.MetaInfo))
+		}
+	}
+}
+
+func checkOperandMode(instruction ParsedInstruction) error {
+	opcode, err := isa.GetOpcodeFromString(instruction.Opcode)
+	if err != nil {
+		return err
+	}
+	modes := operandModes[opcode.Type()]
+	switch {
+	case slices.Contains(modes, instruction.ValueType):
+		return nil
+	case instruction.ValueType == isa.ValueTypeNone:
+		return fmt.Errorf("instruction '%s' requires an operand", instruction.Opcode)
+	case slices.Contains(modes, isa.ValueTypeNone):
+		return fmt.Errorf("instruction '%s' takes no operand", instruction.Opcode)
+	default:
+		return fmt.Errorf("indirect addressing is not supported by '%s'", instruction.Opcode)
+	}
+}
+
+// checkOperandTarget warns about jumps to constants and reads of instructions outside of writable regions
+func (t *AsmTranslator) checkOperandTarget(instruction ParsedInstruction, target ParsedInstruction) {
+	if instruction.Section != isa.SectionCode || instruction.ValueType != isa.ValueTypeAddressDirect {
+		return
+	}
+	opcode, err := isa.GetOpcodeFromString(instruction.Opcode)
+	if err != nil {
+		return
+	}
+	switch {
+	case opcode.Type() == isa.OpcodeTypeBranch && target.Section == isa.SectionData:
+		t.warn(CodeJumpIntoData, fmt.Sprintf("'%s' jumps to data at %s", instruction.Opcode, targetName(target)), instruction.MetaInfo)
+	case readsOperand(opcode) && target.Section == isa.SectionCode && !target.Writable:
+		t.warn(CodeLoadFromCode, fmt.Sprintf("'%s' reads the instruction at %s", instruction.Opcode, targetName(target)), instruction.MetaInfo)
+	}
+}
+
+func readsOperand(opcode isa.Opcode) bool {
+	return opcode.Type() == isa.OpcodeTypeIO || opcode.Type() == isa.OpcodeTypeAddress && opcode != isa.OpcodeStore
+}
+
+func targetName(target ParsedInstruction) string {
+	if target.Label != "" {
+		return fmt.Sprintf("'%s'", target.Label)
+	}
+	return fmt.Sprint(target.Index)
+}
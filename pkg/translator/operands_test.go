@@ -0,0 +1,55 @@
+package translator
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestOperandArityAndModes(t *testing.T) {
+	translator := NewTranslator()
+	_, err := translator.Translate(`value: word: 1
+start: hlt value
+  ld
+  jmp (value)
+  out (value)
+  ld (value)
+missing:
+  hlt`)
+	assert.ErrorContains(t, err, "instruction 'hlt' takes no operand")
+	assert.DeepEqual(t, positions(translator.GetDiagnostics()), []position{
+		{CodeOperand, 2, 8, 3},
+		{CodeOperand, 3, 3, 2},
+		{CodeOperand, 4, 3, 3},
+		{CodeOperand, 5, 3, 3},
+		{CodeSyntax, 7, 1, 7},
+	})
+	assert.Equal(t, translator.GetDiagnostics()[1].Message, "instruction 'ld' requires an operand")
+	assert.Equal(t, translator.GetDiagnostics()[2].Message, "indirect addressing is not supported by 'jmp'")
+}
+
+func TestOperandTargetWarnings(t *testing.T) {
+	translator := NewTranslator()
+	_, err := translator.Translate(`value: word: 1
+start: jmp value
+  ld start
+  ld patch
+  jmp start
+  writable
+patch: nop
+  endwritable`)
+	assert.NilError(t, err)
+	diagnostics := translator.GetDiagnostics()
+	assert.DeepEqual(t, positions(diagnostics), []position{{CodeJumpIntoData, 2, 8, 3}, {CodeLoadFromCode, 3, 3, 2}})
+	assert.Equal(t, diagnostics[0].Message, "'jmp' jumps to data at 'value'")
+	assert.Equal(t, diagnostics[1].Message, "'ld' reads the instruction at 'start'")
+}
+
+func TestOperandTargetWarningsInObject(t *testing.T) {
+	translator := NewTranslator()
+	_, err := translator.TranslateObject(`value: word: 1
+main: jmp value + 0
+  ld main`)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, positions(translator.GetDiagnostics()), []position{{CodeJumpIntoData, 2, 7, 3}, {CodeLoadFromCode, 3, 3, 2}})
+}
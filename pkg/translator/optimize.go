@@ -0,0 +1,304 @@
+package translator
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+// Rules of the peephole optimizer
+const (
+	// RuleStoreLoad removes `ld x` after `st x`, AC already holds the value. In programs with interrupts the handler
+	// must save AC and must not write x.
+	RuleStoreLoad = "store-load"
+	// RuleDeadLoad removes `cla` or `ld` followed by `ld`, which overwrites AC and flags
+	RuleDeadLoad = "dead-load"
+	// RuleBranchToNext removes a jump or a conditional branch to the next instruction
+	RuleBranchToNext = "branch-to-next"
+)
+
+// Optimization is an instruction removed by the optimizer
+type Optimization struct {
+	Rule     string
+	Address  int
+	MetaInfo isa.TermMetaInfo
+}
+
+func (o Optimization) String() string {
+	source := o.MetaInfo.OriginalContent
+	if o.MetaInfo.Expansion != "" {
+		source = o.MetaInfo.Expansion
+	}
+	return fmt.Sprintf("%s: %s: removed '%s'", o.MetaInfo.Position(), o.Rule, strings.TrimSpace(source))
+}
+
+func (t *AsmTranslator) GetOptimizations() []Optimization {
+	return t.optimizations
+}
+
+// optimize applies peephole rules to pairs of adjacent instructions until none applies. Labeled instructions
+// are kept because they may be branch targets, writable code may be patched and isn't touched. Instructions
+// after a removed one move up to the next `org`, so addresses must be referenced by labels: the pass is skipped
+// when the location counter `*` is used in operands or constants.
+func (t *AsmTranslator) optimize() {
+	if t.usesCurrentAddress() {
+		return
+	}
+	handler := t.interruptHandler()
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i+1 < len(t.instructions); i++ {
+			rule, position, ok := t.matchRule(i)
+			if ok && rule == RuleStoreLoad && !handler.keepsVariable(t.instructions[position]) {
+				continue
+			}
+			if ok && t.canMove(position) {
+				removed := t.instructions[position]
+				t.optimizations = append(t.optimizations, Optimization{Rule: rule, Address: removed.Index, MetaInfo: removed.MetaInfo})
+				t.removeInstruction(position)
+				changed = true
+			}
+		}
+	}
+}
+
+// matchRule checks rules for the instruction and the next one and returns the position of the removed instruction
+func (t *AsmTranslator) matchRule(position int) (string, int, bool) {
+	current, next := t.instructions[position], t.instructions[position+1]
+	first, ok := codeOpcode(current)
+	if !ok || current.Writable || next.Writable || next.Index != current.Index+1 {
+		return "", 0, false
+	}
+	if first.Type() == isa.OpcodeTypeBranch && current.Label == "" && current.LabelOperand != "" && current.LabelOperand == next.Label {
+		return RuleBranchToNext, position, true
+	}
+	second, ok := codeOpcode(next)
+	if !ok {
+		return "", 0, false
+	}
+	switch {
+	case (first == isa.OpcodeCla || first == isa.OpcodeLoad) && second == isa.OpcodeLoad && current.Label == "":
+		return RuleDeadLoad, position, true
+	case first == isa.OpcodeStore && second == isa.OpcodeLoad && next.Label == "" && sameDirectOperand(current, next) && t.flagsOverwritten(position+2):
+		return RuleStoreLoad, position + 1, true
+	}
+	return "", 0, false
+}
+
+func codeOpcode(instruction ParsedInstruction) (isa.Opcode, bool) {
+	if instruction.Section == isa.SectionData {
+		return isa.OpcodeNop, false
+	}
+	opcode, err := isa.GetOpcodeFromString(instruction.Opcode)
+	return opcode, err == nil
+}
+
+func sameDirectOperand(a ParsedInstruction, b ParsedInstruction) bool {
+	if a.ValueType != isa.ValueTypeAddressDirect || b.ValueType != isa.ValueTypeAddressDirect {
+		return false
+	}
+	if a.Expression != nil || b.Expression != nil {
+		return a.Expression != nil && b.Expression != nil && a.Expression.String() == b.Expression.String()
+	}
+	return a.LabelOperand == b.LabelOperand && a.Operand == b.Operand
+}
+
+// handlerEffects is what the interrupt handler may change in the interrupted code
+type handlerEffects struct {
+	// interrupted is set for programs with `ei`
+	interrupted bool
+	// known is unset when the vector isn't a label or the handler stores by pointers or leaves its code
+	// by a computed branch
+	known bool
+	// savesAC is set when the handler starts with `push` and returns right after `pop`
+	savesAC bool
+	stores  []ParsedInstruction
+}
+
+// keepsVariable checks that an interrupt between `st x` and `ld x` leaves both AC and x unchanged
+func (e handlerEffects) keepsVariable(load ParsedInstruction) bool {
+	if !e.interrupted {
+		return true
+	}
+	if !e.known || !e.savesAC {
+		return false
+	}
+	for _, store := range e.stores {
+		if sameDirectOperand(store, load) {
+			return false
+		}
+	}
+	return true
+}
+
+// interruptHandler follows the handler from the vector at address 0 to its returns. `hlt` in a handler returns
+// to the interrupted code like `iret`.
+func (t *AsmTranslator) interruptHandler() handlerEffects {
+	positions := make(map[string]int)
+	vector := -1
+	effects := handlerEffects{}
+	for i, instruction := range t.instructions {
+		if instruction.Label != "" {
+			positions[instruction.Label] = i
+		}
+		if instruction.Index == 0 {
+			vector = i
+		}
+		if opcode, ok := codeOpcode(instruction); ok && opcode == isa.OpcodeEi {
+			effects.interrupted = true
+		}
+	}
+	if !effects.interrupted || vector < 0 || t.instructions[vector].LabelOperand == "" {
+		return effects
+	}
+	entry, ok := positions[t.instructions[vector].LabelOperand]
+	if !ok {
+		return effects
+	}
+	returns := func(position int) bool {
+		opcode, ok := codeOpcode(t.instructions[position])
+		return ok && (opcode == isa.OpcodeIret || opcode == isa.OpcodeHlt)
+	}
+	entryOpcode, _ := codeOpcode(t.instructions[entry])
+	effects.savesAC = entryOpcode == isa.OpcodePush
+	visited := make(map[int]bool)
+	pending := []int{entry}
+	for len(pending) > 0 {
+		position := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if visited[position] || position >= len(t.instructions) {
+			continue
+		}
+		visited[position] = true
+		instruction := t.instructions[position]
+		opcode, ok := codeOpcode(instruction)
+		if !ok || instruction.Writable {
+			return effects
+		}
+		contiguous := position+1 < len(t.instructions) && t.instructions[position+1].Index == instruction.Index+1
+		switch {
+		case opcode == isa.OpcodeStore && instruction.ValueType != isa.ValueTypeAddressDirect:
+			return effects
+		case opcode == isa.OpcodeStore:
+			effects.stores = append(effects.stores, instruction)
+		case opcode == isa.OpcodePush && position != entry,
+			opcode == isa.OpcodePop && (!contiguous || !returns(position+1)):
+			effects.savesAC = false
+		case opcode == isa.OpcodeIret || opcode == isa.OpcodeHlt:
+			previous, _ := codeOpcode(t.instructions[max(position-1, 0)])
+			if instruction.Label != "" || position == 0 || previous != isa.OpcodePop {
+				effects.savesAC = false
+			}
+			continue
+		case opcode.Type() == isa.OpcodeTypeBranch:
+			target, ok := positions[instruction.LabelOperand]
+			if !ok {
+				return effects
+			}
+			if target == entry {
+				effects.savesAC = false
+			}
+			pending = append(pending, target)
+			if opcode == isa.OpcodeJmp {
+				continue
+			}
+		}
+		if !contiguous {
+			return effects
+		}
+		pending = append(pending, position+1)
+	}
+	effects.known = true
+	return effects
+}
+
+// flagsOverwritten checks that instructions executed from the position set flags before reading them,
+// so flags set by a removed `ld` aren't used. Control transfers end the check.
+func (t *AsmTranslator) flagsOverwritten(position int) bool {
+	for i := position; i < len(t.instructions); i++ {
+		opcode, ok := codeOpcode(t.instructions[i])
+		if !ok || i > position && t.instructions[i].Index != t.instructions[i-1].Index+1 {
+			return false
+		}
+		switch opcode {
+		case isa.OpcodeAdd, isa.OpcodeSub, isa.OpcodeCmp, isa.OpcodeMod, isa.OpcodeInc, isa.OpcodeDec, isa.OpcodeLoad, isa.OpcodeCla:
+			return true
+		case isa.OpcodeHlt:
+			return true
+		}
+		if opcode.Type() == isa.OpcodeTypeBranch || opcode == isa.OpcodeIret {
+			return false
+		}
+	}
+	return false
+}
+
+// canMove checks that instructions which move after the removal aren't referenced by absolute addresses
+func (t *AsmTranslator) canMove(position int) bool {
+	first := t.instructions[position].Index
+	last := first
+	for i := position + 1; i < len(t.instructions) && t.instructions[i].Index == last+1; i++ {
+		last++
+	}
+	for _, instruction := range t.instructions {
+		absolute := instruction.LabelOperand == "" && instruction.Expression == nil &&
+			(instruction.ValueType == isa.ValueTypeAddressDirect || instruction.ValueType == isa.ValueTypeAddressIndirect)
+		if absolute && instruction.Operand >= first && instruction.Operand <= last {
+			return false
+		}
+	}
+	return true
+}
+
+// removeInstruction moves the following instructions of the same contiguous region up, regions placed by `org`
+// keep their addresses
+func (t *AsmTranslator) removeInstruction(position int) {
+	removed := t.instructions[position]
+	for i := position + 1; i < len(t.instructions) && t.instructions[i].Index == removed.Index+i-position; i++ {
+		t.instructions[i].Index--
+	}
+	t.instructions = slices.Delete(t.instructions, position, position+1)
+	for i := range t.listingEntries {
+		if t.listingEntries[i].first > position {
+			t.listingEntries[i].first--
+		}
+	}
+	for _, definitions := range t.constants {
+		for i := range definitions {
+			if definitions[i].position > position {
+				definitions[i].position--
+			}
+		}
+	}
+}
+
+func (t *AsmTranslator) usesCurrentAddress() bool {
+	for _, instruction := range t.instructions {
+		if instruction.Expression != nil && containsCurrentAddress(instruction.Expression) {
+			return true
+		}
+	}
+	for _, definitions := range t.constants {
+		for _, definition := range definitions {
+			if containsCurrentAddress(definition.expression) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsCurrentAddress(e expression) bool {
+	switch e := e.(type) {
+	case currentAddress:
+		return true
+	case negation:
+		return containsCurrentAddress(e.operand)
+	case binaryOperation:
+		return containsCurrentAddress(e.left) || containsCurrentAddress(e.right)
+	default:
+		return false
+	}
+}
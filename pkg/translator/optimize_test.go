@@ -0,0 +1,159 @@
+package translator
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+type removal struct {
+	Rule    string
+	Address int
+	Line    int
+}
+
+func removals(optimizations []Optimization) []removal {
+	result := make([]removal, 0, len(optimizations))
+	for _, optimization := range optimizations {
+		result = append(result, removal{optimization.Rule, optimization.Address, optimization.MetaInfo.LineNum})
+	}
+	return result
+}
+
+func TestPeepholeRules(t *testing.T) {
+	translator := NewTranslatorWithOptions(Options{Optimize: true})
+	program, err := translator.Translate(`x: word: 0
+y: word: 1
+start: cla
+  ld x
+  st y
+  ld y
+  add x
+  cla
+  jmp next
+next: st x
+  ld x
+  jz done
+  ld y
+  ld x
+done: hlt
+pointer: word: done`)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, removals(translator.GetOptimizations()), []removal{
+		{RuleStoreLoad, 5, 6},
+		{RuleBranchToNext, 7, 9},
+		{RuleDeadLoad, 10, 13},
+	})
+	assert.Equal(t, len(program.Instructions), 13)
+	// labels move with instructions, the data word holds the new address of `done`
+	assert.Equal(t, *program.Instructions[11].Label, "done")
+	assert.Equal(t, program.Instructions[11].Index, 11)
+	assert.Equal(t, *program.Instructions[12].Operand, 11)
+}
+
+// labeled instructions may be branch targets, writable code may be patched, `ld` after `st` sets flags for `jz`
+func TestPeepholeKeepsUnsafeInstructions(t *testing.T) {
+	translator := NewTranslatorWithOptions(Options{Optimize: true})
+	_, err := translator.Translate(`x: word: 0
+start: st x
+again: ld x
+  st x
+  ld x
+  jz again
+  writable
+  jmp patched
+patched: hlt
+  endwritable`)
+	assert.NilError(t, err)
+	assert.Equal(t, len(translator.GetOptimizations()), 0)
+}
+
+func TestPeepholeKeepsRegions(t *testing.T) {
+	translator := NewTranslatorWithOptions(Options{Optimize: true})
+	program, err := translator.Translate(`start: nop
+  cla
+  ld value
+  jmp handler
+  org 10
+handler: hlt
+value: word: 1`)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, removals(translator.GetOptimizations()), []removal{{RuleDeadLoad, 1, 2}})
+	assert.Equal(t, program.Instructions[3].Index, 10)
+	assert.Equal(t, *program.Instructions[1].Operand, 11)
+}
+
+func TestPeepholeSkipsCurrentAddress(t *testing.T) {
+	translator := NewTranslatorWithOptions(Options{Optimize: true})
+	_, err := translator.Translate(`start: cla
+  ld value
+  jmp * + 1
+value: word: 1`)
+	assert.NilError(t, err)
+	assert.Equal(t, len(translator.GetOptimizations()), 0)
+}
+
+// the handler saves AC but may change `flag` between `st flag` and `ld flag`, variables it doesn't write are optimized
+func TestPeepholeKeepsVariablesOfInterruptHandler(t *testing.T) {
+	translator := NewTranslatorWithOptions(Options{Optimize: true})
+	_, err := translator.Translate(`vector: word: interrupt
+in_port: word: 0
+flag: word: 0
+count: word: 0
+start: ei
+spin_loop: cla
+  st flag
+  ld flag
+  cmp count
+  jz spin_loop
+  st count
+  ld count
+  inc
+  hlt
+interrupt: push
+  in in_port
+  jz returning
+  st flag
+returning: pop
+  iret`)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, removals(translator.GetOptimizations()), []removal{{RuleStoreLoad, 11, 12}})
+}
+
+// stores by pointers may write any variable
+func TestPeepholeKeepsLoadsWithUnknownHandlerStores(t *testing.T) {
+	translator := NewTranslatorWithOptions(Options{Optimize: true})
+	_, err := translator.Translate(`vector: word: interrupt
+pointer: word: count
+count: word: 0
+start: ei
+  st count
+  ld count
+  inc
+  hlt
+interrupt: push
+  st (pointer)
+  pop
+  iret`)
+	assert.NilError(t, err)
+	assert.Equal(t, len(translator.GetOptimizations()), 0)
+}
+
+// the handler overwrites AC by `in`, an interrupt after `st count` would leave the input in AC instead of count
+func TestPeepholeKeepsLoadsWhenHandlerChangesAccumulator(t *testing.T) {
+	translator := NewTranslatorWithOptions(Options{Optimize: true})
+	_, err := translator.Translate(`vector: word: interrupt
+in_port: word: 0
+char: word: 0
+count: word: 0
+start: ei
+  st count
+  ld count
+  inc
+  hlt
+interrupt: in in_port
+  st char
+  iret`)
+	assert.NilError(t, err)
+	assert.Equal(t, len(translator.GetOptimizations()), 0)
+}
@@ -0,0 +1,97 @@
+package translator
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Moleus/comp-arch-lab3/pkg/isa"
+)
+
+type SymbolKind string
+
+const (
+	SymbolLabel     SymbolKind = "label"
+	SymbolLocal     SymbolKind = "local"
+	SymbolAnonymous SymbolKind = "anon"
+	SymbolEqu       SymbolKind = "equ"
+	SymbolSet       SymbolKind = "set"
+)
+
+// SymbolInfo is a row of the symbol table: the address of a label or the value of a constant
+type SymbolInfo struct {
+	Name     string
+	Kind     SymbolKind
+	Value    int
+	MetaInfo isa.TermMetaInfo
+	// References counts uses of the symbol in operands and expressions
+	References int
+}
+
+// SymbolReference is a use of a label or a constant, Written is the name as in the source, e.g. `.loop` or `1b`
+type SymbolReference struct {
+	Name     string
+	Written  string
+	MetaInfo isa.TermMetaInfo
+}
+
+// GetSymbols returns the symbol table, it's filled even if translation fails
+func (t *AsmTranslator) GetSymbols() []SymbolInfo {
+	return t.symbolTable
+}
+
+func (t *AsmTranslator) GetReferences() []SymbolReference {
+	return t.references
+}
+
+// buildSymbolTable lists labels and the last values of constants, sorted by name.
+// Constants which can't be evaluated are left out, the first error is returned with the rest of the table.
+func (t *AsmTranslator) buildSymbolTable() ([]SymbolInfo, error) {
+	var firstErr error
+	symbols := make([]SymbolInfo, 0)
+	for _, instruction := range t.instructions {
+		if instruction.Label != "" {
+			symbols = append(symbols, SymbolInfo{Name: instruction.Label, Kind: labelKind(instruction.Label), Value: instruction.Index, MetaInfo: instruction.MetaInfo, References: t.referenced[instruction.Label]})
+		}
+	}
+	for name, definitions := range t.constants {
+		definition := definitions[len(definitions)-1]
+		result, err := t.evaluateConstant(name, definition, t.programScope())
+		if err != nil {
+			if firstErr == nil {
+				firstErr = newTermError(CodeConstant, err.Error(), definition.metaInfo)
+			}
+			continue
+		}
+		kind := SymbolEqu
+		if definition.redefinable {
+			kind = SymbolSet
+		}
+		symbols = append(symbols, SymbolInfo{Name: name, Kind: kind, Value: result.number, MetaInfo: definition.metaInfo, References: t.referenced[name]})
+	}
+	slices.SortFunc(symbols, func(a, b SymbolInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return symbols, firstErr
+}
+
+func labelKind(label string) SymbolKind {
+	switch {
+	case strings.Contains(label, anonymousLabelSeparator):
+		return SymbolAnonymous
+	case strings.Contains(label, "."):
+		return SymbolLocal
+	default:
+		return SymbolLabel
+	}
+}
+
+// SerializeSymbolTable formats the symbol table as text, one symbol per line
+func SerializeSymbolTable(symbols []SymbolInfo) []byte {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("; %-22s %11s  %-5s  %s\n", "name", "value", "kind", "line"))
+	for _, symbol := range symbols {
+		builder.WriteString(fmt.Sprintf("%-24s %11d  %-5s  %s\n", symbol.Name, symbol.Value, symbol.Kind, symbol.MetaInfo.Position()))
+	}
+	return []byte(builder.String())
+}
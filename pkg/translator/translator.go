@@ -1,9 +1,9 @@
 package translator
 
 import (
+	"errors"
 	"fmt"
 	"slices"
-	"strconv"
 	"strings"
 
 	"github.com/Moleus/comp-arch-lab3/pkg/isa"
@@ -11,19 +11,90 @@ import (
 
 type Translator interface {
 	Translate(input string) (isa.Program, error)
+	TranslateObject(input string) (isa.Object, error)
 	GetLinesOfCode() int
+	GetSymbols() []SymbolInfo
+	GetDiagnostics() []Diagnostic
+	GetListing() []ListingLine
+	GetReferences() []SymbolReference
+	GetOptimizations() []Optimization
+	Format(input string) ([]byte, error)
 }
 
 type AsmTranslator struct {
 	instructions []ParsedInstruction
 	currentIndex int
+	writable     bool
+	exports      []string
+	imports      []string
+	options      Options
+	// includeStack holds files which are being parsed, the current one is the last
+	includeStack []sourceFile
+
+	macros          map[string]*macro
+	recordedMacro   *macro
+	macroExpansions int
+	expansionStack  []string
+	// invocation is the position of the outermost macro invocation which is being expanded
+	invocation *isa.TermMetaInfo
+
+	// scope is the last global label, local labels are qualified with it
+	scope           string
+	anonymousLabels map[string]int
+
+	// relocatable is set for objects, where addresses are assigned by the linker
+	relocatable bool
+
+	constants     map[string][]constantDefinition
+	constantCount int
+	// evaluating holds sequences of constants which are being evaluated to detect definitions through themselves
+	evaluating  map[int]bool
+	symbolTable []SymbolInfo
+
+	// sources holds lines of parsed files to show them in diagnostics
+	sources     map[string][]string
+	errors      []ParseError
+	diagnostics []Diagnostic
+	// referenced counts uses of labels and constants in operands and expressions
+	referenced map[string]int
+	references []SymbolReference
+	// lineInfo is the position of the line which is being parsed
+	lineInfo isa.TermMetaInfo
+	// skippedLabels are defined on lines with errors, references to them are not reported again
+	skippedLabels map[string]bool
+
+	listingEntries []listingEntry
+	listing        []ListingLine
+	optimizations  []Optimization
 
 	LinesOfCode int
 }
 
+type Options struct {
+	// FileName of the translated source. It's used in positions and to resolve relative includes
+	FileName string
+	// IncludePaths are searched for included files after the directory of the including file
+	IncludePaths []string
+	// Optimize enables the peephole optimizer, see GetOptimizations for the changes it made
+	Optimize bool
+}
+
+type sourceFile struct {
+	name     string
+	absolute string
+}
+
 func NewTranslator() Translator {
+	return NewTranslatorWithOptions(Options{})
+}
+
+func NewTranslatorWithOptions(options Options) Translator {
 	instructions := make([]ParsedInstruction, 0)
-	return &AsmTranslator{instructions: instructions, currentIndex: 0}
+	translator := &AsmTranslator{instructions: instructions, currentIndex: 0, options: options}
+	if options.FileName != "" {
+		translator.includeStack = append(translator.includeStack, newSourceFile(options.FileName))
+	}
+	return translator
 }
 
 func (t *AsmTranslator) GetLinesOfCode() int {
@@ -37,7 +108,11 @@ type ParsedInstruction struct {
 	ValueType    isa.ValueType
 	Operand      int
 	LabelOperand string
-	MetaInfo     isa.TermMetaInfo
+	// Expression is set instead of LabelOperand and Operand for operands which are not a bare label
+	Expression expression
+	Writable   bool
+	Section    isa.SectionKind
+	MetaInfo   isa.TermMetaInfo
 }
 
 func NewConstant(label string, operand int, valueType isa.ValueType) ParsedInstruction {
@@ -48,89 +123,220 @@ type ParseError struct {
 	message     string
 	lineContent string
 	line        int
+	fileName    string
+	code        string
+	expansion   string
 }
 
 func (e ParseError) Error() string {
+	if e.fileName != "" {
+		return fmt.Sprintf("Parse error at %s:%d ('%s'): %s", e.fileName, e.line, e.lineContent, e.message)
+	}
 	return fmt.Sprintf("Parse error at %d ('%s'): %s", e.line, e.lineContent, e.message)
 }
 
 func NewParseError(message string, lineContent string, line int) error {
-	return ParseError{message, lineContent, line}
+	return ParseError{message: message, lineContent: lineContent, line: line, code: CodeSyntax}
+}
+
+func newTermError(code string, message string, metaInfo isa.TermMetaInfo) error {
+	return ParseError{
+		message:     message,
+		lineContent: metaInfo.OriginalContent,
+		line:        metaInfo.LineNum,
+		fileName:    metaInfo.FileName,
+		code:        code,
+		expansion:   metaInfo.Expansion,
+	}
 }
 
+// newLineError keeps errors which already point to a line, e.g. in an included file
+func newLineError(code string, err error, metaInfo isa.TermMetaInfo) error {
+	if errors.As(err, &ParseError{}) {
+		return err
+	}
+	return newTermError(code, err.Error(), metaInfo)
+}
+
+// Translate reports all errors at once, see ErrorList and GetDiagnostics
 func (t *AsmTranslator) Translate(input string) (isa.Program, error) {
-	if err := t.ParseInstructions(input); err != nil {
-		return isa.Program{}, err
+	t.parse(input)
+	if t.options.Optimize && t.errorsFound() == nil {
+		t.optimize()
 	}
 	t.instructions = addIndices(t.instructions)
-	machineCode, err := t.convertTermsToMachineCode()
+	t.checkLayout()
+	t.checkConstantNames()
+	machineCode := t.convertTermsToMachineCode()
+	symbolTable, err := t.buildSymbolTable()
+	t.symbolTable = symbolTable
+	if errs := t.errorsFound(); errs != nil {
+		return isa.Program{}, errs
+	}
 	if err != nil {
-		return isa.Program{}, err
+		t.report(err)
+		return isa.Program{}, t.errorsFound()
 	}
-	return addStartAddress(machineCode)
+	program, err := addStartAddress(machineCode)
+	if err != nil {
+		t.report(ParseError{message: err.Error(), code: CodeLabel})
+		return isa.Program{}, t.errorsFound()
+	}
+	t.listing = t.buildListing(machineCode)
+	return program, nil
 }
 
 func (t *AsmTranslator) ParseInstructions(input string) error {
+	t.parse(input)
+	return t.errorsFound()
+}
+
+// parse collects errors of all lines and goes on, lines with errors are skipped
+func (t *AsmTranslator) parse(input string) {
+	t.parseSource(input)
+	lastLine := strings.Count(input, "\n") + 1
+	if t.recordedMacro != nil {
+		t.report(ParseError{message: fmt.Sprintf("macro '%s' is not closed with endm", t.recordedMacro.name), line: lastLine, fileName: t.options.FileName, code: CodeMacro})
+	}
+	if t.writable {
+		t.report(ParseError{message: "writable region is not closed with endwritable", line: lastLine, fileName: t.options.FileName, code: CodeDirective})
+	}
+	t.checkDuplicateLabels()
+	t.validateOperands()
+	t.warnUnusedLabels()
+}
+
+func (t *AsmTranslator) parseSource(input string) {
 	lines := strings.Split(input, "\n")
+	if t.sources == nil {
+		t.sources = make(map[string][]string)
+	}
+	t.sources[t.currentFile()] = lines
 	for i, line := range lines {
+		// the newline at the end of a file doesn't start a line
+		if i < len(lines)-1 || line != "" {
+			t.listingEntries = append(t.listingEntries, listingEntry{fileName: t.currentFile(), line: i + 1, source: strings.TrimRight(line, "\r"), first: len(t.instructions)})
+		}
 		line := strings.Split(line, ";")[0]
 		line = strings.TrimSpace(line)
-		err := t.parseLine(line, i+1)
-		if err != nil {
-			return err
+		if err := t.parseLine(line, i+1); err != nil {
+			t.report(err)
+			t.skipLabel(line)
 		}
 	}
+}
 
-	return nil
+func (t *AsmTranslator) currentFile() string {
+	if len(t.includeStack) == 0 {
+		return ""
+	}
+	return t.includeStack[len(t.includeStack)-1].name
 }
 
 func (t *AsmTranslator) parseLine(line string, lineNumber int) error {
-	metaInfo := isa.TermMetaInfo{LineNum: lineNumber, OriginalContent: line}
-	parts := strings.SplitN(line, " ", 3)
+	metaInfo := isa.TermMetaInfo{LineNum: lineNumber, OriginalContent: line, FileName: t.currentFile()}
+	if t.invocation != nil {
+		metaInfo = *t.invocation
+		metaInfo.Expansion = line
+	}
+	t.lineInfo = metaInfo
+	parts := splitParts(line)
 
 	if len(parts) == 0 || parts[0] == "" {
 		return nil
 	}
 
+	if t.recordedMacro != nil {
+		t.LinesOfCode++
+		return t.recordMacroLine(line, metaInfo)
+	}
+
 	if parts[0] == "word:" {
-		return NewParseError("Don't use `word` as a label. It's reserved", line, 0)
+		return newTermError(CodeSyntax, "Don't use `word` as a label. It's reserved", metaInfo)
+	}
+	// the statement after a label is required before any part of it is read
+	if hasLabel(parts) && len(parts) == 1 {
+		return newTermError(CodeSyntax, fmt.Sprintf("label '%s' must be on the same line with an instruction", strings.TrimSuffix(parts[0], ":")), metaInfo)
+	}
+	if hasLabel(parts) && parts[0] == ".:" {
+		return newTermError(CodeSyntax, "local label '.' has no name", metaInfo)
 	}
 
-	t.LinesOfCode++
+	if t.invocation == nil {
+		t.LinesOfCode++
+	}
+
+	if name, keyword, argument, ok := splitConstantDefinition(line); ok {
+		if err := t.defineConstant(name, keyword, argument, metaInfo); err != nil {
+			return newLineError(CodeConstant, err, metaInfo)
+		}
+		return nil
+	}
+
+	if label, invoked, arguments, ok := t.findMacroInvocation(line); ok {
+		if err := t.expandMacro(invoked, label, arguments, metaInfo); err != nil {
+			return newLineError(CodeMacro, err, metaInfo)
+		}
+		return nil
+	}
+
+	if directive, ok := findDirective(parts[0]); ok {
+		argument := strings.TrimSpace(strings.TrimSpace(line)[len(parts[0]):])
+		if err := directive(t, argument); err != nil {
+			return newLineError(directiveCode(parts[0]), err, metaInfo)
+		}
+		return nil
+	}
 
-	if isConstantDeclaration(parts) {
-		instructions, err := parseConstantDeclaration(parts)
+	var instructions []ParsedInstruction
+	add := t.addConstant
+	if label, count, ok := splitReservation(parts); ok {
+		reserved, err := t.parseReservation(label, count)
 		if err != nil {
-			return NewParseError(fmt.Sprintf("failed to parse constant: %s", err.Error()), line, lineNumber)
+			return newTermError(CodeSyntax, fmt.Sprintf("failed to reserve words: %s", err.Error()), metaInfo)
 		}
-		for _, instruction := range instructions {
-			instruction.MetaInfo = metaInfo
-			t.addConstant(instruction)
+		instructions = reserved
+	} else if isConstantDeclaration(parts) {
+		constants, err := t.parseConstantDeclaration(parts)
+		if err != nil {
+			return newTermError(CodeSyntax, fmt.Sprintf("failed to parse constant: %s", err.Error()), metaInfo)
 		}
+		instructions = constants
 	} else {
-		instruction := t.parseInstructionDeclaration(parts)
-		instruction.MetaInfo = metaInfo
-		t.addInstruction(instruction)
+		instruction, err := t.parseInstructionDeclaration(parts)
+		if errors.Is(err, errUnknownInstruction) {
+			return newTermError(CodeUnknownInstruction, err.Error(), metaInfo)
+		}
+		if err != nil {
+			return newTermError(CodeSyntax, err.Error(), metaInfo)
+		}
+		instructions, add = []ParsedInstruction{instruction}, t.addInstruction
 	}
 
+	if err := t.scopeLabels(instructions); err != nil {
+		return newTermError(CodeLabel, err.Error(), metaInfo)
+	}
+	for _, instruction := range instructions {
+		instruction.MetaInfo = metaInfo
+		add(instruction)
+	}
 	return nil
 }
 
-func parseConstantDeclaration(parts []string) ([]ParsedInstruction, error) {
+// parseConstantDeclaration parses `label: word: 1, 'str', 4 dup(0)`, the label points to the first word
+func (t *AsmTranslator) parseConstantDeclaration(parts []string) ([]ParsedInstruction, error) {
 	label := strings.Split(parts[0], ":")[0]
-	argument := strings.TrimSpace(parts[2])
-
-	switch {
-	case strings.HasPrefix(argument, "'") && strings.HasSuffix(argument, "'"):
-		return parseConstString(label, argument), nil
-	case isNumber(argument):
-		return wrapInSlice(parseConstNumber(label, argument))
-	default:
-		return wrapInSlice(parseAddressConstantDeclaration(label, argument))
+	if len(parts) < 3 || strings.TrimSpace(parts[2]) == "" {
+		return nil, errors.New("no value after 'word:'")
 	}
+	words, err := t.parseDataElements(strings.TrimSpace(parts[2]))
+	if err != nil {
+		return nil, err
+	}
+	return labelFirstWord(label, words)
 }
 
-func (t *AsmTranslator) parseInstructionDeclaration(parts []string) ParsedInstruction {
+func (t *AsmTranslator) parseInstructionDeclaration(parts []string) (ParsedInstruction, error) {
 	instruction := ParsedInstruction{}
 	if hasLabel(parts) {
 		label := strings.Split(parts[0], ":")[0]
@@ -138,40 +344,48 @@ func (t *AsmTranslator) parseInstructionDeclaration(parts []string) ParsedInstru
 		parts = parts[1:]
 	}
 	instruction.Opcode = parts[0]
+	if _, err := isa.GetOpcodeFromString(instruction.Opcode); err != nil {
+		return ParsedInstruction{}, fmt.Errorf("%w '%s'", errUnknownInstruction, instruction.Opcode)
+	}
 	if len(parts) > 1 {
-		instruction = addLabelOperand(instruction, parts[1])
+		return parseOperand(instruction, strings.Join(parts[1:], " "))
 	}
-	return instruction
+	return instruction, nil
 }
 
-func addLabelOperand(instruction ParsedInstruction, label string) ParsedInstruction {
-	if isIndirectAddressing(label) {
+// parseOperand reads `expression` or `(expression)` for indirect addressing
+func parseOperand(instruction ParsedInstruction, operand string) (ParsedInstruction, error) {
+	operand = strings.TrimSpace(operand)
+	if isIndirectAddressing(operand) {
 		instruction.ValueType = isa.ValueTypeAddressIndirect
-		label = strings.Trim(label, "()")
+		operand = operand[1 : len(operand)-1]
 	} else {
 		instruction.ValueType = isa.ValueTypeAddressDirect
 	}
-	instruction.LabelOperand = label
-	return instruction
+	parsed, err := parseExpression(operand)
+	if err != nil {
+		return ParsedInstruction{}, err
+	}
+	if label, ok := parsed.(symbolReference); ok {
+		instruction.LabelOperand = string(label)
+	} else {
+		instruction.Expression = parsed
+	}
+	return instruction, nil
 }
 
-func parseConstString(label string, value string) []ParsedInstruction {
+func parseConstString(label string, value string) ([]ParsedInstruction, error) {
 	value = strings.Trim(value, "'")
+	if value == "" {
+		return nil, errors.New("string literal is empty")
+	}
 	instructions := make([]ParsedInstruction, 0)
 	for _, char := range value {
 		instructions = append(instructions, NewConstant("", int(char), isa.ValueTypeChar))
 	}
 	instructions[0].Label = label
 	instructions = append(instructions, NewConstant("", 0, isa.ValueTypeChar))
-	return instructions
-}
-
-func parseConstNumber(label string, value string) (ParsedInstruction, error) {
-	number, err := strconv.Atoi(value)
-	if err != nil {
-		return ParsedInstruction{}, fmt.Errorf("failed to parse number: %s", value)
-	}
-	return NewConstant(label, number, isa.ValueTypeNumber), nil
+	return instructions, nil
 }
 
 func parseAddressConstantDeclaration(label string, argument string) (ParsedInstruction, error) {
@@ -179,11 +393,16 @@ func parseAddressConstantDeclaration(label string, argument string) (ParsedInstr
 }
 
 func (t *AsmTranslator) addConstant(instruction ParsedInstruction) {
+	instruction.Section = isa.SectionData
 	t.addInstruction(instruction)
 }
 
 func (t *AsmTranslator) addInstruction(instruction ParsedInstruction) {
 	instruction.Index = t.currentIndex
+	instruction.Writable = t.writable
+	if instruction.Section == "" {
+		instruction.Section = isa.SectionCode
+	}
 	t.instructions = append(t.instructions, instruction)
 	t.currentIndex++
 }
@@ -194,62 +413,88 @@ func (t *AsmTranslator) labelToAddress(label string) (int, error) {
 			return instruction.Index, nil
 		}
 	}
-	return 0, fmt.Errorf("label '%s' not found", label)
+	return 0, labelNotFound(label)
 }
 
-func (t *AsmTranslator) convertTermsToMachineCode() (machineCode []isa.MachineCodeTerm, err error) {
-	machineCode = make([]isa.MachineCodeTerm, len(t.instructions))
+func (t *AsmTranslator) convertTermsToMachineCode() []isa.MachineCodeTerm {
+	machineCode := make([]isa.MachineCodeTerm, len(t.instructions))
+	byAddress := make(map[int]ParsedInstruction, len(t.instructions))
+	for _, instruction := range t.instructions {
+		byAddress[instruction.Index] = instruction
+	}
 	for i, instruction := range t.instructions {
-		var label *string
-		if instruction.Label != "" {
-			label = new(string)
-			*label = instruction.Label
-		}
-		operand, err := t.inferOperand(instruction)
+		operand, err := t.inferOperand(instruction, i)
 		if err != nil {
-			return []isa.MachineCodeTerm{}, err
+			t.reportOperandError(err, instruction)
+			continue
 		}
-
-		opcode, err := isa.GetOpcodeFromString(instruction.Opcode)
+		if operand != nil {
+			if target, ok := byAddress[*operand]; ok {
+				t.checkOperandTarget(instruction, target)
+			}
+		}
+		machineCode[i], err = newMachineCodeTerm(instruction, operand)
 		if err != nil {
-			return []isa.MachineCodeTerm{}, err
+			t.report(newTermError(CodeUnknownInstruction, err.Error(), instruction.MetaInfo))
 		}
+	}
+	return machineCode
+}
 
-		operandType := instruction.ValueType
-		newMachineCodeTerm := isa.MachineCodeTerm{
-			Index:       instruction.Index,
-			Label:       label,
-			Opcode:      opcode,
-			Operand:     operand,
-			OperandType: operandType,
-			TermInfo:    instruction.MetaInfo,
-		}
-		machineCode[i] = newMachineCodeTerm
+func newMachineCodeTerm(instruction ParsedInstruction, operand *int) (isa.MachineCodeTerm, error) {
+	var label *string
+	if instruction.Label != "" {
+		label = new(string)
+		*label = instruction.Label
+	}
+
+	opcode, err := isa.GetOpcodeFromString(instruction.Opcode)
+	if err != nil {
+		return isa.MachineCodeTerm{}, err
 	}
-	return machineCode, nil
+
+	return isa.MachineCodeTerm{
+		Index:       instruction.Index,
+		Label:       label,
+		Opcode:      opcode,
+		Operand:     operand,
+		OperandType: instruction.ValueType,
+		Writable:    instruction.Writable,
+		TermInfo:    instruction.MetaInfo,
+	}, nil
 }
 
-func (t *AsmTranslator) inferOperand(instruction ParsedInstruction) (*int, error) {
-	var operand = new(int)
-	var err error
+func (t *AsmTranslator) inferOperand(instruction ParsedInstruction, position int) (*int, error) {
+	if operand := operandExpression(instruction); operand != nil {
+		result, err := t.evaluate(operand, position, &value{number: instruction.Index}, t.programScope())
+		if err != nil {
+			return nil, err
+		}
+		return &result.number, checkOperandRange(instruction, result.number)
+	}
 
 	switch instruction.ValueType {
 	case isa.ValueTypeNone:
 		return nil, nil
 	case isa.ValueTypeChar, isa.ValueTypeNumber:
-		*operand = instruction.Operand
-		return operand, nil
-	case isa.ValueTypeAddressDirect, isa.ValueTypeAddressIndirect:
-		if instruction.LabelOperand == "" {
-			panic(fmt.Sprintf("label operand is empty: %s", instruction.Opcode))
-		}
-		*operand, err = t.labelToAddress(instruction.LabelOperand)
-		return operand, err
+		operand := instruction.Operand
+		return &operand, nil
 	default:
-		panic(fmt.Sprintf("unknown operand type: %d", instruction.ValueType))
+		panic(fmt.Sprintf("label operand is empty: %s", instruction.Opcode))
 	}
 }
 
+// operandExpression returns the operand which must be evaluated, a bare label is a reference to it
+func operandExpression(instruction ParsedInstruction) expression {
+	if instruction.Expression != nil {
+		return instruction.Expression
+	}
+	if instruction.LabelOperand != "" {
+		return symbolReference(instruction.LabelOperand)
+	}
+	return nil
+}
+
 func addStartAddress(machineCode []isa.MachineCodeTerm) (isa.Program, error) {
 	startTerm := slices.IndexFunc(machineCode, func(term isa.MachineCodeTerm) bool {
 		return term.Label != nil && *term.Label == "start"
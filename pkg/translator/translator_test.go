@@ -53,7 +53,7 @@ func TestParseConstant(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			parts := strings.Fields(test.input)
-			instructions, err := parseConstantDeclaration(parts)
+			instructions, err := NewTranslator().(*AsmTranslator).parseConstantDeclaration(parts)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -63,3 +63,55 @@ func TestParseConstant(t *testing.T) {
 		})
 	}
 }
+
+func TestWritableDirective(t *testing.T) {
+	program, err := NewTranslator().Translate(`start: nop
+  writable
+  patch: jmp start
+  endwritable
+  hlt`)
+	assert.NilError(t, err)
+	assert.Equal(t, program.Instructions[0].Writable, false)
+	assert.Equal(t, program.Instructions[1].Writable, true)
+	assert.Equal(t, program.Instructions[2].Writable, false)
+
+	_, err = NewTranslator().Translate("start: nop\n  writable\n  hlt")
+	assert.ErrorContains(t, err, "not closed")
+	_, err = NewTranslator().Translate("start: nop\n  endwritable")
+	assert.ErrorContains(t, err, "endwritable without writable")
+}
+
+func TestWordsSeparatedByAnyWhitespace(t *testing.T) {
+	program, err := NewTranslator().Translate("value:\tword:   5\nstart:  ld\t\tvalue\n\thlt")
+	assert.NilError(t, err)
+	assert.Equal(t, *program.Instructions[0].Operand, 5)
+	assert.Equal(t, program.Instructions[1].Opcode, isa.OpcodeLoad)
+	assert.Equal(t, *program.Instructions[1].Operand, 0)
+}
+
+func TestTranslateObject(t *testing.T) {
+	object, err := NewTranslator().TranslateObject(`global start
+extern print
+counter: word: 3
+start: ld counter
+  jmp print`)
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(object.Sections), 2)
+	assert.Equal(t, object.Sections[0].Kind, isa.SectionData)
+	assert.Equal(t, object.Sections[1].Kind, isa.SectionCode)
+	assert.DeepEqual(t, object.Symbols, []isa.Symbol{
+		{Name: "counter", Section: isa.SectionData, Offset: 0},
+		{Name: "start", Section: isa.SectionCode, Offset: 0, Exported: true},
+	})
+	assert.DeepEqual(t, object.Imports, []string{"print"})
+	assert.DeepEqual(t, object.Relocations, []isa.Relocation{
+		{Section: isa.SectionCode, Offset: 0, Symbol: "counter"},
+		{Section: isa.SectionCode, Offset: 1, Symbol: "print"},
+	})
+
+	_, err = NewTranslator().TranslateObject("start: jmp print")
+	assert.ErrorContains(t, err, "label 'print' not found")
+	_, err = NewTranslator().TranslateObject("global print\nstart: hlt")
+	assert.ErrorContains(t, err, "global label 'print' is not defined")
+}
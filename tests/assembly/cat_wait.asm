@@ -0,0 +1,20 @@
+vector: word: interrupt
+in_port: word: 0
+out_port: word: 1
+flag: word: 0
+line_feed: word: 10
+
+start: ei
+wait_loop: wait
+  ld flag
+  jz wait_loop
+  hlt
+
+interrupt: in in_port
+  out out_port
+  cmp line_feed
+  jnz returning
+  ld flag
+  inc
+  st flag
+  returning: iret
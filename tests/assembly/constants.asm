@@ -0,0 +1,27 @@
+; символьные константы equ и set
+COUNT equ 3
+FIRST equ '1'
+CHAR_PORT equ 1
+step set 2
+
+digit: word: FIRST
+counter: word: COUNT
+out_port: word: CHAR_PORT
+increment: word: step
+step set step * 2
+double: word: step
+LAST_DATA equ * - 1
+
+start: ld digit
+  out out_port
+  add increment
+  st digit
+  ld counter
+  dec
+  st counter
+  jz done
+  jmp start
+done: ld LAST_DATA
+  add digit
+  out out_port
+  hlt
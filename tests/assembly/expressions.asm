@@ -0,0 +1,26 @@
+; константные выражения в константах и операндах
+message: word: 'expr'
+message_end: word: 0
+length: word: message_end - message - 1
+digit_zero: word: '0' + 0
+lower_a: word: 0x41 | 0b100000
+minus_two: word: -2
+out_port: word: 1
+
+start: ld length
+  add digit_zero
+  out out_port
+  ld message + 1
+  out out_port
+  ld lower_a
+  out out_port
+  ld minus_two
+  jmp * + 2
+  hlt
+  inc
+  inc
+  jz done
+  hlt
+done: ld (1 << 1) - 1 + message_end - message_end
+  out out_port
+  hlt
@@ -0,0 +1,9 @@
+message: word: 'Hello from include!'
+pointer: word: message
+
+start: ld pointer
+  st print_pointer
+  jmp print_string
+print_string_done: hlt
+
+include "lib/print_string.asm"
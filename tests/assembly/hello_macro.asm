@@ -0,0 +1,33 @@
+; макросы с параметрами, локальными метками и вложенной подстановкой
+macro print_char value
+  ld value
+  out out_port
+endm
+
+macro print_string pointer
+  %%loop: ld (pointer)
+    jz %%end
+    out out_port
+    ld pointer
+    inc
+    st pointer
+    jmp %%loop
+  %%end: nop
+endm
+
+macro print_line pointer
+  print_string pointer
+  print_char line_feed
+endm
+
+hello: word: 'Hello,'
+world: word: 'macro!'
+hello_pointer: word: hello
+world_pointer: word: world
+line_feed: word: 10
+out_port: word: 1
+
+start: nop
+  print_line hello_pointer
+  print_line world_pointer
+  hlt
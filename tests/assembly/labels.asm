@@ -0,0 +1,25 @@
+; локальные и анонимные метки
+digit: word: '3' + 0
+counter: word: 3
+out_port: word: 1
+newline: word: 10
+
+start: ld digit
+.loop: out out_port
+  dec
+  st digit
+  ld counter
+  dec
+  st counter
+  jz 1f
+  ld digit
+  jmp .loop
+1: ld newline
+  out out_port
+  jmp finish
+
+finish: ld counter
+1: inc
+  cmp newline
+  jnz 1b
+  hlt
@@ -0,0 +1,30 @@
+; размещение в памяти: org, align, res, массивы и dup
+COUNT equ 4
+
+org 0x20
+digits: word: '1' + 0, '2' + 0, 2 dup('3' + 0)
+  align 8
+copy: res COUNT
+source: word: digits
+target: word: copy
+counter: word: COUNT
+out_port: word: 1
+
+  org 0x40
+start: ld (source)
+  st (target)
+  out out_port
+  ld source
+  inc
+  st source
+  ld target
+  inc
+  st target
+  ld counter
+  dec
+  st counter
+  jz done
+  jmp start
+done: ld copy + COUNT - 1
+  out out_port
+  hlt
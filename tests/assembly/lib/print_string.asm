@@ -0,0 +1,12 @@
+; вывод строки по адресу из print_pointer до нулевого символа.
+; после вывода управление передается на метку print_string_done, которую определяет включающий файл
+print_port: word: 1
+print_pointer: word: 0
+
+print_string: ld (print_pointer)
+  jz print_string_done
+  out print_port
+  ld print_pointer
+  inc
+  st print_pointer
+  jmp print_string
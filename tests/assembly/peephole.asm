@@ -0,0 +1,21 @@
+; шаблоны, которые удаляет peephole-оптимизатор (-optimize)
+out_port: word: 1
+counter: word: 3
+digit: word: '0'
+
+start: cla
+  ld digit
+loop: inc
+  st digit
+  ld digit
+  out out_port
+  ld counter
+  dec
+  st counter
+  jz done
+  ld counter
+  ld digit
+  jmp loop
+done: ld digit
+  jmp finish
+finish: hlt
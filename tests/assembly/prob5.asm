@@ -1,4 +1,4 @@
-out_port: word: 1
+out_port: word: 2 ; порт вывода чисел
 smallest_divisible: word: 10
 max_divisor: word: 10
 two_const: word: 2
@@ -0,0 +1,20 @@
+out_port: word: 1
+letter_a: word: 'A'
+letter_b: word: 'B'
+first_addr: word: first
+second_addr: word: second
+
+; переписываем адрес перехода в patch: first -> second
+start: ld patch
+  sub first_addr
+  add second_addr
+  st patch
+  writable
+  patch: jmp first
+  endwritable
+  first: ld letter_a
+    out out_port
+    hlt
+  second: ld letter_b
+    out out_port
+    hlt
@@ -7,6 +7,7 @@ import (
 	translator2 "github.com/Moleus/comp-arch-lab3/pkg/translator"
 	"gopkg.in/yaml.v3"
 	"gotest.tools/v3/golden"
+	"io"
 	"os"
 	"strings"
 	"testing"
@@ -50,7 +51,7 @@ func parseGoldenFile(t *testing.T, filename string) GoldenContents {
 func runTest(t *testing.T, goldenFile string) {
 	goldenContents := parseGoldenFile(t, goldenFile)
 
-	translator := translator2.NewTranslator()
+	translator := translator2.NewTranslatorWithOptions(translator2.Options{IncludePaths: []string{"assembly"}})
 	program, err := translator.Translate(goldenContents.TranslatorInput)
 	if err != nil {
 		t.Fatal(err)
@@ -69,7 +70,7 @@ func runTest(t *testing.T, goldenFile string) {
 	dataPathOutputBuffer := bytes.NewBuffer([]byte{})
 	controlUnitStateOutputBuffer := bytes.NewBuffer([]byte{})
 
-	err = machine.RunSimulation(ioData, program, dataPathOutputBuffer, controlUnitStateOutputBuffer)
+	err = machine.RunSimulation(machine.DefaultConfig(), ioData, program, dataPathOutputBuffer, controlUnitStateOutputBuffer)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -88,3 +89,39 @@ func runTest(t *testing.T, goldenFile string) {
 	}
 	golden.Assert(t, string(yamlOutput), goldenFile)
 }
+
+// TestOptimizedSimulation runs golden programs translated with the peephole optimizer, they must print the same
+func TestOptimizedSimulation(t *testing.T) {
+	dir, err := os.ReadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed := 0
+	for _, file := range dir {
+		t.Run(file.Name(), func(t *testing.T) {
+			goldenContents := parseGoldenFile(t, file.Name())
+			translator := translator2.NewTranslatorWithOptions(translator2.Options{IncludePaths: []string{"assembly"}, Optimize: true})
+			program, err := translator.Translate(goldenContents.TranslatorInput)
+			if err != nil {
+				t.Fatal(err)
+			}
+			removed += len(translator.GetOptimizations())
+
+			ioData, err := isa.ReadIoData(strings.NewReader(goldenContents.MachineInput))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dataPathOutputBuffer := bytes.NewBuffer([]byte{})
+			err = machine.RunSimulation(machine.DefaultConfig(), ioData, program, dataPathOutputBuffer, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dataPathOutputBuffer.String() != goldenContents.MachineStdout {
+				t.Fatalf("optimized program printed %q instead of %q", dataPathOutputBuffer.String(), goldenContents.MachineStdout)
+			}
+		})
+	}
+	if removed == 0 {
+		t.Fatal("no golden program was optimized")
+	}
+}